@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"book/mom"
+)
+
+var CastCmd = &Command{
+	Usage: "cast <-cast file> <-gap n> <-csv> <file>",
+	Short: "show where each character of a manuscript appears",
+	Long: `Show where each character of the given manuscript appears. The characters are
+read from the cast file, which lists the name of each character followed by
+any aliases for them, one per line, for example,
+
+    Jonathan Harker: Harker, Jonathan
+    Count Dracula: Dracula, the Count
+
+The cast file is the book.cast file next to the manuscript, unless given via
+the -cast flag. Names are matched as whole words, and are case-sensitive. Where
+names overlap, such as Jonathan Harker and Harker, the longest is matched.
+
+A table of the number of times each character is mentioned in each chapter is
+printed, followed by the first and last appearance of each character, and any
+gaps in which a character does not appear for more chapters than given via the
+-gap flag, by default 3.
+
+The -csv flag prints the table as CSV instead.
+`,
+	Run: castCmd,
+}
+
+var ErrCastEmpty = errors.New("no characters in cast")
+
+// Character is a single character of a cast, along with the aliases they are
+// also known by.
+type Character struct {
+	Name    string
+	Aliases []string
+}
+
+// Names returns the name of the character, followed by their aliases.
+func (c *Character) Names() []string {
+	return append([]string{c.Name}, c.Aliases...)
+}
+
+// Cast is the characters of a manuscript.
+type Cast []*Character
+
+// LoadCast loads the cast file.
+func LoadCast(file string) (Cast, error) {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	cast := make(Cast, 0)
+
+	sc := bufio.NewScanner(f)
+
+	n := 0
+
+	for sc.Scan() {
+		n++
+
+		line := strings.TrimSpace(sc.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, aliases, _ := strings.Cut(line, ":")
+
+		c := &Character{
+			Name: strings.TrimSpace(name),
+		}
+
+		if c.Name == "" {
+			return nil, fmt.Errorf("%s:%d: no name for character", file, n)
+		}
+
+		for _, alias := range strings.Split(aliases, ",") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				c.Aliases = append(c.Aliases, alias)
+			}
+		}
+		cast = append(cast, c)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cast) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCastEmpty, file)
+	}
+	return cast, nil
+}
+
+// Mention is the mention of a character within some text, the start and end
+// being the byte offsets of the name used.
+type Mention struct {
+	Character *Character
+	Start     int
+	End       int
+}
+
+// wordRune returns whether the given rune is part of a word.
+func wordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wholeWord returns whether the text between the given offsets of the string
+// is a whole word, or words, that is not part of a longer word.
+func wholeWord(s string, start, end int) bool {
+	if r, n := utf8.DecodeLastRuneInString(s[:start]); n > 0 && wordRune(r) {
+		return false
+	}
+
+	if r, n := utf8.DecodeRuneInString(s[end:]); n > 0 && wordRune(r) {
+		return false
+	}
+	return true
+}
+
+// Mentions returns the mentions of the characters of the cast within the given
+// text, in order. Where mentions overlap, the longest is returned, and where
+// two characters share a name, the first in the cast is returned.
+func (c Cast) Mentions(s string) []*Mention {
+	found := make([]*Mention, 0)
+
+	for _, ch := range c {
+		for _, name := range ch.Names() {
+			// An empty name would match everywhere without ever moving on.
+			if name == "" {
+				continue
+			}
+
+			for off := 0; off < len(s); {
+				i := strings.Index(s[off:], name)
+
+				if i < 0 {
+					break
+				}
+
+				start := off + i
+				end := start + len(name)
+
+				if wholeWord(s, start, end) {
+					found = append(found, &Mention{
+						Character: ch,
+						Start:     start,
+						End:       end,
+					})
+				}
+				off = end
+			}
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Start == found[j].Start {
+			return found[i].End > found[j].End
+		}
+		return found[i].Start < found[j].Start
+	})
+
+	mentions := make([]*Mention, 0, len(found))
+
+	end := 0
+
+	for _, m := range found {
+		if m.Start < end {
+			continue
+		}
+
+		mentions = append(mentions, m)
+		end = m.End
+	}
+	return mentions
+}
+
+// Appearance is the location of a mention of a character.
+type Appearance struct {
+	Line    int
+	Chapter int
+}
+
+// CastAppearances is the appearances of each character of a cast throughout
+// the chapters of a manuscript.
+type CastAppearances struct {
+	Cast     Cast
+	Chapters []*mom.Chapter
+
+	// Counts is the number of mentions of each character in each chapter,
+	// indexed by chapter then character.
+	Counts [][]int
+
+	First map[*Character]Appearance
+	Last  map[*Character]Appearance
+}
+
+// NewCastAppearances returns the appearances of the cast in each of the given
+// chapters.
+func NewCastAppearances(ms *mom.Manuscript, cast Cast, cps []*chapterParagraphs) *CastAppearances {
+	a := &CastAppearances{
+		Cast:     cast,
+		Chapters: make([]*mom.Chapter, 0, len(cps)),
+		Counts:   make([][]int, 0, len(cps)),
+		First:    make(map[*Character]Appearance),
+		Last:     make(map[*Character]Appearance),
+	}
+
+	index := make(map[*Character]int)
+
+	for i, c := range cast {
+		index[c] = i
+	}
+
+	for i, cp := range cps {
+		counts := make([]int, len(cast))
+
+		for _, p := range cp.paras {
+			mentions := cast.Mentions(p.Text)
+
+			if len(mentions) == 0 {
+				continue
+			}
+
+			parts := paragraphParts(ms, p)
+
+			for _, m := range mentions {
+				counts[index[m.Character]]++
+
+				app := Appearance{
+					Chapter: i,
+				}
+
+				j := sort.Search(len(parts), func(j int) bool {
+					return parts[j].pos > m.Start
+				}) - 1
+
+				if j >= 0 {
+					app.Line = parts[j].line
+				}
+
+				if _, ok := a.First[m.Character]; !ok {
+					a.First[m.Character] = app
+				}
+				a.Last[m.Character] = app
+			}
+		}
+
+		a.Chapters = append(a.Chapters, cp.chapter)
+		a.Counts = append(a.Counts, counts)
+	}
+	return a
+}
+
+// Gaps returns the runs of chapters, between the first and last appearance of
+// the character, in which the character is not mentioned, that are longer than
+// n chapters. Each gap is the index of the first and last chapter of the run.
+func (a *CastAppearances) Gaps(c *Character, n int) [][2]int {
+	gaps := make([][2]int, 0)
+
+	first, ok := a.First[c]
+
+	if !ok {
+		return gaps
+	}
+
+	i := 0
+
+	for ; i < len(a.Cast); i++ {
+		if a.Cast[i] == c {
+			break
+		}
+	}
+
+	start := -1
+
+	for j := first.Chapter; j <= a.Last[c].Chapter; j++ {
+		if a.Counts[j][i] == 0 {
+			if start < 0 {
+				start = j
+			}
+			continue
+		}
+
+		if start >= 0 && j-start > n {
+			gaps = append(gaps, [2]int{start, j - 1})
+		}
+		start = -1
+	}
+	return gaps
+}
+
+func castCmd(cmd *Command, args []string) error {
+	var (
+		castfile string
+		gap      int
+		asCSV    bool
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.StringVar(&castfile, "cast", "", "the cast file of characters and their aliases")
+	fs.IntVar(&gap, "gap", 3, "the number of chapters a character may not appear for")
+	fs.BoolVar(&asCSV, "csv", false, "print the table as CSV")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) != 1 {
+		return ErrUsage
+	}
+
+	file := args[0]
+
+	if castfile == "" {
+		castfile = filepath.Join(filepath.Dir(file), "book.cast")
+	}
+
+	cast, err := LoadCast(castfile)
+
+	if err != nil {
+		return err
+	}
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		return err
+	}
+
+	cps, paras, err := paragraphsByChapter(ms)
+
+	if err != nil {
+		return err
+	}
+
+	// A manuscript without chapters is treated as a single chapter.
+	if len(cps) == 0 {
+		cps = []*chapterParagraphs{{paras: paras}}
+	}
+
+	a := NewCastAppearances(ms, cast, cps)
+
+	label := func(i int) string {
+		if ch := a.Chapters[i]; ch != nil {
+			return ch.Name()
+		}
+		return "Manuscript"
+	}
+
+	if asCSV {
+		var buf strings.Builder
+
+		w := csv.NewWriter(&buf)
+
+		header := []string{"Chapter"}
+
+		for _, c := range cast {
+			header = append(header, c.Name)
+		}
+		w.Write(header)
+
+		for i, counts := range a.Counts {
+			record := []string{label(i)}
+
+			for _, n := range counts {
+				record = append(record, strconv.Itoa(n))
+			}
+			w.Write(record)
+		}
+
+		w.Flush()
+
+		if err := w.Error(); err != nil {
+			return err
+		}
+
+		cmd.Print(buf.String())
+		return nil
+	}
+
+	header := make([]string, 0, len(cast))
+
+	for _, c := range cast {
+		header = append(header, c.Name)
+	}
+
+	rows := make([]statsRow, 0, len(a.Counts)+1)
+	totals := make([]int, len(cast))
+
+	for i, counts := range a.Counts {
+		cols := make([]string, 0, len(counts))
+
+		for j, n := range counts {
+			cols = append(cols, formatNumber(n))
+			totals[j] += n
+		}
+		rows = append(rows, statsRow{label: label(i), cols: cols})
+	}
+
+	if len(a.Counts) > 1 {
+		cols := make([]string, 0, len(totals))
+
+		for _, n := range totals {
+			cols = append(cols, formatNumber(n))
+		}
+		rows = append(rows, statsRow{label: "Manuscript", cols: cols})
+	}
+
+	printStats(cmd, header, rows)
+
+	cmd.Println()
+	cmd.Println("Appearances:")
+
+	for _, c := range cast {
+		first, ok := a.First[c]
+
+		if !ok {
+			cmd.Printf("    %s: never appears\n", c.Name)
+			continue
+		}
+
+		last := a.Last[c]
+
+		cmd.Printf("    %s: first %s:%d (%s), last %s:%d (%s)\n", c.Name, file, first.Line, label(first.Chapter), file, last.Line, label(last.Chapter))
+
+		for _, g := range a.Gaps(c, gap) {
+			cmd.Printf("        absent for %d chapters: %s to %s\n", g[1]-g[0]+1, label(g[0]), label(g[1]))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCastMentions(t *testing.T) {
+	harker := &Character{Name: "Jonathan Harker", Aliases: []string{"Harker", "Jonathan"}}
+	mina := &Character{Name: "Mina"}
+	nameless := &Character{Aliases: []string{"Lucy"}}
+
+	cast := Cast{harker, mina, nameless}
+
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Jonathan Harker wrote to Mina.", []string{"Jonathan Harker", "Mina"}},
+		{"Harker’s letter to Jonathan.", []string{"Harker", "Jonathan"}},
+		{"Minarets of Harkerville.", []string{}},
+		{"“Mina,” said Mr. Harker.", []string{"Mina", "Harker"}},
+		{"Lucy slept.", []string{"Lucy"}},
+	}
+
+	for _, test := range tests {
+		got := make([]string, 0)
+
+		for _, m := range cast.Mentions(test.in) {
+			got = append(got, test.in[m.Start:m.End])
+		}
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Cast.Mentions(%q) mismatch (-want +got):\n%s", test.in, diff)
+		}
+	}
+}
+
+func TestLoadCast(t *testing.T) {
+	dir := filepath.Join("testdata", "cast")
+
+	tests := []struct {
+		file string
+		want Cast
+		err  string
+	}{
+		{
+			"harkers.cast",
+			Cast{
+				{Name: "Jonathan Harker", Aliases: []string{"Harker", "Jonathan"}},
+				{Name: "Mina"},
+			},
+			"",
+		},
+		{"nameless.cast", nil, ":2: no name for character"},
+		{"empty.cast", nil, ErrCastEmpty.Error()},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join(dir, test.file)
+
+		cast, err := LoadCast(file)
+
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("LoadCast(%q) = %v, want error containing %q", file, err, test.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("LoadCast(%q): %v\n", file, err)
+		}
+
+		if diff := cmp.Diff(test.want, cast); diff != "" {
+			t.Errorf("LoadCast(%q) mismatch (-want +got):\n%s", file, diff)
+		}
+	}
+}
+
+func TestCastCmd(t *testing.T) {
+	dir := filepath.Join("testdata", "cast")
+	file := filepath.Join(dir, "cast.mom")
+
+	tests := []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{
+			[]string{"-gap", "1", file},
+			[]string{
+				"            Jonathan Harker  Mina  Lucy",
+				"Chapter 1                 1     1     0",
+				"Chapter 2                 1     0     0",
+				"Chapter 3                 0     0     0",
+				"Chapter 4                 0     0     0",
+				"Chapter 5                 1     1     0",
+				"Manuscript                3     2     0",
+				"",
+				"Appearances:",
+				"    Jonathan Harker: first " + file + ":4 (Chapter 1), last " + file + ":24 (Chapter 5)",
+				"        absent for 2 chapters: Chapter 3 to Chapter 4",
+				"    Mina: first " + file + ":4 (Chapter 1), last " + file + ":24 (Chapter 5)",
+				"        absent for 3 chapters: Chapter 2 to Chapter 4",
+				"    Lucy: never appears",
+				"",
+			},
+			nil,
+		},
+		{
+			[]string{"-csv", file},
+			[]string{
+				"Chapter,Jonathan Harker,Mina,Lucy",
+				"Chapter 1,1,1,0",
+				"Chapter 2,1,0,0",
+				"Chapter 3,0,0,0",
+				"Chapter 4,0,0,0",
+				"Chapter 5,1,1,0",
+				"",
+			},
+			nil,
+		},
+		{[]string{"-cast", filepath.Join(dir, "empty.cast"), file}, nil, ErrCastEmpty},
+		{[]string{"-cast", filepath.Join(dir, "missing.cast"), file}, nil, os.ErrNotExist},
+		{[]string{"-csv"}, nil, ErrUsage},
+	}
+
+	for _, test := range tests {
+		buf := CaptureOutput(CastCmd)
+
+		if err := castCmd(CastCmd, test.args); !errors.Is(err, test.err) {
+			t.Fatalf("castCmd(CastCmd, %v) = %v, want = %v", test.args, err, test.err)
+		}
+
+		if test.err != nil {
+			continue
+		}
+
+		if diff := cmp.Diff(strings.Join(test.want, "\n"), buf.String()); diff != "" {
+			t.Errorf("castCmd(CastCmd, %v) mismatch (-want +got):\n%s", test.args, diff)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package main
 
+import "book/mom"
+
 var CatCmd = &Command{
 	Usage: "cat <file> [chapter,...]",
 	Short: "print out text content of the manuscript",
@@ -14,13 +16,13 @@ func catCmd(cmd *Command, args []string) error {
 	file := args[0]
 	args = args[1:]
 
-	ms, err := ParseManuscript(file)
+	ms, err := mom.ParseManuscript(file)
 
 	if err != nil {
 		return err
 	}
 
-	sc := Scanner{
+	sc := mom.Scanner{
 		Tokens: ms.Tokens,
 	}
 
@@ -34,7 +36,7 @@ func catCmd(cmd *Command, args []string) error {
 		sc.Tokens = sc.Tokens[0:0]
 
 		for _, tok := range ms.Tokens {
-			if m, ok := tok.(*Macro); ok {
+			if m, ok := tok.(*mom.Macro); ok {
 				switch m.Name {
 				case "DOCTITLE":
 					sc.Tokens = append(sc.Tokens, m)
@@ -50,7 +52,7 @@ func catCmd(cmd *Command, args []string) error {
 
 		last := sc.Tokens[len(sc.Tokens)-1]
 
-		if m, ok := last.(*Macro); ok {
+		if m, ok := last.(*mom.Macro); ok {
 			// Remove trailing COLLATE macro to prevent superfluous newlines
 			// from being printed.
 			if m.Name == "COLLATE" {
@@ -62,7 +64,7 @@ func catCmd(cmd *Command, args []string) error {
 	tok := sc.Next()
 
 	for tok != nil {
-		if m, ok := tok.(*Macro); ok {
+		if m, ok := tok.(*mom.Macro); ok {
 			switch m.Name {
 			case "DOCTITLE":
 				title := m.Arg(0)
@@ -74,7 +76,7 @@ func catCmd(cmd *Command, args []string) error {
 					if tok == nil {
 						return nil
 					}
-					if m, ok := tok.(*Macro); ok && m.Name == "AUTHOR" {
+					if m, ok := tok.(*mom.Macro); ok && m.Name == "AUTHOR" {
 						author = m.Arg(0)
 						break
 					}
@@ -87,7 +89,7 @@ func catCmd(cmd *Command, args []string) error {
 				chapterStr := "CHAPTER"
 
 				if tok := sc.Peek(); tok != nil {
-					if m, ok := tok.(*Macro); ok && m.Name == "CHAPTER_STRING" {
+					if m, ok := tok.(*mom.Macro); ok && m.Name == "CHAPTER_STRING" {
 						chapterStr = m.Arg(0)
 						sc.Next()
 					}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"book/mom"
+)
+
+var ConsistencyCmd = &Command{
+	Usage: "consistency <-style file> <-distance n> <-d dict> <file...>",
+	Short: "find words spelled more than one way",
+	Long: `Find the words in the prose of the given manuscripts that are spelled more than
+one way. Words are clustered together when they only differ by hyphenation,
+apostrophes, full stops, or capitalization, such as to-day and today, or Mr and
+Mr. Proper nouns are also clustered when they are within an edit distance of
+each other, such as Bistriz and Bistritz. Each cluster is printed with the
+number of times each form occurs, per chapter,
+
+    file: Bistritz, Bistriz
+        Bistritz  12  CHAPTER I: 10, CHAPTER II: 2
+        Bistriz    1  CHAPTER I: 1
+
+The -distance flag sets the edit distance within which proper nouns are
+clustered, by default this is 1. Proper nouns are words that are always
+capitalized, and are at least 4 letters long. The rarer of the two must occur
+at most a third as often as the other, so two names that are both common are
+not clustered.
+
+The -d flag specifies a Hunspell dictionary, as for the spell command, by
+default this is the value of the DICTIONARY environment variable. Proper nouns
+that are words in the dictionary are never clustered by edit distance. Without
+a dictionary, words that are always capitalized, such as Count, may be
+clustered with a rare word, such as Court.
+
+The -style flag specifies the house style file of preferred forms, by default
+this is the book.style file next to each manuscript. Each line of the file is a
+preferred form, optionally followed by a colon and a comma separated list of
+variants that would not otherwise be clustered with it,
+
+    # The house style.
+    today
+    Bistritz
+    grey: gray
+
+Any other form of a preferred form is printed as a problem, instead of as part
+of a cluster,
+
+    file:line: to-day (chapter): use today
+`,
+	Run: consistencyCmd,
+}
+
+var ErrConsistency = errors.New("house style problems found")
+
+// Term is a single form of a word within a manuscript. The form of a term
+// ignores the case of its first letter, since any word may be capitalized at
+// the start of a sentence.
+type Term struct {
+	Form     string
+	Count    int
+	Lines    []int
+	Chapters map[*mom.Chapter]int
+
+	// spellings is the number of times each spelling of the form occurs, so
+	// the most common can be used for display.
+	spellings map[string]int
+	proper    bool
+	known     bool // known is whether the term is a word of the dictionary.
+}
+
+// Spelling returns the most common spelling of the term in the manuscript.
+func (t *Term) Spelling() string {
+	spelling := t.Form
+	n := 0
+
+	for s, count := range t.spellings {
+		if count > n || (count == n && s < spelling) {
+			spelling = s
+			n = count
+		}
+	}
+	return spelling
+}
+
+// TermCluster is a group of terms that are different forms of the same word.
+type TermCluster struct {
+	Terms []*Term
+}
+
+// foldTerm returns the form of the given word, with the first letter in
+// lowercase.
+func foldTerm(word string) string {
+	r, n := utf8.DecodeRuneInString(word)
+	return string(unicode.ToLower(r)) + word[n:]
+}
+
+// normalizeTerm returns the given word in lowercase, with hyphens,
+// apostrophes, and full stops removed.
+func normalizeTerm(word string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '\'', apostrophe, '.':
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, word)
+}
+
+// EditDistance returns the Levenshtein distance between the two strings.
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// abbreviation returns whether the given word is an abbreviated title such as
+// Mr, Mrs, or Dr, that is a short capitalized word without vowels.
+func abbreviation(word []rune) bool {
+	if len(word) < 2 || len(word) > 3 || !unicode.IsUpper(word[0]) {
+		return false
+	}
+	return !strings.ContainsAny(strings.ToLower(string(word)), "aeiouy")
+}
+
+// TermWords returns the words of the given line of text as terms. Hyphens and
+// apostrophes within a word are kept, as is the full stop of an abbreviated
+// title such as Mr. or Dr. that is followed by a name. The possessive of a word
+// is removed, and words containing digits, or in uppercase are not returned,
+// since the capitalization of the latter is typographic.
+func TermWords(s string) []string {
+	words := make([]string, 0)
+
+	for _, word := range splitWords(s, func(runes []rune, i int, word []rune) bool {
+		switch runes[i] {
+		case '-', '\'', apostrophe:
+			return between(runes, i)
+		case '.':
+			return abbreviation(word) && i+2 < len(runes) && runes[i+1] == ' ' && unicode.IsUpper(runes[i+2])
+		}
+		return false
+	}) {
+		if strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+			continue
+		}
+
+		if utf8.RuneCountInString(word) > 1 && word == strings.ToUpper(word) {
+			continue
+		}
+		words = append(words, strings.TrimSuffix(strings.TrimSuffix(word, "’s"), "'s"))
+	}
+	return words
+}
+
+// Terms returns the terms within the prose of the manuscript, in the order in
+// which they first occur. The occurrences of each term are counted against the
+// given chapters of the manuscript.
+func Terms(ms *mom.Manuscript, chapters []*mom.Chapter) []*Term {
+	tokch := make(map[mom.Token]*mom.Chapter)
+
+	for _, ch := range chapters {
+		for _, tok := range ch.Tokens {
+			tokch[tok] = ch
+		}
+	}
+
+	terms := make([]*Term, 0)
+	forms := make(map[string]*Term)
+
+	for _, txt := range typoLines(ms) {
+		for _, word := range TermWords(txt.Value) {
+			form := foldTerm(word)
+
+			t, ok := forms[form]
+
+			if !ok {
+				t = &Term{
+					Form:      form,
+					Chapters:  make(map[*mom.Chapter]int),
+					spellings: make(map[string]int),
+					proper:    true,
+				}
+
+				forms[form] = t
+				terms = append(terms, t)
+			}
+
+			t.Count++
+			t.Lines = append(t.Lines, ms.Line(txt))
+			t.spellings[word]++
+
+			if r, _ := utf8.DecodeRuneInString(word); !unicode.IsUpper(r) {
+				t.proper = false
+			}
+
+			if ch, ok := tokch[txt]; ok {
+				t.Chapters[ch]++
+			}
+		}
+	}
+	return terms
+}
+
+// rareTerm is how many times more often the common form of a proper noun
+// must occur than a misspelling of it.
+const rareTerm = 3
+
+// similarTerms returns whether the two terms are different forms of the same
+// word, either because they normalize to the same word, or because they are
+// proper nouns within the given edit distance, one of which is rare compared
+// to the other.
+func similarTerms(a, b *Term, distance int) bool {
+	na, nb := normalizeTerm(a.Form), normalizeTerm(b.Form)
+
+	if na == nb {
+		return true
+	}
+
+	if !a.proper || !b.proper || distance <= 0 {
+		return false
+	}
+
+	// Words of the dictionary are words in their own right, rather than a
+	// misspelling of a name.
+	if a.known || b.known {
+		return false
+	}
+
+	if min(a.Count, b.Count)*rareTerm > max(a.Count, b.Count) {
+		return false
+	}
+
+	la, lb := utf8.RuneCountInString(na), utf8.RuneCountInString(nb)
+
+	if la < 4 || lb < 4 || max(la-lb, lb-la) > distance {
+		return false
+	}
+
+	// A name that is the start of another is most likely a different form of
+	// it, such as German and Germany, or a plural, rather than a misspelling.
+	if strings.HasPrefix(na, nb) || strings.HasPrefix(nb, na) {
+		return false
+	}
+
+	// Names that differ in their first letter are most likely different
+	// names, such as Mina and Nina.
+	if ra, _ := utf8.DecodeRuneInString(na); !strings.HasPrefix(nb, string(ra)) {
+		return false
+	}
+	return EditDistance(na, nb) <= distance
+}
+
+// ClusterTerms groups the terms that are different forms of the same word.
+// Only groups of more than one form are returned, ordered by the total number
+// of times they occur.
+func ClusterTerms(terms []*Term, distance int) []*TermCluster {
+	parent := make([]int, len(terms))
+
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(int) int
+
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// Terms that normalize to the same word are clustered directly, leaving
+	// only proper nouns to be compared with each other.
+	keys := make(map[string]int)
+	proper := make([]int, 0)
+
+	for i, t := range terms {
+		key := normalizeTerm(t.Form)
+
+		if j, ok := keys[key]; ok {
+			parent[find(i)] = find(j)
+		} else {
+			keys[key] = i
+		}
+
+		if t.proper {
+			proper = append(proper, i)
+		}
+	}
+
+	for x, i := range proper {
+		for _, j := range proper[x+1:] {
+			if find(i) != find(j) && similarTerms(terms[i], terms[j], distance) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int]*TermCluster)
+	clusters := make([]*TermCluster, 0)
+
+	for i, t := range terms {
+		root := find(i)
+
+		c, ok := groups[root]
+
+		if !ok {
+			c = &TermCluster{}
+			groups[root] = c
+			clusters = append(clusters, c)
+		}
+		c.Terms = append(c.Terms, t)
+	}
+
+	n := 0
+
+	for _, c := range clusters {
+		if len(c.Terms) < 2 {
+			continue
+		}
+
+		sort.SliceStable(c.Terms, func(i, j int) bool {
+			return c.Terms[i].Count > c.Terms[j].Count
+		})
+
+		clusters[n] = c
+		n++
+	}
+
+	clusters = clusters[:n]
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].Count() > clusters[j].Count()
+	})
+	return clusters
+}
+
+// Count returns the total number of times the terms of the cluster occur.
+func (c *TermCluster) Count() int {
+	n := 0
+
+	for _, t := range c.Terms {
+		n += t.Count
+	}
+	return n
+}
+
+// HouseStyle is the set of preferred forms of words, along with any variants
+// of them.
+type HouseStyle struct {
+	Preferred []string
+	Variants  map[string][]string
+}
+
+// LoadHouseStyle loads the house style file. A missing file is not an error,
+// and returns an empty house style.
+func LoadHouseStyle(file string) (*HouseStyle, error) {
+	hs := &HouseStyle{
+		Variants: make(map[string][]string),
+	}
+
+	f, err := os.Open(file)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return hs, nil
+		}
+		return nil, err
+	}
+
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+
+	n := 0
+
+	for sc.Scan() {
+		n++
+
+		line := strings.TrimSpace(sc.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		form, variants, _ := strings.Cut(line, ":")
+		form = strings.TrimSpace(form)
+
+		if form == "" {
+			return nil, fmt.Errorf("%s:%d: no preferred form", file, n)
+		}
+
+		hs.Preferred = append(hs.Preferred, form)
+
+		for _, v := range strings.Split(variants, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				hs.Variants[form] = append(hs.Variants[form], foldTerm(v))
+			}
+		}
+	}
+	return hs, sc.Err()
+}
+
+// Prefer returns the preferred form of the given term, if the term is a variant
+// of one.
+func (hs *HouseStyle) Prefer(t *Term, distance int) (string, bool) {
+	for _, form := range hs.Preferred {
+		if foldTerm(form) == t.Form {
+			return "", false
+		}
+	}
+
+	for _, form := range hs.Preferred {
+		for _, v := range hs.Variants[form] {
+			if v == t.Form {
+				return form, true
+			}
+		}
+
+		r, _ := utf8.DecodeRuneInString(form)
+
+		pref := &Term{
+			Form:   foldTerm(form),
+			proper: unicode.IsUpper(r),
+		}
+
+		if similarTerms(pref, t, distance) {
+			return form, true
+		}
+	}
+	return "", false
+}
+
+// termChapters returns the number of times the term occurs in each chapter,
+// in order.
+func termChapters(t *Term, chapters []*mom.Chapter) string {
+	counts := make([]string, 0, len(t.Chapters))
+
+	for _, ch := range chapters {
+		n, ok := t.Chapters[ch]
+
+		if !ok {
+			continue
+		}
+
+		counts = append(counts, ch.Name()+": "+strconv.Itoa(n))
+	}
+	return strings.Join(counts, ", ")
+}
+
+func consistencyCmd(cmd *Command, args []string) error {
+	var (
+		style    string
+		distance int
+		dict     string
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.StringVar(&style, "style", "", "the house style file of preferred forms")
+	fs.IntVar(&distance, "distance", 1, "the edit distance to cluster proper nouns within")
+	fs.StringVar(&dict, "d", os.Getenv("DICTIONARY"), "the dictionary of words that are not names")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	var d *Dictionary
+
+	if dict != "" {
+		path, err := FindDictionary(dict)
+
+		if err != nil {
+			return err
+		}
+
+		d, err = LoadDictionary(path)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	n := 0
+
+	for _, file := range args {
+		path := style
+
+		if path == "" {
+			path = filepath.Join(filepath.Dir(file), "book.style")
+		}
+
+		hs, err := LoadHouseStyle(path)
+
+		if err != nil {
+			return err
+		}
+
+		ms, err := mom.ParseManuscript(file)
+
+		if err != nil {
+			return err
+		}
+
+		chapters, err := ms.Chapters()
+
+		if err != nil {
+			return err
+		}
+
+		terms := Terms(ms, chapters)
+
+		if d != nil {
+			for _, t := range terms {
+				t.known = d.Check(t.Form)
+			}
+		}
+
+		linech := make(map[int]string)
+
+		for _, ch := range chapters {
+			for _, tok := range ch.Tokens {
+				linech[ms.Line(tok)] = ch.Name()
+			}
+		}
+
+		// Terms with a preferred form are problems, so are not clustered.
+		clustered := make([]*Term, 0, len(terms))
+
+		for _, t := range terms {
+			form, ok := hs.Prefer(t, distance)
+
+			if !ok {
+				clustered = append(clustered, t)
+				continue
+			}
+
+			for _, line := range t.Lines {
+				s := fmt.Sprintf("%s:%d: %s", file, line, t.Spelling())
+
+				if name := linech[line]; name != "" {
+					s += " (" + name + ")"
+				}
+
+				cmd.Println(s + ": use " + form)
+				n++
+			}
+		}
+
+		for _, c := range ClusterTerms(clustered, distance) {
+			spellings := make([]string, 0, len(c.Terms))
+
+			width := 0
+
+			for _, t := range c.Terms {
+				spellings = append(spellings, t.Spelling())
+				width = max(width, utf8.RuneCountInString(t.Spelling()))
+			}
+
+			cmd.Printf("%s: %s\n", file, strings.Join(spellings, ", "))
+
+			digits := len(strconv.Itoa(c.Terms[0].Count))
+
+			for _, t := range c.Terms {
+				s := t.Spelling()
+
+				cmd.Printf("    %s%s  %*d", s, strings.Repeat(" ", width-utf8.RuneCountInString(s)), digits, t.Count)
+
+				if counts := termChapters(t, chapters); counts != "" {
+					cmd.Printf("  %s", counts)
+				}
+				cmd.Println()
+			}
+		}
+	}
+
+	if n > 0 {
+		return fmt.Errorf("%w: %d problem(s)", ErrConsistency, n)
+	}
+	return nil
+}
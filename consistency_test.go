@@ -0,0 +1,170 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTermWords(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"So long to-day, Mr. Harker.", []string{"So", "long", "to-day", "Mr.", "Harker"}},
+		{"Mr Harker’s \\*[IT]diary\\*[PREV] of 3 May.", []string{"Mr", "Harker", "diary", "of", "May"}},
+		{"THE COUNT left on the 1st.", []string{"left", "on", "the"}},
+		{"“Bistriz,” he said—‘to-morrow.’", []string{"Bistriz", "he", "said", "to-morrow"}},
+	}
+
+	for _, test := range tests {
+		if diff := cmp.Diff(test.want, TermWords(test.s)); diff != "" {
+			t.Errorf("TermWords(%q) mismatch (-want +got):\n%s", test.s, diff)
+		}
+	}
+}
+
+func TestLoadHouseStyle(t *testing.T) {
+	tests := []struct {
+		file string
+		want *HouseStyle
+		err  string
+	}{
+		{
+			"house.style",
+			&HouseStyle{
+				Preferred: []string{"today", "grey"},
+				Variants:  map[string][]string{"grey": {"gray", "gray"}},
+			},
+			"",
+		},
+		{
+			"missing.style",
+			&HouseStyle{
+				Variants: map[string][]string{},
+			},
+			"",
+		},
+		{"preferred.style", nil, ":2: no preferred form"},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join("testdata", "consistency", test.file)
+
+		hs, err := LoadHouseStyle(file)
+
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("LoadHouseStyle(%q) = %v, want error containing %q", file, err, test.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("LoadHouseStyle(%q): %v\n", file, err)
+		}
+
+		if diff := cmp.Diff(test.want, hs); diff != "" {
+			t.Errorf("LoadHouseStyle(%q) mismatch (-want +got):\n%s", file, diff)
+		}
+	}
+}
+
+func TestConsistencyCmd(t *testing.T) {
+	dir := filepath.Join("testdata", "consistency")
+	file := filepath.Join(dir, "consistency.mom")
+	names := filepath.Join(dir, "names.mom")
+
+	// The variants found without a house style, and so without any of the
+	// preferred forms.
+	variants := []string{
+		file + ": Bistritz, Bistriz",
+		"    Bistritz  3  BISTRITZ: 2, BUDA-PESTH: 1",
+		"    Bistriz   1  BISTRITZ: 1",
+		file + ": To-day, today",
+		"    To-day  1  BISTRITZ: 1",
+		"    today   1  BISTRITZ: 1",
+		file + ": Mr., Mr",
+		"    Mr.  1  BISTRITZ: 1",
+		"    Mr   1  BISTRITZ: 1",
+		file + ": Buda-Pesth, Buda-pesth",
+		"    Buda-Pesth  1  BUDA-PESTH: 1",
+		"    Buda-pesth  1  BUDA-PESTH: 1",
+		"",
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+		err  string
+	}{
+		{
+			[]string{"-style", filepath.Join(dir, "missing.style"), file},
+			variants,
+			"",
+		},
+		{
+			// The book.style next to the manuscript is used by default.
+			[]string{file},
+			[]string{
+				file + ":5: To-day (BISTRITZ): use today",
+				file + ":13: Buda-pesth (BUDA-PESTH): use Buda-Pesth",
+				file + ":13: gray (BUDA-PESTH): use grey",
+				variants[0],
+				variants[1],
+				variants[2],
+				variants[6],
+				variants[7],
+				variants[8],
+				"",
+			},
+			ErrConsistency.Error(),
+		},
+		{
+			// Names that are both common, or words of the dictionary, are
+			// not clustered.
+			[]string{names},
+			[]string{
+				names + ": Door, Dorr",
+				"    Door  3",
+				"    Dorr  1",
+				"",
+			},
+			"",
+		},
+		{
+			[]string{"-d", filepath.Join("testdata", "en_TEST"), names},
+			[]string{""},
+			"",
+		},
+		{[]string{"-style", filepath.Join(dir, "preferred.style"), file}, nil, ":2: no preferred form"},
+		{[]string{"-d", "en_MISSING", file}, nil, ErrDictionary.Error()},
+		{[]string{}, nil, ErrUsage.Error()},
+	}
+
+	t.Setenv("DICTIONARY", "")
+
+	for _, test := range tests {
+		buf := CaptureOutput(ConsistencyCmd)
+
+		err := consistencyCmd(ConsistencyCmd, test.args)
+
+		if test.err == "" && err != nil {
+			t.Fatalf("consistencyCmd(ConsistencyCmd, %v): %v\n", test.args, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Fatalf("consistencyCmd(ConsistencyCmd, %v) = %v, want error containing %q", test.args, err, test.err)
+		}
+
+		if test.want == nil {
+			continue
+		}
+
+		if diff := cmp.Diff(strings.Join(test.want, "\n"), buf.String()); diff != "" {
+			t.Errorf("consistencyCmd(ConsistencyCmd, %v) mismatch (-want +got):\n%s", test.args, diff)
+		}
+	}
+}
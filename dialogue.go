@@ -0,0 +1,533 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"book/mom"
+)
+
+var DialogueCmd = &Command{
+	Usage: "dialogue <-cast file> <-chapter chapter> <file>",
+	Short: "show who speaks in a manuscript and how much",
+	Long: `Show who speaks in the given manuscript, and how much. Each quoted utterance in
+the paragraphs of the manuscript is attributed to a character of the cast file,
+as used by the cast command, and the number of lines and words spoken by each
+character is printed.
+
+The cast file is the book.cast file next to the manuscript, unless given via
+the -cast flag. Narrators written in the first person can be given I as an
+alias.
+
+Utterances are attributed via the tags next to them, such as said Harker or
+Harker asked. A tag such as he said is attributed to the character last named
+in the narration of the chapter, other than the narrator. An utterance without
+a tag is attributed to the speaker of the other utterances of its paragraph,
+or, for a paragraph of only dialogue, to the speaker of the paragraph before
+last when two characters are taking turns. Utterances that cannot be
+attributed are counted as Unknown. Quotations that are part of the narration,
+such as a word in quotes, are not utterances.
+
+The -chapter flag prints a transcript of the dialogue of the given chapter
+instead, in the style of a script. The chapter can be given by its number or
+its title, the same as for the cat command.
+`,
+	Run: dialogueCmd,
+}
+
+// speechVerbs are the verbs used in dialogue tags.
+var speechVerbs = map[string]struct{}{
+	"added":       {},
+	"answered":    {},
+	"asked":       {},
+	"asks":        {},
+	"began":       {},
+	"called":      {},
+	"continued":   {},
+	"cried":       {},
+	"demanded":    {},
+	"enquired":    {},
+	"exclaimed":   {},
+	"inquired":    {},
+	"interrupted": {},
+	"muttered":    {},
+	"murmured":    {},
+	"replied":     {},
+	"repeated":    {},
+	"said":        {},
+	"says":        {},
+	"shouted":     {},
+	"whispered":   {},
+}
+
+// Utterance is a single quoted utterance of dialogue within a manuscript.
+type Utterance struct {
+	Speaker *Character
+	Chapter *mom.Chapter
+	Line    int
+	Text    string
+
+	// para is the index of the paragraph of the utterance.
+	para int
+}
+
+// Words returns the number of words in the utterance.
+func (u *Utterance) Words() int {
+	return len((&mom.Text{Value: u.Text}).Words())
+}
+
+// speech returns whether the quotation at the given span of the text is an
+// utterance. A quotation is an utterance if it ends with punctuation, or
+// follows punctuation or the start of the paragraph, unlike a word in quotes.
+func speech(s string, span [2]int) bool {
+	inner := quotation(s[span[0]:span[1]])
+
+	if inner == "" {
+		return false
+	}
+
+	if r, _ := utf8.DecodeLastRuneInString(inner); strings.ContainsRune(".,!?—–…:;-", r) {
+		return true
+	}
+
+	before := strings.TrimRightFunc(s[:span[0]], unicode.IsSpace)
+
+	if before == "" {
+		return true
+	}
+
+	r, _ := utf8.DecodeLastRuneInString(before)
+	return strings.ContainsRune(".,!?—–…:;(", r)
+}
+
+// quotation returns the text within the given quotation, without its quotes.
+func quotation(s string) string {
+	_, n := utf8.DecodeRuneInString(s)
+	s = s[n:]
+
+	if r, n := utf8.DecodeLastRuneInString(s); strings.ContainsRune(`”“’'"`, r) {
+		s = s[:len(s)-n]
+	}
+	return strings.TrimSpace(s)
+}
+
+// tagWords is the number of words from an utterance within which the speech
+// verb of its tag must be.
+const tagWords = 3
+
+// tagSpeaker returns the character named next to a speech verb within the
+// given dialogue tag, such as said Harker, or Harker asked. The tag is either
+// after the utterance, or before it, and the speech verb must be next to the
+// utterance. A tag such as he said is attributed to the given antecedent of the
+// pronoun, if any. Whether the tag has a speech verb is also returned, since a
+// tag such as she said may name a speaker that is not known.
+func tagSpeaker(cast Cast, tag string, after bool, antecedent *Character) (*Character, bool) {
+	// The offsets of each word within the tag, and of each speech verb.
+	words := make([][2]int, 0)
+	verbs := make([]int, 0)
+
+	start := -1
+
+	for i, r := range tag + " " {
+		if wordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		if start >= 0 {
+			if _, ok := speechVerbs[strings.ToLower(tag[start:i])]; ok {
+				verbs = append(verbs, len(words))
+			}
+			words = append(words, [2]int{start, i})
+		}
+		start = -1
+	}
+
+	// wordAt returns the index of the word at the given offset.
+	wordAt := func(off int) int {
+		return sort.Search(len(words), func(i int) bool {
+			return words[i][1] > off
+		})
+	}
+
+	tagged := false
+
+	var speaker *Character
+
+	for _, v := range verbs {
+		if (after && v >= tagWords) || (!after && v < len(words)-tagWords) {
+			continue
+		}
+
+		tagged = true
+
+		for _, i := range []int{v - 1, v + 1} {
+			if i < 0 || i >= len(words) {
+				continue
+			}
+
+			switch strings.ToLower(tag[words[i][0]:words[i][1]]) {
+			case "he", "she":
+				speaker = antecedent
+			}
+		}
+	}
+
+	best := -1
+
+	for _, m := range cast.Mentions(tag) {
+		first := wordAt(m.Start)
+		last := wordAt(m.End - 1)
+
+		for _, v := range verbs {
+			if (after && v >= tagWords) || (!after && v < len(words)-tagWords) {
+				continue
+			}
+
+			// The number of words between the name and the verb, allowing for
+			// a title, as in said Mr. Harker.
+			dist := first - v - 1
+
+			if v > last {
+				dist = v - last - 1
+			}
+
+			if dist < 0 || dist > 1 {
+				continue
+			}
+
+			if best < 0 || dist < best {
+				speaker = m.Character
+				best = dist
+			}
+		}
+	}
+	return speaker, tagged
+}
+
+// antecedent returns the character last named within the given narration, to
+// whom a pronoun such as he or she would refer. The narrator, as in I, is
+// never the antecedent.
+func antecedent(cast Cast, narration string) *Character {
+	mentions := cast.Mentions(narration)
+
+	for i := len(mentions) - 1; i >= 0; i-- {
+		m := mentions[i]
+
+		if name := narration[m.Start:m.End]; name != "I" && name != "me" {
+			return m.Character
+		}
+	}
+	return nil
+}
+
+// Dialogue returns the utterances within the given paragraphs of the
+// manuscript, attributed to the characters of the cast where possible.
+func Dialogue(ms *mom.Manuscript, cast Cast, paras []*mom.Paragraph) []*Utterance {
+	utterances := make([]*Utterance, 0)
+
+	// The speakers of the last two paragraphs, if those were only dialogue,
+	// so characters taking turns can be followed.
+	turns := [2]*Character{}
+
+	// The speaker introduced at the end of the last paragraph, as in he
+	// answered:—, for dialogue starting the next paragraph.
+	var (
+		intro  *Character
+		intros bool
+	)
+
+	// The character last named in the narration of the chapter so far, to
+	// whom a pronoun refers when its own paragraph names no one.
+	var (
+		named   *Character
+		chapter *mom.Chapter
+	)
+
+	for i, p := range paras {
+		if p.Chapter != chapter {
+			named = nil
+			chapter = p.Chapter
+		}
+
+		// antecedentOf returns the antecedent of a pronoun within the given
+		// narration of the paragraph, falling back to the character last named
+		// before it.
+		antecedentOf := func(narration ...string) *Character {
+			if ch := antecedent(cast, strings.Join(narration, " ")); ch != nil {
+				return ch
+			}
+			return named
+		}
+
+		spans := make([][2]int, 0)
+
+		for _, span := range DialogueSpans(p.Text) {
+			if speech(p.Text, span) {
+				spans = append(spans, span)
+			}
+		}
+
+		// The narration before each utterance, and after the last.
+		narration := make([]string, 0, len(spans)+1)
+
+		prev := 0
+
+		for _, span := range spans {
+			narration = append(narration, p.Text[prev:span[0]])
+			prev = span[1]
+		}
+		narration = append(narration, p.Text[prev:])
+
+		last := antecedentOf(narration...)
+
+		introduced, introducedTag := intro, intros
+
+		intro = nil
+		intros = false
+
+		if text := strings.TrimRightFunc(p.Text, unicode.IsSpace); strings.HasSuffix(text, ":") || strings.HasSuffix(text, ":—") {
+			if sentences := SentenceSpans(text); len(sentences) > 0 {
+				end := sentences[len(sentences)-1]
+				intro, intros = tagSpeaker(cast, text[end[0]:end[1]], false, last)
+			}
+		}
+
+		if len(spans) == 0 {
+			named = last
+			turns = [2]*Character{}
+			continue
+		}
+
+		parts := paragraphParts(ms, p)
+
+		para := make([]*Utterance, 0, len(spans))
+
+		// Whether any utterance has a tag naming a speaker not in the cast,
+		// such as she said.
+		others := false
+
+		for j, span := range spans {
+			u := &Utterance{
+				Chapter: p.Chapter,
+				Text:    quotation(p.Text[span[0]:span[1]]),
+				para:    i,
+			}
+
+			k := sort.Search(len(parts), func(k int) bool {
+				return parts[k].pos > span[0]
+			}) - 1
+
+			if k >= 0 {
+				u.Line = parts[k].line
+			}
+
+			before := narration[j]
+			after := narration[j+1]
+
+			ante := antecedentOf(narration[:j+1]...)
+
+			// The tag is the first sentence of the narration after the
+			// utterance, or failing that the last sentence of the narration
+			// before it. An utterance ending in a full stop has no tag after
+			// it, as in “Yes.” I said I would.
+			tagged := false
+
+			if spans := SentenceSpans(after); !strings.HasSuffix(u.Text, ".") && len(spans) > 0 {
+				u.Speaker, tagged = tagSpeaker(cast, after[spans[0][0]:spans[0][1]], true, ante)
+			}
+
+			if spans := SentenceSpans(before); !tagged && len(spans) > 0 {
+				last := spans[len(spans)-1]
+				u.Speaker, tagged = tagSpeaker(cast, before[last[0]:last[1]], false, ante)
+			}
+
+			if !tagged && j == 0 && strings.TrimSpace(before) == "" {
+				u.Speaker, tagged = introduced, introducedTag
+			}
+
+			if tagged && u.Speaker == nil {
+				others = true
+			}
+
+			para = append(para, u)
+		}
+
+		// Utterances without a tag are spoken by the speaker of the rest of
+		// the paragraph, if there is only one.
+		var speaker *Character
+
+		for _, u := range para {
+			if others || u.Speaker == nil {
+				continue
+			}
+
+			if speaker != nil && speaker != u.Speaker {
+				speaker = nil
+				break
+			}
+			speaker = u.Speaker
+		}
+
+		// A paragraph of only dialogue without a speaker is the next turn
+		// of the two characters speaking in the paragraphs before it.
+		only := len((&mom.Text{Value: strings.Join(narration, " ")}).Words()) == 0
+
+		if speaker == nil && !others && only && turns[0] != nil && turns[1] != nil && turns[0] != turns[1] {
+			speaker = turns[0]
+		}
+
+		for _, u := range para {
+			if u.Speaker == nil {
+				u.Speaker = speaker
+			}
+		}
+
+		named = last
+		turns = [2]*Character{turns[1], speaker}
+
+		utterances = append(utterances, para...)
+	}
+	return utterances
+}
+
+// speakerName returns the name of the speaker of the utterance.
+func speakerName(u *Utterance) string {
+	if u.Speaker == nil {
+		return "Unknown"
+	}
+	return u.Speaker.Name
+}
+
+func dialogueCmd(cmd *Command, args []string) error {
+	var (
+		castfile string
+		chapter  string
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.StringVar(&castfile, "cast", "", "the cast file of characters and their aliases")
+	fs.StringVar(&chapter, "chapter", "", "the chapter to print a transcript of")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) != 1 {
+		return ErrUsage
+	}
+
+	file := args[0]
+
+	if castfile == "" {
+		castfile = filepath.Join(filepath.Dir(file), "book.cast")
+	}
+
+	cast, err := LoadCast(castfile)
+
+	if err != nil {
+		return err
+	}
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		return err
+	}
+
+	cps, paras, err := paragraphsByChapter(ms)
+
+	if err != nil {
+		return err
+	}
+
+	if chapter != "" {
+		if len(cps) == 0 {
+			return ErrNoChapters
+		}
+
+		chapters, err := ms.Chapters(chapter)
+
+		if err != nil {
+			return err
+		}
+
+		if len(chapters) == 0 {
+			return ChapterNotFoundError(chapter)
+		}
+
+		set := make(map[int]struct{})
+
+		for _, ch := range chapters {
+			set[ch.Count] = struct{}{}
+		}
+
+		utterances := make([]*Utterance, 0)
+
+		for _, cp := range cps {
+			if _, ok := set[cp.chapter.Count]; ok {
+				utterances = append(utterances, Dialogue(ms, cast, cp.paras)...)
+			}
+		}
+
+		var last *Utterance
+
+		for _, u := range utterances {
+			// Utterances of the same speaker within a paragraph are a single
+			// line of the transcript.
+			if last != nil && last.para == u.para && last.Speaker == u.Speaker {
+				cmd.Print(" " + u.Text)
+				continue
+			}
+
+			if last != nil {
+				cmd.Println()
+			}
+
+			cmd.Print(strings.ToUpper(speakerName(u)) + ": " + u.Text)
+			last = u
+		}
+
+		if last != nil {
+			cmd.Println()
+		}
+		return nil
+	}
+
+	lines := make(map[*Character]int)
+	words := make(map[*Character]int)
+
+	for _, u := range Dialogue(ms, cast, paras) {
+		lines[u.Speaker]++
+		words[u.Speaker] += u.Words()
+	}
+
+	rows := make([]statsRow, 0, len(cast)+1)
+
+	speakers := append(Cast{}, cast...)
+
+	if lines[nil] > 0 {
+		speakers = append(speakers, nil)
+	}
+
+	for _, c := range speakers {
+		name := "Unknown"
+
+		if c != nil {
+			name = c.Name
+		}
+
+		rows = append(rows, statsRow{
+			label: name,
+			cols:  []string{formatNumber(lines[c]), formatNumber(words[c])},
+		})
+	}
+
+	printStats(cmd, []string{"Lines", "Words"}, rows)
+	return nil
+}
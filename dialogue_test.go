@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDialogueCmd(t *testing.T) {
+	dir := filepath.Join("testdata", "dialogue")
+	file := filepath.Join(dir, "dialogue.mom")
+
+	tests := []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{
+			[]string{file},
+			[]string{
+				"                 Lines  Words",
+				"Jonathan Harker      3      9",
+				"Mina                 4     10",
+				"Count Dracula        1      3",
+				"Unknown              2      4",
+				"",
+			},
+			nil,
+		},
+		{
+			[]string{"-chapter", "1", file},
+			[]string{
+				"JONATHAN HARKER: Good evening,",
+				"MINA: You are late, Again.",
+				"JONATHAN HARKER: The train was slow.",
+				"MINA: It always is.",
+				"COUNT DRACULA: Am I late?",
+				"JONATHAN HARKER: Who are you?",
+				"UNKNOWN: Hush,",
+				"MINA: Come to bed,",
+				"",
+			},
+			nil,
+		},
+		{
+			[]string{"-chapter", "I", file},
+			[]string{
+				"JONATHAN HARKER: Good evening,",
+				"MINA: You are late, Again.",
+				"JONATHAN HARKER: The train was slow.",
+				"MINA: It always is.",
+				"COUNT DRACULA: Am I late?",
+				"JONATHAN HARKER: Who are you?",
+				"UNKNOWN: Hush,",
+				"MINA: Come to bed,",
+				"",
+			},
+			nil,
+		},
+		{[]string{"-chapter", "IX", file}, nil, ChapterNotFoundError("IX")},
+		{[]string{"-chapter", "1", "-cast", filepath.Join(dir, "book.cast"), filepath.Join("testdata", "no-chapters.mom")}, nil, ErrNoChapters},
+		{[]string{"-cast", filepath.Join("testdata", "cast", "empty.cast"), file}, nil, ErrCastEmpty},
+		{[]string{}, nil, ErrUsage},
+	}
+
+	for _, test := range tests {
+		buf := CaptureOutput(DialogueCmd)
+
+		if err := dialogueCmd(DialogueCmd, test.args); !errors.Is(err, test.err) {
+			t.Fatalf("dialogueCmd(DialogueCmd, %v) = %v, want = %v", test.args, err, test.err)
+		}
+
+		if test.err != nil {
+			continue
+		}
+
+		if diff := cmp.Diff(strings.Join(test.want, "\n"), buf.String()); diff != "" {
+			t.Errorf("dialogueCmd(DialogueCmd, %v) mismatch (-want +got):\n%s", test.args, diff)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"book/mom"
+)
+
+var EchoesCmd = &Command{
+	Usage: "echoes <-window n> <-phrase min:max> <-count n> <-top n> <file>",
+	Short: "find overused words and repeated phrases",
+	Long: `Find the echoes in the prose of the given manuscript, these being,
+
+    words   - the same uncommon word used again within a few sentences
+    phrases - the same phrase of a few words used throughout the manuscript
+    openers - consecutive sentences that start with the same word
+
+Stop words, such as the and said, are never echoes, nor are words used more
+than once per thousand words of the manuscript, or proper nouns. Phrases made
+up only of stop words are also ignored.
+
+The -window flag is the number of words within which a word is an echo, by
+default this is 30. The -phrase flag is the range of the number of words in a
+phrase, by default this is 3:6. The -count flag is the number of times a phrase
+must be used to be reported, by default this is 3, and the -top flag is the
+number of phrases to report, ranked by how often they are used, by default this
+is 20. Sentences are reported when at least 3 in a row start with the same
+word.
+
+The location of each echo is its line, and chapter.
+`,
+	Run: echoesCmd,
+}
+
+// stopWords are the common words of English that are never echoes.
+var stopWords = map[string]struct{}{}
+
+func init() {
+	words := `a about above after again against all am an and any are as at be
+because been before being below between both but by could did do does doing
+down during each few for from further had has have having he her here hers
+herself him himself his how i if in into is it its itself just me more most my
+myself no nor not now of off on once only or other our ours ourselves out over
+own same she should so some such than that the their theirs them themselves
+then there these they this those through to too under until up upon very was
+we were what when where which while who whom why will with would you your
+yours yourself yourselves said says say one could can may might must shall
+upon us let like also yet still even though much many well back went go come
+came get got see saw seen know knew thought think made make`
+
+	for _, w := range strings.Fields(words) {
+		stopWords[w] = struct{}{}
+	}
+}
+
+// echoWord is a single word of the word stream of a manuscript.
+type echoWord struct {
+	word    string
+	lower   string
+	pos     int
+	line    int
+	chapter string
+
+	// seg is the run of text the word is in, that is the text between two
+	// macros, so phrases do not span paragraphs.
+	seg int
+}
+
+// echoWords returns the stream of words in the prose of the manuscript, as
+// returned by [mom.Text.Words].
+func echoWords(ms *mom.Manuscript, chapters []*mom.Chapter) []*echoWord {
+	tokch := make(map[mom.Token]*mom.Chapter)
+
+	for _, ch := range chapters {
+		for _, tok := range ch.Tokens {
+			tokch[tok] = ch
+		}
+	}
+
+	lines := make(map[*mom.Text]struct{})
+
+	for _, txt := range typoLines(ms) {
+		lines[txt] = struct{}{}
+	}
+
+	words := make([]*echoWord, 0)
+
+	seg := 0
+
+	for _, tok := range ms.Tokens {
+		switch v := tok.(type) {
+		case *mom.Macro:
+			seg++
+		case *mom.Text:
+			if _, ok := lines[v]; !ok {
+				continue
+			}
+
+			chapter := ""
+
+			if ch, ok := tokch[tok]; ok {
+				chapter = ch.Name()
+			}
+
+			for _, word := range v.Words() {
+				words = append(words, &echoWord{
+					word:    word,
+					lower:   strings.ToLower(word),
+					pos:     len(words),
+					line:    ms.Line(tok),
+					chapter: chapter,
+					seg:     seg,
+				})
+			}
+		}
+	}
+	return words
+}
+
+// location returns the location of the word as its chapter and line.
+func (w *echoWord) location() string {
+	if w.chapter == "" {
+		return strconv.Itoa(w.line)
+	}
+	return w.chapter + ":" + strconv.Itoa(w.line)
+}
+
+// WordEcho is an uncommon word used more than once within a window of words.
+type WordEcho struct {
+	Word  string
+	Count int
+	words []*echoWord
+}
+
+// Locations returns the chapter and line of each use of the word.
+func (e *WordEcho) Locations() []string {
+	locs := make([]string, 0, len(e.words))
+
+	for _, w := range e.words {
+		locs = append(locs, w.location())
+	}
+	return locs
+}
+
+// WordEchoes returns the uncommon words used again within the given window of
+// words of each other. A word that is used repeatedly, each within the window
+// of the last, is a single echo.
+func WordEchoes(words []*echoWord, window int) []*WordEcho {
+	counts := make(map[string]int)
+	lower := make(map[string]struct{})
+
+	for _, w := range words {
+		counts[w.lower]++
+
+		if w.word == w.lower {
+			lower[w.lower] = struct{}{}
+		}
+	}
+
+	common := max(5, len(words)/1000)
+
+	echoes := make([]*WordEcho, 0)
+
+	last := make(map[string]int)
+	open := make(map[string]*WordEcho)
+
+	for i, w := range words {
+		if _, ok := stopWords[w.lower]; ok || utf8.RuneCountInString(w.lower) < 4 || counts[w.lower] > common {
+			continue
+		}
+
+		// A word never used in lowercase is a proper noun.
+		if _, ok := lower[w.lower]; !ok {
+			continue
+		}
+
+		j, ok := last[w.lower]
+		last[w.lower] = i
+
+		if !ok || i-j > window {
+			delete(open, w.lower)
+			continue
+		}
+
+		e, ok := open[w.lower]
+
+		if !ok {
+			e = &WordEcho{
+				Word:  w.lower,
+				words: []*echoWord{words[j]},
+			}
+
+			open[w.lower] = e
+			echoes = append(echoes, e)
+		}
+
+		e.words = append(e.words, w)
+	}
+
+	for _, e := range echoes {
+		e.Count = len(e.words)
+	}
+
+	sort.SliceStable(echoes, func(i, j int) bool {
+		return echoes[i].words[0].pos < echoes[j].words[0].pos
+	})
+	return echoes
+}
+
+// Phrase is a phrase of words used more than once in a manuscript.
+type Phrase struct {
+	Text  string
+	Count int
+	words []*echoWord
+}
+
+// Locations returns the chapter and line of each use of the phrase.
+func (p *Phrase) Locations() []string {
+	locs := make([]string, 0, len(p.words))
+
+	for _, w := range p.words {
+		locs = append(locs, w.location())
+	}
+	return locs
+}
+
+// Phrases returns the phrases of between lo and hi words used at least
+// count times, ordered by how often they are used. Phrases that are only
+// part of a longer phrase used as often are not returned.
+func Phrases(words []*echoWord, lo, hi, count int) []*Phrase {
+	phrases := make([]*Phrase, 0)
+
+	for n := hi; n >= lo; n-- {
+		found := make(map[string]*Phrase)
+		order := make([]*Phrase, 0)
+
+		for i := 0; i+n <= len(words); i++ {
+			if words[i].seg != words[i+n-1].seg {
+				continue
+			}
+
+			parts := make([]string, 0, n)
+			stop := true
+
+			for _, w := range words[i : i+n] {
+				if _, ok := stopWords[w.lower]; !ok {
+					stop = false
+				}
+				parts = append(parts, w.lower)
+			}
+
+			if stop {
+				continue
+			}
+
+			text := strings.Join(parts, " ")
+
+			p, ok := found[text]
+
+			if !ok {
+				p = &Phrase{Text: text}
+				found[text] = p
+				order = append(order, p)
+			}
+
+			// A phrase that overlaps itself, such as "the the the", is only
+			// counted once per overlap.
+			if len(p.words) > 0 && i-p.words[len(p.words)-1].pos < n {
+				continue
+			}
+
+			p.words = append(p.words, words[i])
+			p.Count++
+		}
+
+		for _, p := range order {
+			if p.Count < count {
+				continue
+			}
+
+			subsumed := false
+
+			for _, longer := range phrases {
+				if longer.Count == p.Count && strings.Contains(" "+longer.Text+" ", " "+p.Text+" ") {
+					subsumed = true
+					break
+				}
+			}
+
+			if !subsumed {
+				phrases = append(phrases, p)
+			}
+		}
+	}
+
+	sort.SliceStable(phrases, func(i, j int) bool {
+		if phrases[i].Count == phrases[j].Count {
+			return len(phrases[i].Text) > len(phrases[j].Text)
+		}
+		return phrases[i].Count > phrases[j].Count
+	})
+	return phrases
+}
+
+// Opener is a run of consecutive sentences that start with the same word.
+type Opener struct {
+	Word    string
+	Count   int
+	Line    int
+	Chapter string
+}
+
+// Openers returns the runs of at least n consecutive sentences within each of
+// the given chapters that start with the same word.
+func Openers(ms *mom.Manuscript, cps []*chapterParagraphs, n int) []*Opener {
+	openers := make([]*Opener, 0)
+
+	for _, cp := range cps {
+		var run *Opener
+
+		end := func() {
+			if run != nil && run.Count >= n {
+				openers = append(openers, run)
+			}
+			run = nil
+		}
+
+		for _, p := range cp.paras {
+			parts := paragraphParts(ms, p)
+
+			for _, span := range SentenceSpans(p.Text) {
+				words := (&mom.Text{Value: p.Text[span[0]:span[1]]}).Words()
+
+				if len(words) == 0 {
+					continue
+				}
+
+				word := strings.ToLower(words[0])
+
+				if run != nil && run.Word == word {
+					run.Count++
+					continue
+				}
+
+				end()
+
+				run = &Opener{
+					Word:  word,
+					Count: 1,
+				}
+
+				if cp.chapter != nil {
+					run.Chapter = cp.chapter.Name()
+				}
+
+				i := sort.Search(len(parts), func(i int) bool {
+					return parts[i].pos > span[0]
+				}) - 1
+
+				if i >= 0 {
+					run.Line = parts[i].line
+				}
+			}
+		}
+		end()
+	}
+	return openers
+}
+
+// ErrEchoesFlag is returned for a -window, -count, or -top below 1.
+var ErrEchoesFlag = errors.New("must be at least 1")
+
+// parsePhraseRange parses the range of the number of words in a phrase, in the
+// format of min:max.
+func parsePhraseRange(s string) (int, int, error) {
+	lo, hi, ok := strings.Cut(s, ":")
+
+	if !ok {
+		return 0, 0, mom.ErrRangeFormat
+	}
+
+	start, err := strconv.Atoi(lo)
+
+	if err != nil {
+		return 0, 0, mom.ErrRangeType
+	}
+
+	end, err := strconv.Atoi(hi)
+
+	if err != nil {
+		return 0, 0, mom.ErrRangeType
+	}
+
+	if start < 1 || start > end {
+		return 0, 0, mom.ErrRangeInvalid
+	}
+	return start, end, nil
+}
+
+func echoesCmd(cmd *Command, args []string) error {
+	var (
+		window int
+		phrase string
+		count  int
+		top    int
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.IntVar(&window, "window", 30, "the number of words within which a word is an echo")
+	fs.StringVar(&phrase, "phrase", "3:6", "the range of the number of words in a phrase")
+	fs.IntVar(&count, "count", 3, "the number of times a phrase must be used")
+	fs.IntVar(&top, "top", 20, "the number of phrases to report")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) != 1 {
+		return ErrUsage
+	}
+
+	for _, f := range []struct {
+		name string
+		val  int
+	}{
+		{"window", window},
+		{"count", count},
+		{"top", top},
+	} {
+		if f.val < 1 {
+			return fmt.Errorf("-%s %d: %w", f.name, f.val, ErrEchoesFlag)
+		}
+	}
+
+	lo, hi, err := parsePhraseRange(phrase)
+
+	if err != nil {
+		return err
+	}
+
+	file := args[0]
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		return err
+	}
+
+	cps, paras, err := paragraphsByChapter(ms)
+
+	if err != nil {
+		return err
+	}
+
+	chapters := make([]*mom.Chapter, 0, len(cps))
+
+	for _, cp := range cps {
+		chapters = append(chapters, cp.chapter)
+	}
+
+	// A manuscript without chapters is treated as a single chapter.
+	if len(cps) == 0 {
+		cps = []*chapterParagraphs{{paras: paras}}
+	}
+
+	words := echoWords(ms, chapters)
+
+	sections := 0
+
+	section := func(title string) {
+		if sections > 0 {
+			cmd.Println()
+		}
+		cmd.Println(title)
+		sections++
+	}
+
+	if echoes := WordEchoes(words, window); len(echoes) > 0 {
+		section("Words:")
+
+		for _, e := range echoes {
+			cmd.Printf("    %s:%d: %q %d times: %s\n", file, e.words[0].line, e.Word, e.Count, strings.Join(e.Locations(), ", "))
+		}
+	}
+
+	if phrases := Phrases(words, lo, hi, count); len(phrases) > 0 {
+		section("Phrases:")
+
+		phrases = phrases[:min(top, len(phrases))]
+
+		for _, p := range phrases {
+			cmd.Printf("    %d %q: %s\n", p.Count, p.Text, strings.Join(p.Locations(), ", "))
+		}
+	}
+
+	if openers := Openers(ms, cps, 3); len(openers) > 0 {
+		section("Openers:")
+
+		for _, o := range openers {
+			s := fmt.Sprintf("    %s:%d: %q starts %d sentences in a row", file, o.Line, o.Word, o.Count)
+
+			if o.Chapter != "" {
+				s += " (in " + o.Chapter + ")"
+			}
+			cmd.Println(s)
+		}
+	}
+	return nil
+}
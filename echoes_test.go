@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/mom"
+)
+
+func TestEchoesCmd(t *testing.T) {
+	file := filepath.Join("testdata", "echoes", "echoes.mom")
+
+	tests := []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{
+			[]string{"-window", "10", "-phrase", "2:4", file},
+			[]string{
+				"Words:",
+				"    " + file + `:5: "wolves" 2 times: THE FIRST:5, THE FIRST:5`,
+				"",
+				"Phrases:",
+				`    4 "the howling of the": THE FIRST:5, THE FIRST:6, THE FIRST:8, THE SECOND:14`,
+				`    3 "the wolves": THE FIRST:5, THE FIRST:5, THE SECOND:14`,
+				"",
+				"Openers:",
+				"    " + file + `:5: "the" starts 4 sentences in a row (in THE FIRST)`,
+				"",
+			},
+			nil,
+		},
+		{
+			[]string{"-window", "10", "-phrase", "2:4", "-top", "1", file},
+			[]string{
+				"Words:",
+				"    " + file + `:5: "wolves" 2 times: THE FIRST:5, THE FIRST:5`,
+				"",
+				"Phrases:",
+				`    4 "the howling of the": THE FIRST:5, THE FIRST:6, THE FIRST:8, THE SECOND:14`,
+				"",
+				"Openers:",
+				"    " + file + `:5: "the" starts 4 sentences in a row (in THE FIRST)`,
+				"",
+			},
+			nil,
+		},
+		{[]string{"-window", "0", file}, nil, ErrEchoesFlag},
+		{[]string{"-count", "-1", file}, nil, ErrEchoesFlag},
+		{[]string{"-top", "-1", file}, nil, ErrEchoesFlag},
+		{[]string{"-phrase", "4", file}, nil, mom.ErrRangeFormat},
+		{[]string{"-phrase", "a:4", file}, nil, mom.ErrRangeType},
+		{[]string{"-phrase", "4:2", file}, nil, mom.ErrRangeInvalid},
+		{[]string{"-top", "1"}, nil, ErrUsage},
+	}
+
+	for _, test := range tests {
+		buf := CaptureOutput(EchoesCmd)
+
+		if err := echoesCmd(EchoesCmd, test.args); !errors.Is(err, test.err) {
+			t.Fatalf("echoesCmd(EchoesCmd, %v) = %v, want = %v", test.args, err, test.err)
+		}
+
+		if test.err != nil {
+			continue
+		}
+
+		if diff := cmp.Diff(strings.Join(test.want, "\n"), buf.String()); diff != "" {
+			t.Errorf("echoesCmd(EchoesCmd, %v) mismatch (-want +got):\n%s", test.args, diff)
+		}
+	}
+}
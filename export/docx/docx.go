@@ -0,0 +1,1042 @@
+// Package docx publishes manuscripts as Microsoft Word documents, and registers
+// the docx exporter.
+package docx
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mmonterroca/docxgo/v2"
+	"github.com/mmonterroca/docxgo/v2/domain"
+
+	"book/export"
+	"book/mom"
+)
+
+func BuildCover(doc domain.Document, ms *mom.Manuscript, l *export.Layout, styles map[string]*export.Style) error {
+	for i := 0; i < 10; i++ {
+		if _, err := doc.AddParagraph(); err != nil {
+			return err
+		}
+	}
+
+	for i, txt := range []string{ms.DocTitle(), "by", ms.Author()} {
+		st := styles[export.StyleSubtitle]
+
+		if i == 0 {
+			st = styles[export.StyleTitle]
+		}
+
+		if _, err := AddLine(doc, txt, st); err != nil {
+			return err
+		}
+	}
+
+	s, err := doc.DefaultSection()
+
+	if err != nil {
+		return err
+	}
+
+	ftr, err := s.Footer(domain.FooterDefault)
+
+	if err != nil {
+		return err
+	}
+
+	p, err := ftr.AddParagraph()
+
+	if err != nil {
+		return err
+	}
+
+	p.SetAlignment(domain.AlignmentRight)
+
+	r, err := p.AddRun()
+
+	if err != nil {
+		return err
+	}
+
+	copyright := ms.Copyright()
+
+	if copyright == "" {
+		copyright = fmt.Sprintf("%d %s", l.Date.Year(), ms.Author())
+	}
+
+	r.SetText("© " + copyright)
+	return nil
+}
+
+// BuildSMFCover builds the first page of the manuscript in the Standard
+// Manuscript Format. This places the contact block at the top left, with the
+// approximate word count at the top right of its first line, and the title
+// and author halfway down the page.
+func BuildSMFCover(doc domain.Document, ms *mom.Manuscript, l *export.Layout, styles map[string]*export.Style) error {
+	wc := export.CoverWords(ms)
+
+	lines := l.Contact.Lines()
+
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+
+	for i, line := range lines {
+		// The word count is set against the right tab stop of the contact
+		// style.
+		if i == 0 {
+			line += "\t" + wc
+		}
+
+		if _, err := AddLine(doc, line, styles[export.StyleContact]); err != nil {
+			return err
+		}
+	}
+
+	// Pad out the page with single spaced lines so the title sits halfway down
+	// the page.
+	for i := len(lines); i < export.SMFPageLines/2; i++ {
+		if _, err := AddLine(doc, "", &export.Style{Spacing: export.SingleSpacing}); err != nil {
+			return err
+		}
+	}
+
+	if _, err := AddLine(doc, ms.DocTitle(), styles[export.StyleTitle]); err != nil {
+		return err
+	}
+
+	if _, err := AddLine(doc, "by "+ms.Author(), styles[export.StyleSubtitle]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddLine adds a paragraph containing a single line of text to the document,
+// with the given style.
+func AddLine(doc domain.Document, txt string, st *export.Style) (domain.Run, error) {
+	p, err := doc.AddParagraph()
+
+	if err != nil {
+		return nil, err
+	}
+
+	named, err := ApplyParagraphStyle(p, st)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := p.AddRun()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.SetText(txt); err != nil {
+		return nil, err
+	}
+
+	if !named {
+		if err := ApplyRunStyle(r, st); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// BuildText adds the given text to the paragraph, formatting it as per the
+// inline escape macros within the text. If a style is given, then its run
+// formatting is applied directly to each run.
+func BuildText(p domain.Paragraph, txt string, st *export.Style) error {
+	sc := mom.Scanner{
+		Tokens: mom.Tokenize(txt),
+	}
+
+	tok := sc.Next()
+
+	for tok != nil {
+		switch v := tok.(type) {
+		case *mom.Inline:
+			r, err := p.AddRun()
+
+			if err != nil {
+				return err
+			}
+
+			if st != nil {
+				if err := ApplyRunStyle(r, st); err != nil {
+					return err
+				}
+			}
+
+			switch v.Escape {
+			case "IT", "BD", "BDI":
+				var err error
+
+				switch v.Escape {
+				case "IT":
+					err = r.SetStyle(export.StyleEmphasis)
+				case "BD":
+					err = r.SetStyle(export.StyleStrong)
+				case "BDI":
+					if err = r.SetStyle(export.StyleStrong); err == nil {
+						err = r.SetItalic(true)
+					}
+				}
+
+				if err != nil {
+					return err
+				}
+
+				tok = sc.Next()
+
+			inner:
+				for tok != nil {
+					switch v := tok.(type) {
+					case *mom.Inline:
+						if v.Escape == "PREV" {
+							break inner
+						}
+					case *mom.Text:
+						r.SetText(v.Value)
+					}
+					tok = sc.Next()
+				}
+			case "lq":
+				r.SetText("“")
+			case "rq":
+				r.SetText("”")
+			}
+		case *mom.Text:
+			r, err := p.AddRun()
+
+			if err != nil {
+				return err
+			}
+
+			if st != nil {
+				if err := ApplyRunStyle(r, st); err != nil {
+					return err
+				}
+			}
+			r.SetText(v.Value)
+		}
+		tok = sc.Next()
+	}
+	return nil
+}
+
+var pageSizes = map[string]domain.PageSize{
+	"a4":     domain.PageSizeA4,
+	"a5":     domain.PageSizeA5,
+	"letter": domain.PageSizeLetter,
+	"legal":  domain.PageSizeLegal,
+}
+
+// BuildSMFHeader adds the running header of the Standard Manuscript Format to
+// the given section, which is the surname of the author, the title, and the
+// page number.
+func BuildSMFHeader(s domain.Section, ms *mom.Manuscript) error {
+	hdr, err := s.Header(domain.HeaderDefault)
+
+	if err != nil {
+		return err
+	}
+
+	p, err := hdr.AddParagraph()
+
+	if err != nil {
+		return err
+	}
+
+	if err := p.SetAlignment(domain.AlignmentRight); err != nil {
+		return err
+	}
+
+	r, err := p.AddRun()
+
+	if err != nil {
+		return err
+	}
+
+	if err := r.AddText(export.SMFHeader(ms) + " / "); err != nil {
+		return err
+	}
+	return r.AddField(docx.NewPageNumberField())
+}
+
+// docxExporter publishes docx files. The document can only be saved to a file,
+// so it is written to a temporary file first, and then copied to the writer.
+type docxExporter struct{}
+
+func (docxExporter) Name() string        { return "docx" }
+func (docxExporter) Ext() string         { return "docx" }
+func (docxExporter) Description() string { return "Microsoft Word document" }
+
+func (docxExporter) Export(ctx context.Context, ms *mom.Manuscript, w io.Writer) error {
+	l, err := export.PubOptionsFrom(ctx).LayoutFor(ms)
+
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "book-docx")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "book.docx")
+
+	if err := WriteToDOCX(name, ms, l); err != nil {
+		return err
+	}
+
+	f, err := os.Open(name)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func init() {
+	export.RegisterExporter(docxExporter{})
+}
+
+func WriteToDOCX(name string, ms *mom.Manuscript, l *export.Layout) error {
+	smf := l.Profile == export.ProfileSMF
+
+	doc := docx.NewDocument()
+	doc.SetMetadata(&domain.Metadata{
+		Title:   ms.DocTitle(),
+		Creator: ms.Author(),
+		Created: l.Date.Format(time.RFC3339),
+	})
+
+	s, err := doc.DefaultSection()
+
+	if err != nil {
+		return err
+	}
+
+	s.SetPageSize(pageSizes[l.Paper])
+
+	if l.Margins != (export.Margins{}) {
+		err := s.SetMargins(domain.Margins{
+			Top:    l.Margins.Top,
+			Right:  l.Margins.Right,
+			Bottom: l.Margins.Bottom,
+			Left:   l.Margins.Left,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	styles := export.NewStyles(l)
+
+	// The body of the manuscript goes in its own section after the cover, so
+	// the footer of the cover is not carried over.
+	s2 := s
+	evenOdd := false
+
+	if l.Cover {
+		if smf {
+			if err := BuildSMFCover(doc, ms, l, styles); err != nil {
+				return err
+			}
+		} else {
+			if err := BuildCover(doc, ms, l, styles); err != nil {
+				return err
+			}
+		}
+
+		if s2, err = doc.AddSectionWithBreak(domain.SectionBreakTypeNextPage); err != nil {
+			return err
+		}
+	}
+
+	if smf {
+		if err := BuildSMFHeader(s2, ms); err != nil {
+			return err
+		}
+	} else {
+		evenOdd, err = BuildHeaders(s2, ms)
+
+		if err != nil {
+			return err
+		}
+
+		types := []domain.FooterType{domain.FooterDefault}
+
+		// Even pages only get the footers that are explicitly given to them,
+		// so make sure the page number is still there.
+		if evenOdd {
+			types = append(types, domain.FooterEven)
+		}
+
+		for _, typ := range types {
+			ftr, err := s2.Footer(typ)
+
+			if err != nil {
+				return err
+			}
+
+			if err := BuildPageFooter(ftr); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = export.Walk(ms, &export.Visitor{
+		Chapter: func(heading string) error {
+			// Chapters in the Standard Manuscript Format start a third of the
+			// way down the page.
+			if smf {
+				for i := 0; i < export.SMFPageLines/6; i++ {
+					if _, err := AddLine(doc, "", &export.Style{Spacing: l.LineSpacing}); err != nil {
+						return err
+					}
+				}
+			}
+
+			_, err := AddLine(doc, heading, styles[export.StyleHeading1])
+			return err
+		},
+		ChapterTitle: func(title string) error {
+			_, err := AddLine(doc, title, styles[export.StyleHeading2])
+			return err
+		},
+		Epigraph: func(txt string, attribution bool) error {
+			st := styles[export.StyleEpigraph]
+
+			if attribution {
+				st = styles[export.StyleAttribution]
+			}
+
+			p, err := doc.AddParagraph()
+
+			if err != nil {
+				return err
+			}
+
+			named, err := ApplyParagraphStyle(p, st)
+
+			if err != nil {
+				return err
+			}
+
+			if named {
+				st = nil
+			}
+			return BuildText(p, txt, st)
+		},
+		Paragraph: func(para *export.Paragraph) error {
+			st := styles[export.StyleBodyText]
+
+			if para.First {
+				st = styles[export.StyleBodyTextFirst]
+			}
+
+			for i, seg := range para.Segments {
+				p, err := doc.AddParagraph()
+
+				if err != nil {
+					return err
+				}
+
+				if i == 0 && para.DropCap != "" {
+					dst := DropCapStyle(l, para.DropLines)
+					styles[dst.ID] = dst
+
+					if err := p.SetStyle(dst.ID); err != nil {
+						return err
+					}
+
+					r, err := p.AddRun()
+
+					if err != nil {
+						return err
+					}
+
+					if err := r.SetText(para.DropCap); err != nil {
+						return err
+					}
+
+					if p, err = doc.AddParagraph(); err != nil {
+						return err
+					}
+				}
+
+				named, err := ApplyParagraphStyle(p, st)
+
+				if err != nil {
+					return err
+				}
+
+				if align, ok := styleAlignments[seg.Align]; ok {
+					if err := p.SetAlignment(align); err != nil {
+						return err
+					}
+				}
+
+				rst := st
+
+				if named {
+					rst = nil
+				}
+
+				if err := BuildText(p, seg.Text, rst); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		SceneBreak: func() error {
+			// Scene breaks are marked with a single centred # in the
+			// Standard Manuscript Format.
+			if smf {
+				_, err := AddLine(doc, "#", &export.Style{Align: "center", Spacing: l.LineSpacing})
+				return err
+			}
+			return nil
+		},
+		Collate: doc.AddPageBreak,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if smf {
+		if _, err := AddLine(doc, "END", &export.Style{Align: "center", Spacing: l.LineSpacing}); err != nil {
+			return err
+		}
+	}
+
+	if err := doc.SaveAs(name); err != nil {
+		return err
+	}
+
+	return RewriteDOCX(name, l.Date, func(part string, b []byte) ([]byte, error) {
+		switch part {
+		case "docProps/core.xml":
+			return SetCoreDates(b, l.Date), nil
+		case "word/settings.xml":
+			if evenOdd {
+				return enableEvenAndOddHeaders(b), nil
+			}
+		case "word/styles.xml":
+			return DefineStyles(SetDocDefaults(b, l.Font, l.FontSize), styles), nil
+		case "word/document.xml":
+			return expandTabs(b), nil
+		}
+		return b, nil
+	})
+}
+
+var reText = regexp.MustCompile(`<w:t(?:\s[^>]*)?>([^<]*)</w:t>`)
+
+// expandTabs replaces the tabs within the text of the runs of the given
+// document.xml with tab elements, as a tab within the text itself is treated
+// as a space.
+func expandTabs(b []byte) []byte {
+	return reText.ReplaceAllFunc(b, func(el []byte) []byte {
+		text := string(reText.FindSubmatch(el)[1])
+		text = strings.ReplaceAll(text, "&#x9;", "\t")
+		text = strings.ReplaceAll(text, "&#9;", "\t")
+
+		if !strings.Contains(text, "\t") {
+			return el
+		}
+
+		parts := strings.Split(text, "\t")
+
+		var buf bytes.Buffer
+
+		for i, part := range parts {
+			if i > 0 {
+				buf.WriteString(`<w:tab/>`)
+			}
+
+			if part != "" {
+				fmt.Fprintf(&buf, `<w:t xml:space="preserve">%s</w:t>`, part)
+			}
+		}
+		return buf.Bytes()
+	})
+}
+
+// BuildPageFooter adds the page number and page count to the given footer.
+func BuildPageFooter(ftr domain.Footer) error {
+	p, err := ftr.AddParagraph()
+
+	if err != nil {
+		return err
+	}
+
+	if err := p.SetAlignment(domain.AlignmentCenter); err != nil {
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		r, err := p.AddRun()
+
+		if err != nil {
+			return err
+		}
+
+		switch i {
+		case 0:
+			err = r.AddField(docx.NewPageNumberField())
+		case 1:
+			err = r.AddText(" of ")
+		case 2:
+			err = r.AddField(docx.NewPageCountField())
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildHeaders adds the running headers of the manuscript to the given
+// section, as returned by [export.RunningHeaders]. This returns whether
+// separate headers were added for even and odd pages.
+func BuildHeaders(s domain.Section, ms *mom.Manuscript) (bool, error) {
+	hs, err := export.RunningHeaders(ms)
+
+	if err != nil {
+		return false, err
+	}
+
+	type header struct {
+		typ domain.HeaderType
+		*export.Header
+	}
+
+	headers := []header{
+		{domain.HeaderDefault, hs.Recto},
+	}
+
+	if hs.RectoVerso {
+		headers = append(headers, header{domain.HeaderEven, hs.Verso})
+	}
+
+	added := false
+
+	for _, h := range headers {
+		if h.Header == nil {
+			continue
+		}
+
+		hdr, err := s.Header(h.typ)
+
+		if err != nil {
+			return false, err
+		}
+
+		p, err := hdr.AddParagraph()
+
+		if err != nil {
+			return false, err
+		}
+
+		if err := p.SetAlignment(styleAlignments[h.Align]); err != nil {
+			return false, err
+		}
+
+		if err := BuildText(p, h.Text, nil); err != nil {
+			return false, err
+		}
+		added = true
+	}
+	return hs.RectoVerso && added, nil
+}
+
+func readZipFile(z *zip.Reader, name string) ([]byte, error) {
+	f, err := z.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// RewriteDOCX rewrites each part of the given DOCX file via the given function.
+// This is used for making changes to the document that cannot be made via the
+// docx library itself.
+//
+// The parts are written in a stable order, with the given modification time,
+// so the same document always produces the same file.
+func RewriteDOCX(name string, modified time.Time, fn func(part string, b []byte) ([]byte, error)) error {
+	z, err := zip.OpenReader(name)
+
+	if err != nil {
+		return err
+	}
+
+	defer z.Close()
+
+	// Zip timestamps cannot represent anything before 1980.
+	if epoch := time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC); modified.Before(epoch) {
+		modified = epoch
+	}
+
+	files := make([]*zip.File, len(z.File))
+	copy(files, z.File)
+
+	// The content types and package relationships are conventionally the
+	// first parts in the file, the rest are sorted by name.
+	rank := func(name string) int {
+		switch name {
+		case "[Content_Types].xml":
+			return 0
+		case "_rels/.rels":
+			return 1
+		}
+		return 2
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := rank(files[i].Name), rank(files[j].Name)
+
+		if a != b {
+			return a < b
+		}
+		return files[i].Name < files[j].Name
+	})
+
+	var buf bytes.Buffer
+
+	w := zip.NewWriter(&buf)
+
+	for _, f := range files {
+		b, err := readZipFile(&z.Reader, f.Name)
+
+		if err != nil {
+			return err
+		}
+
+		if b, err = fn(f.Name, b); err != nil {
+			return err
+		}
+
+		part, err := w.CreateHeader(&zip.FileHeader{
+			Name:     f.Name,
+			Method:   zip.Deflate,
+			Modified: modified.UTC(),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := part.Write(b); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(name, buf.Bytes(), 0644)
+}
+
+var reCoreDate = regexp.MustCompile(`(<dcterms:(?:created|modified)[^>]*>)[^<]*(</dcterms:(?:created|modified)>)`)
+
+// SetCoreDates sets the created and modified dates in the given core.xml to
+// the given time.
+func SetCoreDates(b []byte, t time.Time) []byte {
+	return reCoreDate.ReplaceAll(b, []byte("${1}"+t.UTC().Format(time.RFC3339)+"${2}"))
+}
+
+// settingsAfterEvenOdd are the elements of settings.xml that must come after
+// evenAndOddHeaders, as the order of the elements is fixed by the schema.
+var settingsAfterEvenOdd = []string{
+	"bookFoldRevPrinting", "bookFoldPrinting", "bookFoldPrintingSheets",
+	"drawingGridHorizontalSpacing", "drawingGridVerticalSpacing",
+	"displayHorizontalDrawingGridEvery", "displayVerticalDrawingGridEvery",
+	"doNotUseMarginsForDrawingGridOrigin", "drawingGridHorizontalOrigin",
+	"drawingGridVerticalOrigin", "doNotShadeFormData", "noPunctuationKerning",
+	"characterSpacingControl", "printTwoOnOne", "strictFirstAndLastChars",
+	"noLineBreaksAfter", "noLineBreaksBefore", "savePreviewPicture",
+	"doNotValidateAgainstSchema", "saveInvalidXml", "ignoreMixedContent",
+	"alwaysShowPlaceholderText", "doNotDemarcateInvalidXml", "saveXmlDataOnly",
+	"useXSLTWhenSaving", "saveThroughXslt", "showXMLTags",
+	"alwaysMergeEmptyNamespace", "updateFields", "hdrShapeDefaults",
+	"footnotePr", "endnotePr", "compat", "docVars", "rsids", "mathPr",
+	"attachedSchema", "themeFontLang", "clrSchemeMapping",
+	"doNotIncludeSubdocsInStats", "doNotAutoCompressPictures", "forceUpgrade",
+	"captions", "readModeInkLockDown", "smartTagType", "schemaLibrary",
+	"shapeDefaults", "doNotEmbedSmartTags", "decimalSymbol", "listSeparator",
+}
+
+// enableEvenAndOddHeaders adds the evenAndOddHeaders setting to the given
+// settings.xml, so the even page headers of a section are used.
+func enableEvenAndOddHeaders(b []byte) []byte {
+	s := string(b)
+
+	if strings.Contains(s, "<w:evenAndOddHeaders") {
+		return b
+	}
+
+	pos := strings.Index(s, "</w:settings>")
+
+	if pos < 0 {
+		return b
+	}
+
+	for _, el := range settingsAfterEvenOdd {
+		for _, suffix := range []string{">", " ", "/"} {
+			if i := strings.Index(s, "<w:"+el+suffix); i >= 0 && i < pos {
+				pos = i
+			}
+		}
+	}
+	return []byte(s[:pos] + "<w:evenAndOddHeaders/>" + s[pos:])
+}
+
+var styleAlignments = map[string]domain.Alignment{
+	"left":   domain.AlignmentLeft,
+	"center": domain.AlignmentCenter,
+	"right":  domain.AlignmentRight,
+}
+
+// ApplyParagraphStyle applies the style to the given paragraph. If the style
+// is named, then it is set as the style of the paragraph and true is returned.
+// Otherwise, the paragraph formatting of the style is applied directly, and the
+// run formatting should be applied to each run via [ApplyRunStyle].
+func ApplyParagraphStyle(p domain.Paragraph, st *export.Style) (bool, error) {
+	if st.ID != "" {
+		return true, p.SetStyle(st.ID)
+	}
+
+	if align, ok := styleAlignments[st.Align]; ok {
+		if err := p.SetAlignment(align); err != nil {
+			return false, err
+		}
+	}
+
+	if st.Spacing > 0 {
+		p.SetLineSpacing(domain.LineSpacing{
+			Value: st.Spacing,
+		})
+	}
+
+	if st.Indent > 0 || st.Left > 0 || st.Right > 0 {
+		p.SetIndent(domain.Indentation{
+			Left:      st.Left,
+			Right:     st.Right,
+			FirstLine: st.Indent,
+		})
+	}
+	return false, nil
+}
+
+// DropCapStyle returns the style for the drop cap of a paragraph that spans
+// the given number of lines.
+func DropCapStyle(l *export.Layout, lines int) *export.Style {
+	// The height of each line in twips, the font size is in half-points so
+	// this is multiplied by 10 rather than 20.
+	height := l.FontSize * 10 * l.LineSpacing / export.SingleSpacing
+
+	return &export.Style{
+		ID:      fmt.Sprintf("DropCap%d", lines),
+		Name:    fmt.Sprintf("Drop Cap %d", lines),
+		Spacing: height * lines,
+		DropCap: lines,
+		Size:    height * lines / 10,
+	}
+}
+
+// ApplyRunStyle applies the run formatting of the style directly to the given
+// run.
+func ApplyRunStyle(r domain.Run, st *export.Style) error {
+	if st.Size > 0 {
+		if err := r.SetSize(st.Size); err != nil {
+			return err
+		}
+	}
+
+	if st.Bold {
+		if err := r.SetBold(true); err != nil {
+			return err
+		}
+	}
+
+	if st.Italic {
+		if err := r.SetItalic(true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StyleXML returns the definition of the style as it would appear in
+// styles.xml.
+func StyleXML(st *export.Style) string {
+	var buf bytes.Buffer
+
+	typ := "paragraph"
+
+	if st.Char {
+		typ = "character"
+	}
+
+	fmt.Fprintf(&buf, `<w:style w:type="%s" w:styleId="%s">`, typ, st.ID)
+	fmt.Fprintf(&buf, `<w:name w:val="%s"/>`, st.Name)
+
+	if st.BasedOn != "" {
+		fmt.Fprintf(&buf, `<w:basedOn w:val="%s"/>`, st.BasedOn)
+	} else if !st.Char {
+		buf.WriteString(`<w:basedOn w:val="Normal"/>`)
+	}
+
+	if st.Next != "" {
+		fmt.Fprintf(&buf, `<w:next w:val="%s"/>`, st.Next)
+	}
+
+	buf.WriteString(`<w:qFormat/>`)
+
+	if !st.Char {
+		buf.WriteString(`<w:pPr>`)
+
+		if st.Outline > 0 {
+			buf.WriteString(`<w:keepNext/>`)
+		}
+
+		rule := "auto"
+
+		if st.DropCap > 0 {
+			fmt.Fprintf(&buf, `<w:framePr w:dropCap="drop" w:lines="%d" w:wrap="around" w:vAnchor="text" w:hAnchor="text"/>`, st.DropCap)
+			rule = "exact"
+		}
+
+		if st.Tab > 0 {
+			fmt.Fprintf(&buf, `<w:tabs><w:tab w:val="right" w:pos="%d"/></w:tabs>`, st.Tab)
+		}
+
+		if st.Spacing > 0 {
+			fmt.Fprintf(&buf, `<w:spacing w:before="0" w:after="0" w:line="%d" w:lineRule="%s"/>`, st.Spacing, rule)
+		}
+
+		fmt.Fprintf(&buf, `<w:ind w:left="%d" w:right="%d" w:firstLine="%d"/>`, st.Left, st.Right, st.Indent)
+
+		if st.Align != "" {
+			fmt.Fprintf(&buf, `<w:jc w:val="%s"/>`, st.Align)
+		}
+
+		if st.Outline > 0 {
+			fmt.Fprintf(&buf, `<w:outlineLvl w:val="%d"/>`, st.Outline-1)
+		}
+		buf.WriteString(`</w:pPr>`)
+	}
+
+	buf.WriteString(`<w:rPr>`)
+
+	if st.Bold {
+		buf.WriteString(`<w:b/><w:bCs/>`)
+	}
+
+	if st.Italic {
+		buf.WriteString(`<w:i/><w:iCs/>`)
+	}
+
+	if st.Size > 0 {
+		fmt.Fprintf(&buf, `<w:sz w:val="%d"/><w:szCs w:val="%d"/>`, st.Size, st.Size)
+	}
+
+	buf.WriteString(`</w:rPr></w:style>`)
+	return buf.String()
+}
+
+var reDocDefaults = regexp.MustCompile(`(?s)<w:docDefaults>.*?</w:docDefaults>|<w:docDefaults/>`)
+
+// SetDocDefaults sets the default font, and size in half-points, of the given
+// styles.xml, replacing any existing defaults.
+func SetDocDefaults(b []byte, font string, size int) []byte {
+	defaults := fmt.Sprintf(
+		`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="%[1]s" w:hAnsi="%[1]s" w:eastAsia="%[1]s" w:cs="%[1]s"/><w:sz w:val="%[2]d"/><w:szCs w:val="%[2]d"/></w:rPr></w:rPrDefault></w:docDefaults>`,
+		font,
+		size,
+	)
+
+	if reDocDefaults.Match(b) {
+		return reDocDefaults.ReplaceAllLiteral(b, []byte(defaults))
+	}
+
+	s := string(b)
+
+	// The defaults come first within the styles.
+	start := strings.Index(s, "<w:styles")
+
+	if start < 0 {
+		return b
+	}
+
+	end := strings.Index(s[start:], ">")
+
+	if end < 0 {
+		return b
+	}
+
+	pos := start + end + 1
+	return []byte(s[:pos] + defaults + s[pos:])
+}
+
+var reStyle = regexp.MustCompile(`(?s)<w:style\s[^>]*w:styleId="([^"]*)"[^>]*?(/>|>.*?</w:style>)`)
+
+// DefineStyles adds the given styles to the given styles.xml, replacing any
+// existing styles with the same ID.
+func DefineStyles(b []byte, styles map[string]*export.Style) []byte {
+	s := reStyle.ReplaceAllStringFunc(string(b), func(el string) string {
+		if _, ok := styles[reStyle.FindStringSubmatch(el)[1]]; ok {
+			return ""
+		}
+		return el
+	})
+
+	pos := strings.LastIndex(s, "</w:styles>")
+
+	if pos < 0 {
+		return b
+	}
+
+	ids := make([]string, 0, len(styles))
+
+	for id := range styles {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	var buf bytes.Buffer
+
+	for _, id := range ids {
+		buf.WriteString(StyleXML(styles[id]))
+	}
+	return []byte(s[:pos] + buf.String() + s[pos:])
+}
@@ -0,0 +1,326 @@
+package docx
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/export"
+	"book/mom"
+)
+
+func TestEnableEvenAndOddHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{
+			"empty settings",
+			`<w:settings></w:settings>`,
+			`<w:settings><w:evenAndOddHeaders/></w:settings>`,
+		},
+		{
+			"before compat",
+			`<w:settings><w:zoom w:percent="100"/><w:defaultTabStop w:val="720"/><w:compat/></w:settings>`,
+			`<w:settings><w:zoom w:percent="100"/><w:defaultTabStop w:val="720"/><w:evenAndOddHeaders/><w:compat/></w:settings>`,
+		},
+		{
+			"already set",
+			`<w:settings><w:evenAndOddHeaders/></w:settings>`,
+			`<w:settings><w:evenAndOddHeaders/></w:settings>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := string(enableEvenAndOddHeaders([]byte(test.xml)))
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("enableEvenAndOddHeaders(%q) mismatch (-want +got):\n%s", test.xml, diff)
+			}
+		})
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{
+			"no tabs",
+			`<w:r><w:t>Jonathan Harker</w:t></w:r>`,
+			`<w:r><w:t>Jonathan Harker</w:t></w:r>`,
+		},
+		{
+			"escaped tab",
+			`<w:r><w:t xml:space="preserve">Jonathan Harker&#x9;About 11,000 words</w:t></w:r>`,
+			`<w:r><w:t xml:space="preserve">Jonathan Harker</w:t><w:tab/><w:t xml:space="preserve">About 11,000 words</w:t></w:r>`,
+		},
+		{
+			"leading tab",
+			"<w:r><w:t>\tAbout 100 words</w:t></w:r>",
+			`<w:r><w:tab/><w:t xml:space="preserve">About 100 words</w:t></w:r>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := string(expandTabs([]byte(test.xml)))
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("expandTabs(%q) mismatch (-want +got):\n%s", test.xml, diff)
+			}
+		})
+	}
+}
+
+func TestDefineStyles(t *testing.T) {
+	styles := map[string]*export.Style{
+		export.StyleEmphasis: {
+			ID:     export.StyleEmphasis,
+			Name:   "Emphasis",
+			Char:   true,
+			Italic: true,
+		},
+		export.StyleHeading1: {
+			ID:      export.StyleHeading1,
+			Name:    "heading 1",
+			Next:    export.StyleBodyTextFirst,
+			Align:   "center",
+			Spacing: 480,
+			Outline: 1,
+			Size:    36,
+			Bold:    true,
+		},
+	}
+
+	xml := `<w:styles><w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style><w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/></w:style></w:styles>`
+
+	want := `<w:styles><w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>` +
+		`<w:style w:type="character" w:styleId="Emphasis"><w:name w:val="Emphasis"/><w:qFormat/><w:rPr><w:i/><w:iCs/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:next w:val="BodyTextFirst"/><w:qFormat/>` +
+		`<w:pPr><w:keepNext/><w:spacing w:before="0" w:after="0" w:line="480" w:lineRule="auto"/><w:ind w:left="0" w:right="0" w:firstLine="0"/><w:jc w:val="center"/><w:outlineLvl w:val="0"/></w:pPr>` +
+		`<w:rPr><w:b/><w:bCs/><w:sz w:val="36"/><w:szCs w:val="36"/></w:rPr></w:style></w:styles>`
+
+	if diff := cmp.Diff(want, string(DefineStyles([]byte(xml), styles))); diff != "" {
+		t.Errorf("DefineStyles() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDropCapStyle(t *testing.T) {
+	l := export.Layout{
+		FontSize:    24,
+		LineSpacing: 480,
+	}
+
+	want := `<w:style w:type="paragraph" w:styleId="DropCap3"><w:name w:val="Drop Cap 3"/><w:basedOn w:val="Normal"/><w:qFormat/>` +
+		`<w:pPr><w:framePr w:dropCap="drop" w:lines="3" w:wrap="around" w:vAnchor="text" w:hAnchor="text"/>` +
+		`<w:spacing w:before="0" w:after="0" w:line="1440" w:lineRule="exact"/><w:ind w:left="0" w:right="0" w:firstLine="0"/></w:pPr>` +
+		`<w:rPr><w:sz w:val="144"/><w:szCs w:val="144"/></w:rPr></w:style>`
+
+	if diff := cmp.Diff(want, StyleXML(DropCapStyle(&l, 3))); diff != "" {
+		t.Errorf("StyleXML(DropCapStyle(l, 3)) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetCoreDates(t *testing.T) {
+	core := `<cp:coreProperties><dc:title>DRACULA</dc:title>` +
+		`<dcterms:created xsi:type="dcterms:W3CDTF">2025-03-01T10:00:00Z</dcterms:created>` +
+		`<dcterms:modified xsi:type="dcterms:W3CDTF">2025-03-02T11:00:00Z</dcterms:modified>` +
+		`</cp:coreProperties>`
+
+	want := `<cp:coreProperties><dc:title>DRACULA</dc:title>` +
+		`<dcterms:created xsi:type="dcterms:W3CDTF">1897-05-26T00:00:00Z</dcterms:created>` +
+		`<dcterms:modified xsi:type="dcterms:W3CDTF">1897-05-26T00:00:00Z</dcterms:modified>` +
+		`</cp:coreProperties>`
+
+	date := time.Date(1897, time.May, 26, 0, 0, 0, 0, time.UTC)
+
+	if diff := cmp.Diff(want, string(SetCoreDates([]byte(core), date))); diff != "" {
+		t.Errorf("SetCoreDates mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRewriteDOCX(t *testing.T) {
+	dir := t.TempDir()
+
+	parts := []string{
+		"word/document.xml",
+		"_rels/.rels",
+		"docProps/core.xml",
+		"[Content_Types].xml",
+	}
+
+	write := func(name string) {
+		var buf bytes.Buffer
+
+		z := zip.NewWriter(&buf)
+
+		for _, part := range parts {
+			w, err := z.Create(part)
+
+			if err != nil {
+				t.Fatalf("z.Create(%q): %v\n", part, err)
+			}
+			w.Write([]byte(part))
+		}
+
+		if err := z.Close(); err != nil {
+			t.Fatalf("z.Close(): %v\n", err)
+		}
+
+		if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("os.WriteFile(%q): %v\n", name, err)
+		}
+	}
+
+	date := time.Date(2024, time.May, 26, 12, 30, 0, 0, time.UTC)
+
+	identity := func(part string, b []byte) ([]byte, error) {
+		return b, nil
+	}
+
+	files := make([][]byte, 0, 2)
+
+	for _, name := range []string{"a.docx", "b.docx"} {
+		path := filepath.Join(dir, name)
+
+		write(path)
+
+		if err := RewriteDOCX(path, date, identity); err != nil {
+			t.Fatalf("RewriteDOCX(%q): %v\n", path, err)
+		}
+
+		b, err := os.ReadFile(path)
+
+		if err != nil {
+			t.Fatalf("os.ReadFile(%q): %v\n", path, err)
+		}
+		files = append(files, b)
+	}
+
+	if !bytes.Equal(files[0], files[1]) {
+		t.Fatalf("RewriteDOCX produced different files for the same input\n")
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(files[0]), int64(len(files[0])))
+
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v\n", err)
+	}
+
+	want := []string{
+		"[Content_Types].xml",
+		"_rels/.rels",
+		"docProps/core.xml",
+		"word/document.xml",
+	}
+
+	got := make([]string, 0, len(z.File))
+
+	for _, f := range z.File {
+		got = append(got, f.Name)
+
+		if !f.Modified.Equal(date) {
+			t.Errorf("%s modified = %s, want = %s", f.Name, f.Modified, date)
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RewriteDOCX part order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetDocDefaults(t *testing.T) {
+	defaults := `<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Courier New" w:hAnsi="Courier New" w:eastAsia="Courier New" w:cs="Courier New"/>` +
+		`<w:sz w:val="24"/><w:szCs w:val="24"/></w:rPr></w:rPrDefault></w:docDefaults>`
+
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{
+			"no defaults",
+			`<w:styles xmlns:w="w"><w:style w:styleId="Normal"/></w:styles>`,
+			`<w:styles xmlns:w="w">` + defaults + `<w:style w:styleId="Normal"/></w:styles>`,
+		},
+		{
+			"existing defaults",
+			`<w:styles><w:docDefaults><w:rPrDefault><w:rPr><w:sz w:val="22"/></w:rPr></w:rPrDefault></w:docDefaults></w:styles>`,
+			`<w:styles>` + defaults + `</w:styles>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := string(SetDocDefaults([]byte(test.xml), "Courier New", 24))
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("SetDocDefaults(%q) mismatch (-want +got):\n%s", test.xml, diff)
+			}
+		})
+	}
+}
+
+func TestWriteToDOCX(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "chapters.mom")
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		t.Fatalf("ParseManuscript(%q): %v\n", file, err)
+	}
+
+	l, err := export.NewLayout(ms, nil)
+
+	if err != nil {
+		t.Fatalf("NewLayout: %v\n", err)
+	}
+
+	l.Date = time.Date(2024, time.May, 26, 12, 30, 0, 0, time.UTC)
+	l.Margins = export.Margins{Top: 1440, Right: 1080, Bottom: 1440, Left: 1080}
+
+	name := filepath.Join(t.TempDir(), "chapters.docx")
+
+	if err := WriteToDOCX(name, ms, l); err != nil {
+		t.Fatalf("WriteToDOCX: %v\n", err)
+	}
+
+	z, err := zip.OpenReader(name)
+
+	if err != nil {
+		t.Fatalf("zip.OpenReader(%q): %v\n", name, err)
+	}
+
+	defer z.Close()
+
+	b, err := readZipFile(&z.Reader, "word/document.xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []*regexp.Regexp{
+		regexp.MustCompile(`<w:pStyle w:val="Heading1"/>`),
+		regexp.MustCompile(`<w:pStyle w:val="Epigraph"/>`),
+		regexp.MustCompile(`<w:pStyle w:val="BodyTextFirst"/>`),
+		regexp.MustCompile(`<w:pgMar\s[^>]*w:top="1440"`),
+		regexp.MustCompile(`<w:pgMar\s[^>]*w:left="1080"`),
+	}
+
+	for _, re := range tests {
+		if !re.Match(b) {
+			t.Errorf("word/document.xml does not match %s", re)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package export publishes manuscripts into other formats through the
+// exporters registered with it.
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"book/mom"
+)
+
+// Exporter publishes a manuscript into a given format. Exporters register
+// themselves via [RegisterExporter], typically from an init function, and are
+// then available to the pub command by their name.
+//
+// A new format can be added by a package that defines and registers the
+// exporter, which is then blank imported by the main package, without any
+// changes to the pub command itself.
+type Exporter interface {
+	// Name is the name of the format given to the -f flag of pub.
+	Name() string
+
+	// Ext is the file extension of the published file, without the leading
+	// dot.
+	Ext() string
+
+	// Export writes the manuscript to the given writer. The options given to
+	// pub are available from the context via [PubOptionsFrom].
+	Export(ctx context.Context, ms *mom.Manuscript, w io.Writer) error
+}
+
+// The engines used for publishing PDF files. The groff engine uses pdfmom,
+// and the native engine typesets the manuscript itself.
+const (
+	EngineGroff  = "groff"
+	EngineNative = "native"
+)
+
+var ErrEngine = errors.New("unrecognized engine, must be one of: [groff, native]")
+
+// PubOptions are the options given to the pub command that exporters may use.
+type PubOptions struct {
+	Layout *Layout
+
+	// Engine is the engine used for publishing pdf files, either groff or
+	// native. If empty, then groff is used if pdfmom can be found.
+	Engine string
+
+	// GroffArgs are additional flags given to groff.
+	GroffArgs []string
+
+	// Werror is whether groff warnings should be treated as errors.
+	Werror bool
+
+	// Stderr is where any diagnostics are written to.
+	Stderr io.Writer
+}
+
+type pubOptionsKey struct{}
+
+// WithPubOptions returns a copy of the context with the given options.
+func WithPubOptions(ctx context.Context, opts *PubOptions) context.Context {
+	return context.WithValue(ctx, pubOptionsKey{}, opts)
+}
+
+// PubOptionsFrom returns the options from the given context. If the context
+// has no options, then the defaults are returned.
+func PubOptionsFrom(ctx context.Context) *PubOptions {
+	if opts, ok := ctx.Value(pubOptionsKey{}).(*PubOptions); ok {
+		return opts
+	}
+	return &PubOptions{Stderr: os.Stderr}
+}
+
+// LayoutFor returns the layout to publish the manuscript with, falling back to
+// the layout derived from the manuscript itself if none was given.
+func (o *PubOptions) LayoutFor(ms *mom.Manuscript) (*Layout, error) {
+	if o.Layout != nil {
+		return o.Layout, nil
+	}
+
+	l, err := NewLayout(ms, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Date.IsZero() {
+		l.Date = time.Now()
+	}
+	return l, nil
+}
+
+var exporters = make(map[string]Exporter)
+
+// RegisterExporter registers the given exporter by its name. This panics if
+// an exporter by that name is already registered.
+func RegisterExporter(e Exporter) {
+	if _, ok := exporters[e.Name()]; ok {
+		panic("exporter already registered: " + e.Name())
+	}
+	exporters[e.Name()] = e
+}
+
+// LookupExporter returns the exporter registered by the given name.
+func LookupExporter(name string) (Exporter, bool) {
+	e, ok := exporters[name]
+	return e, ok
+}
+
+// Exporters returns every registered exporter, sorted by name.
+func Exporters() []Exporter {
+	ee := make([]Exporter, 0, len(exporters))
+
+	for _, e := range exporters {
+		ee = append(ee, e)
+	}
+
+	sort.Slice(ee, func(i, j int) bool {
+		return ee[i].Name() < ee[j].Name()
+	})
+	return ee
+}
+
+// Formats returns the names of every registered exporter, sorted by name.
+func Formats() []string {
+	names := make([]string, 0, len(exporters))
+
+	for _, e := range Exporters() {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// describer is implemented by exporters that can describe their format, this
+// is shown when listing the exporters.
+type describer interface {
+	Description() string
+}
+
+// Describe returns the description of the given exporter, if it has one.
+func Describe(e Exporter) string {
+	if d, ok := e.(describer); ok {
+		return d.Description()
+	}
+	return ""
+}
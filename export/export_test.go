@@ -0,0 +1,75 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/export"
+	"book/mom"
+)
+
+// titleExporter publishes only the title of the manuscript, it is registered
+// from outside of the export package the same way any other exporter would be.
+type titleExporter struct{}
+
+func (titleExporter) Name() string        { return "title" }
+func (titleExporter) Ext() string         { return "txt" }
+func (titleExporter) Description() string { return "Title of the manuscript" }
+
+func (titleExporter) Export(ctx context.Context, ms *mom.Manuscript, w io.Writer) error {
+	_, err := io.WriteString(w, ms.DocTitle()+"\n")
+	return err
+}
+
+func init() {
+	export.RegisterExporter(titleExporter{})
+}
+
+func TestRegisterExporter(t *testing.T) {
+	e, ok := export.LookupExporter("title")
+
+	if !ok {
+		t.Fatalf("LookupExporter(%q) = _, false, want = _, true", "title")
+	}
+
+	if diff := cmp.Diff([]string{"title"}, export.Formats()); diff != "" {
+		t.Errorf("Formats() mismatch (-want +got):\n%s", diff)
+	}
+
+	if got, want := export.Describe(e), "Title of the manuscript"; got != want {
+		t.Errorf("Describe(e) = %q, want = %q", got, want)
+	}
+
+	ms, err := mom.ParseManuscript(filepath.Join("..", "testdata", "dracula.mom"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := e.Export(context.Background(), ms, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := buf.String(), "DRACULA\n"; got != want {
+		t.Errorf("Export() = %q, want = %q", got, want)
+	}
+
+	if _, ok := export.LookupExporter("docx"); ok {
+		t.Errorf("LookupExporter(%q) = _, true, want = _, false", "docx")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterExporter(%q) did not panic for a duplicate exporter", "title")
+		}
+	}()
+
+	export.RegisterExporter(titleExporter{})
+}
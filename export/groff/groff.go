@@ -0,0 +1,309 @@
+// Package groff publishes manuscripts by running them through groff, and
+// registers the formats groff can produce as exporters.
+package groff
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"book/export"
+	"book/mom"
+)
+
+var ErrGroff = errors.New("groff failed")
+
+// Device is a format that is published via groff.
+type Device struct {
+	Format string // Format is the name given to the -f flag.
+	Desc   string
+	Suffix string // Suffix is the file extension of the published file.
+	Prog   string
+	Args   []string
+}
+
+func (d *Device) Name() string        { return d.Format }
+func (d *Device) Ext() string         { return d.Suffix }
+func (d *Device) Description() string { return d.Desc }
+
+// Export runs groff against the manuscript, along with any preprocessors the
+// manuscript needs, and the additional flags given via the options. The
+// additional flags are passed as is, so a preprocessor they already enable is
+// not enabled twice.
+func (d *Device) Export(ctx context.Context, ms *mom.Manuscript, w io.Writer) error {
+	opts := export.PubOptionsFrom(ctx)
+
+	l, err := opts.LayoutFor(ms)
+
+	if err != nil {
+		return err
+	}
+
+	args := slices.Clone(d.Args)
+
+	for _, flag := range Preprocessors(ms) {
+		if !slices.Contains(opts.GroffArgs, flag) {
+			args = append(args, flag)
+		}
+	}
+
+	args = append(args, opts.GroffArgs...)
+
+	return Run(ctx, w, opts.Stderr, ms, l.Date, opts.Werror, d.Prog, args...)
+}
+
+// PDF is the device for the pdf format when published via groff, this is
+// registered by the pdf exporter, which also handles the native engine.
+var PDF = &Device{
+	Format: "pdf",
+	Desc:   "PDF document, via pdfmom",
+	Suffix: "pdf",
+	Prog:   "pdfmom",
+	Args:   []string{"-k"},
+}
+
+func init() {
+	export.RegisterExporter(&Device{
+		Format: "ps",
+		Desc:   "PostScript document, via groff -Tps",
+		Suffix: "ps",
+		Prog:   "groff",
+		Args:   []string{"-k", "-mom", "-Tps"},
+	})
+	export.RegisterExporter(&Device{
+		Format: "txt",
+		Desc:   "Plain text for proofing in a terminal, via groff -Tutf8",
+		Suffix: "txt",
+		Prog:   "groff",
+		Args:   []string{"-k", "-mom", "-Tutf8"},
+	})
+	export.RegisterExporter(&Device{
+		Format: "groff-html",
+		Desc:   "HTML document, via groff -Thtml",
+		Suffix: "html",
+		Prog:   "groff",
+		Args:   []string{"-k", "-mom", "-Thtml"},
+	})
+}
+
+// preprocessors maps the macros that start a preprocessor block to the groff
+// flag that enables that preprocessor.
+var preprocessors = []struct {
+	macro string
+	flag  string
+}{
+	{"TS", "-t"}, // tbl
+	{"EQ", "-e"}, // eqn
+	{"PS", "-p"}, // pic
+	{"[", "-R"},  // refer
+	{"R1", "-R"},
+}
+
+// Preprocessors returns the groff flags for the preprocessors the manuscript
+// needs, based on the macros used within it.
+func Preprocessors(ms *mom.Manuscript) []string {
+	used := make(map[string]struct{})
+
+	for _, tok := range ms.Tokens {
+		if m, ok := tok.(*mom.Macro); ok {
+			used[m.Name] = struct{}{}
+		}
+	}
+
+	flags := make([]string, 0)
+
+	for _, p := range preprocessors {
+		if _, ok := used[p.macro]; !ok {
+			continue
+		}
+
+		if !slices.Contains(flags, p.flag) {
+			flags = append(flags, p.flag)
+		}
+	}
+	return flags
+}
+
+// Diagnostic is a warning or error reported by groff whilst publishing a
+// manuscript. The file and line of the diagnostic are those of the original
+// manuscript, rather than the temporary file given to groff. The line is 0 for
+// tokens that are not from the manuscript itself, such as the marker at the end
+// of a sample.
+type Diagnostic struct {
+	Program  string // Program is the groff program that reported it, such as troff.
+	File     string
+	Line     int
+	Chapter  string
+	Severity string // Severity is either warning or error.
+	Message  string
+}
+
+func (d *Diagnostic) String() string {
+	if d.File == "" {
+		return d.Message
+	}
+
+	s := fmt.Sprintf("%s:%d: %s: %s", d.File, d.Line, d.Severity, d.Message)
+
+	if d.Line == 0 {
+		s = fmt.Sprintf("%s: %s: %s", d.File, d.Severity, d.Message)
+	}
+
+	if d.Chapter != "" {
+		s += " (in " + d.Chapter + ")"
+	}
+	return s
+}
+
+// IsError returns whether the diagnostic is an error.
+func (d *Diagnostic) IsError() bool {
+	return d.Severity == "error" || d.Severity == "fatal error"
+}
+
+// reDiagnostic matches the diagnostics groff reports against a file, for
+// example,
+//
+//	troff: /tmp/dracula.pdf123:42: warning [p 3, 4.5i]: can't break line
+var reDiagnostic = regexp.MustCompile(`^([\w.-]+):\s*(.+?):(\d+):\s*(?:(warning|error|fatal error)(?:\s*\[[^\]]*\])?:\s*)?(.*)$`)
+
+// ParseDiagnostics parses the diagnostics from the given groff output. The
+// manuscript is what was written to the given temporary file, so the line
+// numbers of the temporary file are translated back to the lines of the
+// original manuscript, along with the chapter. Lines of the output that are
+// not diagnostics are kept as is, with only a message.
+func ParseDiagnostics(r io.Reader, tmp string, ms *mom.Manuscript) ([]*Diagnostic, error) {
+	chs, err := ms.Chapters()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The chapter of each token, named the same as elsewhere by
+	// [mom.Chapter.Name].
+	chapters := make(map[mom.Token]string)
+
+	for _, ch := range chs {
+		name := ch.Name()
+
+		for _, tok := range ch.Tokens {
+			chapters[tok] = name
+		}
+	}
+
+	diags := make([]*Diagnostic, 0)
+
+	sc := bufio.NewScanner(r)
+
+	for sc.Scan() {
+		line := sc.Text()
+
+		if line == "" {
+			continue
+		}
+
+		m := reDiagnostic.FindStringSubmatch(line)
+
+		if m == nil || m[2] != tmp {
+			diags = append(diags, &Diagnostic{Message: line})
+			continue
+		}
+
+		n, _ := strconv.Atoi(m[3])
+
+		d := Diagnostic{
+			Program:  m[1],
+			File:     ms.Name,
+			Line:     n,
+			Severity: m[4],
+			Message:  m[5],
+		}
+
+		// Only warnings are labelled by every version of groff.
+		if d.Severity == "" {
+			d.Severity = "error"
+		}
+
+		// Each token is written as a single line, so the line of the
+		// temporary file is the position of the token plus one.
+		if i := n - 1; i >= 0 && i < len(ms.Tokens) {
+			d.Line = ms.Line(ms.Tokens[i])
+			d.Chapter = chapters[ms.Tokens[i]]
+		}
+		diags = append(diags, &d)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return diags, nil
+}
+
+// Run writes the manuscript to a temporary file and runs the given groff
+// command against it, with the output written to w. The command is killed if
+// the context is done before it finishes. The diagnostics reported by groff
+// are written to stderr, against the original manuscript. An error is returned
+// if groff fails, or reports any errors. If werror is true, then warnings are
+// treated as errors.
+func Run(ctx context.Context, w, stderr io.Writer, ms *mom.Manuscript, date time.Time, werror bool, prog string, args ...string) error {
+	tmp, err := os.CreateTemp("", "book-*.mom")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := ms.WriteTo(tmp); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	c := exec.CommandContext(ctx, prog, append(args, tmp.Name())...)
+	c.Env = append(os.Environ(), "SOURCE_DATE_EPOCH="+strconv.FormatInt(date.Unix(), 10))
+	c.Stdout = w
+	c.Stderr = &buf
+
+	runErr := c.Run()
+
+	diags, err := ParseDiagnostics(&buf, tmp.Name(), ms)
+
+	if err != nil {
+		return err
+	}
+
+	errs, warns := 0, 0
+
+	for _, d := range diags {
+		fmt.Fprintln(stderr, d)
+
+		if d.IsError() {
+			errs++
+		} else if d.Severity == "warning" {
+			warns++
+		}
+	}
+
+	if werror {
+		errs += warns
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("%w: %d error(s), %d warning(s)", ErrGroff, errs, warns)
+	}
+
+	if runErr != nil {
+		return fmt.Errorf("%w: %v", ErrGroff, runErr)
+	}
+	return nil
+}
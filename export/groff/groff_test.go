@@ -0,0 +1,290 @@
+package groff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/export"
+	"book/mom"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "chapters.mom")
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		t.Fatalf("ParseManuscript(%q): %v\n", file, err)
+	}
+
+	chapters, err := ms.Chapters("2")
+
+	if err != nil {
+		t.Fatalf("ms.Chapters(%q): %v\n", "2", err)
+	}
+
+	// Only publish the second chapter, so the lines of the temporary file
+	// differ from those of the manuscript.
+	toks := make([]mom.Token, 0, len(ms.Tokens))
+
+	for _, tok := range ms.Tokens {
+		if m, ok := tok.(*mom.Macro); ok && m.Name == "CHAPTER" {
+			break
+		}
+		toks = append(toks, tok)
+	}
+
+	n := len(toks)
+
+	ms.Tokens = append(toks, chapters[0].Tokens...)
+
+	// The marker at the end of a sample is not from the manuscript, so has no
+	// line of its own.
+	ms.Tokens = append(ms.Tokens,
+		&mom.Macro{Raw: []rune(".PP"), Name: "PP"},
+		&mom.Text{Value: "[End of sample]"},
+	)
+
+	stderr := strings.Join([]string{
+		"troff: /tmp/book-1.mom:3: warning: macro 'FOO' not defined",
+		"troff:/tmp/book-1.mom:" + strconv.Itoa(n+5) + ": warning [p 2, 1.5i]: can't break line",
+		"troff: /tmp/book-1.mom:" + strconv.Itoa(n+5) + ": error: cannot open file",
+		"mom: something happened",
+		"troff: /tmp/book-1.mom:" + strconv.Itoa(len(ms.Tokens)) + ": warning: can't break line",
+		"",
+	}, "\n")
+
+	diags, err := ParseDiagnostics(strings.NewReader(stderr), "/tmp/book-1.mom", ms)
+
+	if err != nil {
+		t.Fatalf("ParseDiagnostics: %v\n", err)
+	}
+
+	want := []*Diagnostic{
+		{
+			Program:  "troff",
+			File:     file,
+			Line:     3,
+			Severity: "warning",
+			Message:  "macro 'FOO' not defined",
+		},
+		{
+			Program:  "troff",
+			File:     file,
+			Line:     30,
+			Chapter:  "THE SECOND",
+			Severity: "warning",
+			Message:  "can't break line",
+		},
+		{
+			Program:  "troff",
+			File:     file,
+			Line:     30,
+			Chapter:  "THE SECOND",
+			Severity: "error",
+			Message:  "cannot open file",
+		},
+		{
+			Message: "mom: something happened",
+		},
+		{
+			Program:  "troff",
+			File:     file,
+			Severity: "warning",
+			Message:  "can't break line",
+		},
+	}
+
+	if diff := cmp.Diff(want, diags); diff != "" {
+		t.Fatalf("ParseDiagnostics mismatch (-want +got):\n%s", diff)
+	}
+
+	if s, want := diags[1].String(), file+":30: warning: can't break line (in THE SECOND)"; s != want {
+		t.Errorf("diags[1].String() = %q, want = %q", s, want)
+	}
+
+	if s, want := diags[4].String(), file+": warning: can't break line"; s != want {
+		t.Errorf("diags[4].String() = %q, want = %q", s, want)
+	}
+
+	// A chapter given only by its title is named by its title.
+	for i, tok := range ms.Tokens {
+		if m, ok := tok.(*mom.Macro); ok && m.Name == "CHAPTER" {
+			ms.Tokens[i] = &mom.Macro{Raw: []rune(".PP"), Name: "PP"}
+		}
+	}
+
+	diags, err = ParseDiagnostics(strings.NewReader(stderr), "/tmp/book-1.mom", ms)
+
+	if err != nil {
+		t.Fatalf("ParseDiagnostics: %v\n", err)
+	}
+
+	if s, want := diags[1].String(), file+":30: warning: can't break line (in THE SECOND)"; s != want {
+		t.Errorf("diags[1].String() = %q, want = %q", s, want)
+	}
+
+	ms.Tokens = append(toks, chapters[0].Tokens...)
+
+	// Without a title the chapter is named by its number.
+	for i, tok := range ms.Tokens {
+		if m, ok := tok.(*mom.Macro); ok && m.Name == "CHAPTER_TITLE" {
+			ms.Tokens[i] = &mom.Macro{Raw: []rune(".PP"), Name: "PP"}
+		}
+	}
+
+	diags, err = ParseDiagnostics(strings.NewReader(stderr), "/tmp/book-1.mom", ms)
+
+	if err != nil {
+		t.Fatalf("ParseDiagnostics: %v\n", err)
+	}
+
+	if s, want := diags[1].String(), file+":30: warning: can't break line (in Chapter II)"; s != want {
+		t.Errorf("diags[1].String() = %q, want = %q", s, want)
+	}
+}
+
+func TestRunGroff(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+
+	dir := t.TempDir()
+
+	// The fake groff reports a warning against the sixteenth line of the
+	// file it is given, which is the CHAPTER macro of the first chapter.
+	script := "#!/bin/sh\nfor f; do :; done\necho \"troff: $f:16: warning: font 'X' not found\" >&2\necho output\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "groff"), []byte(script), 0755); err != nil {
+		t.Fatalf("os.WriteFile: %v\n", err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	file := filepath.Join("..", "..", "testdata", "chapters.mom")
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		t.Fatalf("ParseManuscript(%q): %v\n", file, err)
+	}
+
+	tests := []struct {
+		werror bool
+		err    error
+	}{
+		{false, nil},
+		{true, ErrGroff},
+	}
+
+	for _, test := range tests {
+		var out, stderr bytes.Buffer
+
+		err := Run(context.Background(), &out, &stderr, ms, time.Now(), test.werror, "groff", "-mom")
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("Run(werror=%v) = %v, want = %v", test.werror, err, test.err)
+		}
+
+		if got := out.String(); got != "output\n" {
+			t.Errorf("Run(werror=%v) output = %q, want = %q", test.werror, got, "output\n")
+		}
+
+		want := file + ":16: warning: font 'X' not found (in THE FIRST)\n"
+
+		if got := stderr.String(); got != want {
+			t.Errorf("Run(werror=%v) stderr = %q, want = %q", test.werror, got, want)
+		}
+	}
+}
+
+func TestGroffDeviceExport(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+
+	dir := t.TempDir()
+
+	// The fake groff prints the flags it is given, without the file.
+	script := "#!/bin/sh\nwhile [ $# -gt 1 ]; do echo \"$1\"; shift; done\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "groff"), []byte(script), 0755); err != nil {
+		t.Fatalf("os.WriteFile: %v\n", err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ms := &mom.Manuscript{
+		Tokens: []mom.Token{
+			&mom.Macro{Raw: []rune(".TS"), Name: "TS"},
+			&mom.Macro{Raw: []rune(".TE"), Name: "TE"},
+			&mom.Macro{Raw: []rune(".EQ"), Name: "EQ"},
+			&mom.Macro{Raw: []rune(".EN"), Name: "EN"},
+		},
+	}
+
+	d := &Device{
+		Format: "ps",
+		Prog:   "groff",
+		Args:   []string{"-k", "-mom", "-Tps"},
+	}
+
+	ctx := export.WithPubOptions(context.Background(), &export.PubOptions{
+		Layout:    &export.Layout{},
+		GroffArgs: []string{"-d", "a=1", "-d", "b=2", "-t"},
+		Stderr:    io.Discard,
+	})
+
+	var buf bytes.Buffer
+
+	if err := d.Export(ctx, ms, &buf); err != nil {
+		t.Fatalf("d.Export: %v\n", err)
+	}
+
+	want := []string{"-k", "-mom", "-Tps", "-e", "-d", "a=1", "-d", "b=2", "-t"}
+
+	if diff := cmp.Diff(want, strings.Fields(buf.String())); diff != "" {
+		t.Errorf("d.Export args mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPreprocessors(t *testing.T) {
+	macros := func(names ...string) *mom.Manuscript {
+		ms := &mom.Manuscript{}
+
+		for _, name := range names {
+			ms.Tokens = append(ms.Tokens, &mom.Macro{Name: name})
+		}
+		return ms
+	}
+
+	tests := []struct {
+		name string
+		ms   *mom.Manuscript
+		want []string
+	}{
+		{"none", macros("PP", "CHAPTER"), []string{}},
+		{"tbl", macros("PP", "TS", "TE"), []string{"-t"}},
+		{"eqn and pic", macros("PS", "PE", "EQ", "EN"), []string{"-e", "-p"}},
+		{"refer", macros("R1", "R2", "[", "]"), []string{"-R"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, Preprocessors(test.ms)); diff != "" {
+				t.Errorf("Preprocessors mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,555 @@
+package export
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"book/mom"
+)
+
+const (
+	ProfileDefault = "default"
+
+	// ProfileSMF is the Standard Manuscript Format as described by William
+	// Shunn, and as typically expected by agents and magazines.
+	ProfileSMF = "smf"
+)
+
+var ErrProfile = errors.New("unrecognized profile, must be one of: [default, smf]")
+
+// Contact is the contact information of the author, as placed on the first
+// page of a manuscript in the Standard Manuscript Format.
+type Contact struct {
+	Name    string
+	Address []string
+	Phone   string
+	Email   string
+}
+
+// Lines returns the lines of the contact block.
+func (c *Contact) Lines() []string {
+	lines := make([]string, 0, len(c.Address)+3)
+
+	for _, s := range append(append([]string{c.Name}, c.Address...), c.Phone, c.Email) {
+		if s != "" {
+			lines = append(lines, s)
+		}
+	}
+	return lines
+}
+
+// Paper is the size of a page in twips.
+type Paper struct {
+	Width  int
+	Height int
+}
+
+var Papers = map[string]Paper{
+	"a4":     {11906, 16838},
+	"a5":     {8391, 11906},
+	"letter": {12240, 15840},
+	"legal":  {12240, 20160},
+}
+
+// Margins of the page in twips.
+type Margins struct {
+	Top    int
+	Right  int
+	Bottom int
+	Left   int
+}
+
+const (
+	LineSpacing   = 480
+	SingleSpacing = 240
+	ParaIndent    = 567
+
+	// SMFIndent is the half inch first line indent used in the Standard
+	// Manuscript Format.
+	SMFIndent = 720
+
+	// SMFMargin is the one inch margin used in the Standard Manuscript Format.
+	SMFMargin = 1440
+
+	// SMFPageLines is the number of single spaced lines that fit on a page in
+	// the Standard Manuscript Format.
+	SMFPageLines = 46
+)
+
+// HeadingSize is the font size of chapter headings in half-points.
+const HeadingSize = 36
+
+// Points returns the given length in twips as points.
+func Points(n int) float64 {
+	return float64(n) / 20
+}
+
+// Layout controls how a manuscript is laid out when published. All lengths are
+// in twips, and all font sizes are in half-points.
+type Layout struct {
+	Profile string
+	Contact *Contact
+
+	Paper       string
+	Margins     Margins
+	Font        string
+	FontSize    int
+	LineSpacing int
+	Indent      int
+	HeadingSize int
+	TitleSize   int
+	Cover       bool
+
+	// Date is the time the manuscript was published at, this is used for any
+	// timestamps in the published file. See [SourceDate].
+	Date time.Time
+}
+
+// Setting is a single setting of a layout, as given via a flag or the layout
+// file of a manuscript.
+type Setting struct {
+	Key string
+	Val string
+}
+
+// families maps the font families of mom to their nearest equivalent fonts.
+var families = map[string]string{
+	"A":  "Century Gothic",
+	"B":  "Bookman Old Style",
+	"C":  "Courier New",
+	"H":  "Arial",
+	"HN": "Arial Narrow",
+	"N":  "Century Schoolbook",
+	"P":  "Palatino Linotype",
+	"T":  "Times New Roman",
+	"Z":  "Monotype Corsiva",
+}
+
+// parseLength parses the given length into twips. The length can be suffixed
+// with a unit, either in, cm, mm, pt, or P (picas). If no unit is given then
+// it is assumed to be in points.
+func parseLength(s string) (int, error) {
+	units := []struct {
+		suffix string
+		twips  float64
+	}{
+		{"in", 1440},
+		{"i", 1440},
+		{"cm", 1440 / 2.54},
+		{"c", 1440 / 2.54},
+		{"mm", 144 / 2.54},
+		{"pt", 20},
+		{"p", 20},
+		{"P", 240},
+	}
+
+	mult := 20.0
+
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSuffix(s, u.suffix)
+			mult = u.twips
+			break
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Round(f * mult)), nil
+}
+
+// parsePoints parses the given point size into half-points.
+func parsePoints(s string) (int, error) {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "pt"), 64)
+
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Round(f * 2)), nil
+}
+
+// Set sets the given layout setting to the given value.
+func (l *Layout) Set(key, val string) error {
+	var err error
+
+	switch key {
+	case "profile":
+		switch val {
+		case ProfileDefault:
+		case ProfileSMF:
+			l.Paper = "letter"
+			l.Font = families["C"]
+			l.Margins = Margins{SMFMargin, SMFMargin, SMFMargin, SMFMargin}
+			l.Indent = SMFIndent
+			l.LineSpacing = LineSpacing
+
+			if l.Contact == nil {
+				if l.Contact, err = GitContact(); err != nil {
+					return err
+				}
+			}
+		default:
+			return ErrProfile
+		}
+		l.Profile = val
+	case "paper":
+		val = strings.ToLower(val)
+
+		if _, ok := Papers[val]; !ok {
+			return fmt.Errorf("unrecognized paper %q, must be one of: [a4, a5, letter, legal]", val)
+		}
+		l.Paper = val
+	case "margins":
+		parts := strings.Fields(val)
+
+		if len(parts) != 1 && len(parts) != 4 {
+			return errors.New("margins must be either one length, or four for top, right, bottom, left")
+		}
+
+		lens := make([]int, 0, len(parts))
+
+		for _, part := range parts {
+			n, err := parseLength(part)
+
+			if err != nil {
+				return err
+			}
+			lens = append(lens, n)
+		}
+
+		if len(lens) == 1 {
+			lens = []int{lens[0], lens[0], lens[0], lens[0]}
+		}
+		l.Margins = Margins{lens[0], lens[1], lens[2], lens[3]}
+	case "font":
+		if font, ok := families[val]; ok {
+			val = font
+		}
+		l.Font = val
+	case "font-size":
+		l.FontSize, err = parsePoints(val)
+	case "spacing":
+		switch val {
+		case "single":
+			val = "1"
+		case "double":
+			val = "2"
+		}
+
+		var f float64
+
+		f, err = strconv.ParseFloat(val, 64)
+		l.LineSpacing = int(math.Round(f * SingleSpacing))
+	case "indent":
+		l.Indent, err = parseLength(val)
+	case "heading-size":
+		l.HeadingSize, err = parsePoints(val)
+	case "title-size":
+		l.TitleSize, err = parsePoints(val)
+	case "cover":
+		switch val {
+		case "on", "true", "yes":
+			l.Cover = true
+		case "off", "false", "no":
+			l.Cover = false
+		default:
+			return fmt.Errorf("cover must be either on or off")
+		}
+	default:
+		return fmt.Errorf("unrecognized layout setting %q", key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// GitConfig returns all of the values for the given key from the git
+// configuration. If the key is not set, then nil is returned.
+func GitConfig(key string) ([]string, error) {
+	out, err := exec.Command("git", "config", "--get-all", key).Output()
+
+	if err != nil {
+		var exitErr *exec.ExitError
+
+		// An exit status of 1 means the key was not set.
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"), nil
+}
+
+// GitContact returns the contact information of the author from the git
+// configuration. This is taken from the following keys,
+//
+//	book.name    - The legal name of the author, defaults to user.name
+//	book.address - The address, this can be given multiple times, one for each
+//	               line
+//	book.phone   - The phone number
+//	book.email   - The email address, defaults to user.email
+func GitContact() (*Contact, error) {
+	get := func(keys ...string) (string, error) {
+		for _, key := range keys {
+			vals, err := GitConfig(key)
+
+			if err != nil {
+				return "", err
+			}
+
+			if len(vals) > 0 {
+				return vals[len(vals)-1], nil
+			}
+		}
+		return "", nil
+	}
+
+	var (
+		c   Contact
+		err error
+	)
+
+	if c.Name, err = get("book.name", "user.name"); err != nil {
+		return nil, err
+	}
+
+	if c.Address, err = GitConfig("book.address"); err != nil {
+		return nil, err
+	}
+
+	if c.Phone, err = get("book.phone"); err != nil {
+		return nil, err
+	}
+
+	if c.Email, err = get("book.email", "user.email"); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ReadLayoutFile reads the layout settings from the given file. Each line of
+// the file is a setting, followed by its value, for example,
+//
+//	paper     letter
+//	margins   1in
+//	font      Courier New
+//	font-size 12
+//	spacing   1.5
+//
+// Lines starting with a # are ignored. If the file does not exist, then no
+// settings are returned.
+func ReadLayoutFile(name string) ([]Setting, error) {
+	f, err := os.Open(name)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	defer f.Close()
+
+	settings := make([]Setting, 0)
+
+	sc := bufio.NewScanner(f)
+	line := 0
+
+	for sc.Scan() {
+		line++
+
+		s := strings.TrimSpace(sc.Text())
+
+		if s == "" || s[0] == '#' {
+			continue
+		}
+
+		key, val, _ := strings.Cut(s, " ")
+		val = strings.TrimSpace(val)
+
+		if val == "" {
+			return nil, fmt.Errorf("%s:%d: no value for %s", name, line, key)
+		}
+		settings = append(settings, Setting{Key: key, Val: val})
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// NewLayout returns the layout for the given manuscript. The defaults of the
+// layout are derived from the PAPER, PRINTSTYLE, and FAMILY macros of the
+// manuscript. The given settings are then applied in order, with the exception
+// of the profile which is applied first, so the other settings can override
+// the defaults of the profile.
+func NewLayout(ms *mom.Manuscript, settings []Setting) (*Layout, error) {
+	l := Layout{
+		Profile:     ProfileDefault,
+		Paper:       "a4",
+		Font:        "Times New Roman",
+		FontSize:    24,
+		LineSpacing: LineSpacing,
+		Indent:      ParaIndent,
+		HeadingSize: HeadingSize,
+		TitleSize:   HeadingSize,
+		Cover:       true,
+	}
+
+	if paper := strings.ToLower(ms.Expand(ms.Get("PAPER"))); paper != "" {
+		if _, ok := Papers[paper]; ok {
+			l.Paper = paper
+		}
+	}
+
+	if ms.Expand(ms.PrintStyle()) == "TYPEWRITE" {
+		l.Font = families["C"]
+	}
+
+	if family := ms.Expand(ms.Get("FAMILY")); family != "" {
+		l.Set("font", family)
+	}
+
+	for i := len(settings) - 1; i >= 0; i-- {
+		if settings[i].Key == "profile" {
+			if err := l.Set("profile", settings[i].Val); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	explicit := make(map[string]bool)
+
+	for _, s := range settings {
+		if s.Key == "profile" {
+			continue
+		}
+
+		if err := l.Set(s.Key, s.Val); err != nil {
+			return nil, err
+		}
+		explicit[s.Key] = true
+	}
+
+	// Headings and the title in the Standard Manuscript Format are the same
+	// size as the text, so are derived once the font size is known.
+	if l.Profile == ProfileSMF {
+		if !explicit["heading-size"] {
+			l.HeadingSize = l.FontSize
+		}
+
+		if !explicit["title-size"] {
+			l.TitleSize = l.FontSize
+		}
+	}
+	return &l, nil
+}
+
+// SMFWordsPerPage is the number of words per page conventionally assumed for
+// a manuscript in the Standard Manuscript Format.
+const SMFWordsPerPage = 250
+
+// PageMetrics returns the number of lines that fit on a page of the layout,
+// and the number of words that fit on each of those lines. These are rough
+// estimates, based off an average character width of half the font size, and
+// an average word length of five characters plus a space.
+func (l *Layout) PageMetrics() (float64, float64) {
+	if l.Profile == ProfileSMF {
+		lines := float64(SMFPageLines * SingleSpacing / LineSpacing)
+		return lines, SMFWordsPerPage / lines
+	}
+
+	paper := Papers[l.Paper]
+	margins := l.Margins
+
+	if margins == (Margins{}) {
+		margins = Margins{
+			Top:    SMFMargin,
+			Right:  SMFMargin,
+			Bottom: SMFMargin,
+			Left:   SMFMargin,
+		}
+	}
+
+	size := float64(l.FontSize) / 2
+	leading := size * 1.2 * float64(l.LineSpacing) / SingleSpacing
+
+	width := Points(paper.Width - margins.Left - margins.Right)
+	height := Points(paper.Height - margins.Top - margins.Bottom)
+
+	lines := math.Max(1, math.Floor(height/leading))
+	words := math.Max(1, width/(size/2)/6)
+
+	return lines, words
+}
+
+// CoverWords returns the word count of the manuscript as given on the first
+// page in the Standard Manuscript Format, such as "About 80,000 words".
+func CoverWords(ms *mom.Manuscript) string {
+	s := strconv.Itoa(approxWords(ms.WordCount()))
+
+	for i := len(s); i > 3; {
+		i -= 3
+		s = s[:i] + "," + s[i:]
+	}
+	return "About " + s + " words"
+}
+
+// approxWords returns the given word count rounded the way it would be for the
+// first page of a manuscript in the Standard Manuscript Format.
+func approxWords(n int) int {
+	round := 1000
+
+	if n < 10000 {
+		round = 100
+	}
+
+	n = (n + round/2) / round * round
+
+	if n == 0 {
+		n = round
+	}
+	return n
+}
+
+// SourceDate returns the date to use for the timestamps of the given
+// manuscript when published. This is taken from the SOURCE_DATE_EPOCH
+// environment variable if set, otherwise the time of the last git commit to
+// the manuscript. If neither are available, then the current time is used.
+func SourceDate(file string) (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+
+	if epoch == "" {
+		out, err := exec.Command("git", "log", "-1", "--format=%ct", "--", file).Output()
+
+		if err != nil {
+			return time.Now(), nil
+		}
+		epoch = strings.TrimSpace(string(out))
+	}
+
+	if epoch == "" {
+		return time.Now(), nil
+	}
+
+	sec, err := strconv.ParseInt(epoch, 10, 64)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", epoch, err)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
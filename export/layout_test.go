@@ -0,0 +1,214 @@
+package export
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/mom"
+)
+
+func TestApproxWords(t *testing.T) {
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{8, 100},
+		{149, 100},
+		{150, 200},
+		{9949, 9900},
+		{11219, 11000},
+		{87501, 88000},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d", test.n), func(t *testing.T) {
+			if got := approxWords(test.n); got != test.want {
+				t.Errorf("approxWords(%d) = %d, want = %d", test.n, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		str  string
+		want int
+	}{
+		{"1in", 1440},
+		{"1i", 1440},
+		{"2.54cm", 1440},
+		{"25.4mm", 1440},
+		{"12pt", 240},
+		{"12", 240},
+		{"1P", 240},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str, func(t *testing.T) {
+			got, err := parseLength(test.str)
+
+			if err != nil {
+				t.Fatalf("parseLength(%q): %v\n", test.str, err)
+			}
+
+			if got != test.want {
+				t.Errorf("parseLength(%q) = %d, want = %d", test.str, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewLayout(t *testing.T) {
+	tests := []struct {
+		file     string
+		settings []Setting
+		want     Layout
+	}{
+		{
+			"dracula.mom",
+			nil,
+			Layout{
+				Profile:     ProfileDefault,
+				Paper:       "a4",
+				Font:        "Times New Roman",
+				FontSize:    24,
+				LineSpacing: 480,
+				Indent:      567,
+				HeadingSize: 36,
+				TitleSize:   36,
+				Cover:       true,
+			},
+		},
+		{
+			"chapters.mom",
+			[]Setting{
+				{"paper", "letter"},
+				{"margins", "1in 0.5in 1in 0.5in"},
+				{"spacing", "1.5"},
+				{"font-size", "11"},
+				{"cover", "off"},
+			},
+			Layout{
+				Profile:     ProfileDefault,
+				Paper:       "letter",
+				Margins:     Margins{1440, 720, 1440, 720},
+				Font:        "Courier New",
+				FontSize:    22,
+				LineSpacing: 360,
+				Indent:      567,
+				HeadingSize: 36,
+				TitleSize:   36,
+			},
+		},
+		{
+			"chapters.mom",
+			[]Setting{
+				{"font", "P"},
+				{"profile", "smf"},
+				{"indent", "0.25in"},
+			},
+			Layout{
+				Profile:     ProfileSMF,
+				Paper:       "letter",
+				Margins:     Margins{1440, 1440, 1440, 1440},
+				Font:        "Palatino Linotype",
+				FontSize:    24,
+				LineSpacing: 480,
+				Indent:      360,
+				HeadingSize: 24,
+				TitleSize:   24,
+				Cover:       true,
+			},
+		},
+		{
+			"chapters.mom",
+			[]Setting{
+				{"profile", "smf"},
+			},
+			Layout{
+				Profile:     ProfileSMF,
+				Paper:       "letter",
+				Margins:     Margins{1440, 1440, 1440, 1440},
+				Font:        "Courier New",
+				FontSize:    24,
+				LineSpacing: 480,
+				Indent:      720,
+				HeadingSize: 24,
+				TitleSize:   24,
+				Cover:       true,
+			},
+		},
+		{
+			"chapters.mom",
+			[]Setting{
+				{"profile", "smf"},
+				{"font-size", "14"},
+				{"title-size", "16"},
+			},
+			Layout{
+				Profile:     ProfileSMF,
+				Paper:       "letter",
+				Margins:     Margins{1440, 1440, 1440, 1440},
+				Font:        "Courier New",
+				FontSize:    28,
+				LineSpacing: 480,
+				Indent:      720,
+				HeadingSize: 28,
+				TitleSize:   32,
+				Cover:       true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			path := filepath.Join("..", "testdata", test.file)
+
+			ms, err := mom.ParseManuscript(path)
+
+			if err != nil {
+				t.Fatalf("ParseManuscript(%q): %v\n", path, err)
+			}
+
+			l, err := NewLayout(ms, test.settings)
+
+			if err != nil {
+				t.Fatalf("NewLayout(%q, %v): %v\n", path, test.settings, err)
+			}
+
+			// The contact is taken from the git configuration, so we don't
+			// check it here.
+			l.Contact = nil
+
+			if diff := cmp.Diff(test.want, *l); diff != "" {
+				t.Errorf("NewLayout(%q, %v) mismatch (-want +got):\n%s", path, test.settings, diff)
+			}
+		})
+	}
+}
+
+func TestSourceDate(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	file := filepath.Join("..", "testdata", "dracula.mom")
+
+	got, err := SourceDate(file)
+
+	if err != nil {
+		t.Fatalf("SourceDate(%q): %v\n", file, err)
+	}
+
+	if want := time.Unix(1700000000, 0).UTC(); !got.Equal(want) {
+		t.Errorf("SourceDate(%q) = %s, want = %s", file, got, want)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+
+	if _, err := SourceDate(file); err == nil {
+		t.Errorf("SourceDate(%q) expected error for invalid SOURCE_DATE_EPOCH", file)
+	}
+}
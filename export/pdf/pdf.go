@@ -0,0 +1,949 @@
+// Package pdf publishes manuscripts as PDF documents, either via groff or by
+// typesetting them natively, and registers the pdf exporter.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/md5"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"book/export"
+	"book/export/groff"
+	"book/mom"
+)
+
+// pdfExporter publishes pdf files via either engine.
+type pdfExporter struct{}
+
+func (pdfExporter) Name() string { return "pdf" }
+func (pdfExporter) Ext() string  { return "pdf" }
+
+func (pdfExporter) Description() string {
+	return "PDF document, via pdfmom or the native engine"
+}
+
+// Export publishes the manuscript with the engine given in the options. If no
+// engine is given, then the native engine is used when pdfmom cannot be found.
+func (pdfExporter) Export(ctx context.Context, ms *mom.Manuscript, w io.Writer) error {
+	opts := export.PubOptionsFrom(ctx)
+
+	engine := opts.Engine
+
+	if engine == "" {
+		engine = export.EngineGroff
+
+		if _, err := exec.LookPath(groff.PDF.Prog); err != nil {
+			engine = export.EngineNative
+		}
+	}
+
+	switch engine {
+	case export.EngineGroff:
+		return groff.PDF.Export(ctx, ms, w)
+	case export.EngineNative:
+		l, err := opts.LayoutFor(ms)
+
+		if err != nil {
+			return err
+		}
+		return WriteToPDF(w, ms, l)
+	}
+	return export.ErrEngine
+}
+
+func init() {
+	export.RegisterExporter(pdfExporter{})
+}
+
+//go:embed fonts/DejaVuSerif.ttf
+var fontSerif []byte
+
+//go:embed fonts/DejaVuSerif-Bold.ttf
+var fontSerifBold []byte
+
+// obliqueSkew is the horizontal skew applied to the upright faces for italic
+// text, as there are no italic faces embedded. This is roughly a 12 degree
+// slant.
+const obliqueSkew = 0.21
+
+func pdfNum(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 2, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+// pdfString returns the given string as a PDF string literal. Strings that are
+// not plain ASCII are encoded as UTF-16.
+func pdfString(s string) string {
+	ascii := true
+
+	for _, r := range s {
+		if r < ' ' || r > '~' {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+	}
+
+	var buf strings.Builder
+
+	buf.WriteString("<FEFF")
+
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&buf, "%04X", u)
+	}
+
+	buf.WriteString(">")
+	return buf.String()
+}
+
+// pdfWriter writes the objects of a PDF file. Each object is allocated its
+// number up front, so it can be referenced before it is written.
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+func newPDFWriter() *pdfWriter {
+	w := pdfWriter{}
+	w.buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	return &w
+}
+
+func (w *pdfWriter) alloc() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+func (w *pdfWriter) object(n int, s string) {
+	w.offsets[n-1] = w.buf.Len()
+
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", n, s)
+}
+
+// stream writes a compressed stream object, with the given entries added to
+// its dictionary.
+func (w *pdfWriter) stream(n int, dict string, data []byte) error {
+	var z bytes.Buffer
+
+	zw := zlib.NewWriter(&z)
+
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	w.offsets[n-1] = w.buf.Len()
+
+	fmt.Fprintf(&w.buf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode%s >>\nstream\n", n, z.Len(), dict)
+	w.buf.Write(z.Bytes())
+	w.buf.WriteString("\nendstream\nendobj\n")
+	return nil
+}
+
+// finish writes the cross-reference table and trailer, and returns the final
+// file. The file ID is derived from the content so the same document always
+// gives the same file.
+func (w *pdfWriter) finish(root, info int) []byte {
+	xref := w.buf.Len()
+
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+
+	for _, off := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", off)
+	}
+
+	id := md5.Sum(w.buf.Bytes())
+
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R /ID [<%x> <%x>] >>\n", len(w.offsets)+1, root, info, id, id)
+	fmt.Fprintf(&w.buf, "startxref\n%d\n%%%%EOF\n", xref)
+
+	return w.buf.Bytes()
+}
+
+// pdfFont is a font used within a PDF. The glyphs used are tracked so only
+// those are embedded.
+type pdfFont struct {
+	*Font
+
+	// Res is the name of the font in the resources of each page.
+	Res string
+
+	used map[uint16]rune
+}
+
+func newPDFFont(f *Font, res string) *pdfFont {
+	return &pdfFont{
+		Font: f,
+		Res:  res,
+		used: make(map[uint16]rune),
+	}
+}
+
+// encode returns the given string encoded as a hex string of glyph IDs.
+func (pf *pdfFont) encode(s string) string {
+	var buf strings.Builder
+
+	buf.WriteByte('<')
+
+	for _, r := range s {
+		g := pf.Glyph(r)
+
+		if _, ok := pf.used[g]; !ok {
+			pf.used[g] = r
+		}
+		fmt.Fprintf(&buf, "%04X", g)
+	}
+
+	buf.WriteByte('>')
+	return buf.String()
+}
+
+// embed writes the font as a subset of the glyphs used, and returns the number
+// of the font object.
+func (w *pdfWriter) embed(pf *pdfFont) (int, error) {
+	glyphs := make([]uint16, 0, len(pf.used))
+	set := make(map[uint16]struct{})
+
+	for g := range pf.used {
+		glyphs = append(glyphs, g)
+		set[g] = struct{}{}
+	}
+
+	sort.Slice(glyphs, func(i, j int) bool {
+		return glyphs[i] < glyphs[j]
+	})
+
+	// The subset tag is derived from the glyphs used, so the same text
+	// always gives the same tag.
+	var key []byte
+
+	for _, g := range glyphs {
+		key = binary.BigEndian.AppendUint16(key, g)
+	}
+
+	sum := md5.Sum(key)
+
+	tag := make([]byte, 6)
+
+	for i := range tag {
+		tag[i] = 'A' + sum[i]%26
+	}
+
+	name := string(tag) + "+" + pf.Name
+	scale := 1000 / float64(pf.UnitsPerEm)
+
+	font := w.alloc()
+	cid := w.alloc()
+	desc := w.alloc()
+	file := w.alloc()
+	cmap := w.alloc()
+
+	subset := pf.Subset(set)
+
+	if err := w.stream(file, fmt.Sprintf(" /Length1 %d", len(subset)), subset); err != nil {
+		return 0, err
+	}
+
+	w.object(desc, fmt.Sprintf(
+		"<< /Type /FontDescriptor /FontName /%s /Flags 34 /FontBBox [%s %s %s %s] /ItalicAngle 0 /Ascent %s /Descent %s /CapHeight %s /StemV 80 /FontFile2 %d 0 R >>",
+		name,
+		pdfNum(float64(pf.BBox[0])*scale),
+		pdfNum(float64(pf.BBox[1])*scale),
+		pdfNum(float64(pf.BBox[2])*scale),
+		pdfNum(float64(pf.BBox[3])*scale),
+		pdfNum(float64(pf.Ascent)*scale),
+		pdfNum(float64(pf.Descent)*scale),
+		pdfNum(float64(pf.CapHeight)*scale),
+		file,
+	))
+
+	var widths strings.Builder
+
+	for _, g := range glyphs {
+		fmt.Fprintf(&widths, "%d [%s] ", g, pdfNum(float64(pf.Advance(g))*scale))
+	}
+
+	w.object(cid, fmt.Sprintf(
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /W [%s] /CIDToGIDMap /Identity >>",
+		name,
+		desc,
+		strings.TrimSpace(widths.String()),
+	))
+
+	// The ToUnicode map allows for the text to be searched and copied.
+	var buf bytes.Buffer
+
+	buf.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	buf.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	buf.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	buf.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	for i := 0; i < len(glyphs); i += 100 {
+		chunk := glyphs[i:min(i+100, len(glyphs))]
+
+		fmt.Fprintf(&buf, "%d beginbfchar\n", len(chunk))
+
+		for _, g := range chunk {
+			fmt.Fprintf(&buf, "<%04X> <", g)
+
+			for _, u := range utf16.Encode([]rune{pf.used[g]}) {
+				fmt.Fprintf(&buf, "%04X", u)
+			}
+			buf.WriteString(">\n")
+		}
+		buf.WriteString("endbfchar\n")
+	}
+
+	buf.WriteString("endcmap\nCMapName currentdict /CMapResource defineresource pop\nend\nend\n")
+
+	if err := w.stream(cmap, "", buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	w.object(font, fmt.Sprintf(
+		"<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name,
+		cid,
+		cmap,
+	))
+	return font, nil
+}
+
+// span is a run of text within a word that is set in the same face.
+type span struct {
+	text   string
+	bold   bool
+	italic bool
+}
+
+// word is a sequence of spans that cannot be broken across lines.
+type word []span
+
+// Typesetter lays out the text of a manuscript onto the pages of a PDF. All
+// lengths are in points, with the origin of each page at its bottom left.
+type Typesetter struct {
+	Width  float64
+	Height float64
+
+	Top    float64
+	Right  float64
+	Bottom float64
+	Left   float64
+
+	// Size is the font size of the body text.
+	Size float64
+
+	regular *pdfFont
+	bold    *pdfFont
+
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+
+	// y is the position of the top of the next line on the current page.
+	y float64
+}
+
+// NewPage starts a new page.
+func (ts *Typesetter) NewPage() {
+	ts.page = &bytes.Buffer{}
+	ts.pages = append(ts.pages, ts.page)
+	ts.y = ts.Height - ts.Top
+}
+
+// Break starts a new page, unless nothing has been set on the current page.
+func (ts *Typesetter) Break() {
+	if ts.page == nil || ts.y < ts.Height-ts.Top {
+		ts.NewPage()
+	}
+}
+
+// need starts a new page if there is not enough room left on the current page
+// for the given height.
+func (ts *Typesetter) need(h float64) {
+	if ts.y-h < ts.Bottom-0.01 {
+		ts.NewPage()
+	}
+}
+
+func (ts *Typesetter) size(st *export.Style) float64 {
+	if st.Size > 0 {
+		return float64(st.Size) / 2
+	}
+	return ts.Size
+}
+
+func (ts *Typesetter) leading(st *export.Style) float64 {
+	spacing := st.Spacing
+
+	if spacing == 0 {
+		spacing = export.SingleSpacing
+	}
+	return ts.size(st) * 1.2 * float64(spacing) / export.SingleSpacing
+}
+
+func (ts *Typesetter) font(sp span) *pdfFont {
+	if sp.bold {
+		return ts.bold
+	}
+	return ts.regular
+}
+
+func (ts *Typesetter) wordWidth(w word, size float64) float64 {
+	width := 0.0
+
+	for _, sp := range w {
+		width += ts.font(sp).Width(sp.text, size)
+	}
+	return width
+}
+
+// words splits the given text into words, formatting it as per the inline
+// escape macros within the text.
+func (ts *Typesetter) words(txt string, bold, italic bool) []word {
+	var (
+		words []word
+		cur   word
+	)
+
+	b, i := bold, italic
+
+	add := func(s string) {
+		for _, r := range s {
+			if r == ' ' || r == '\t' {
+				if len(cur) > 0 {
+					words = append(words, cur)
+					cur = nil
+				}
+				continue
+			}
+
+			if n := len(cur); n > 0 && cur[n-1].bold == b && cur[n-1].italic == i {
+				cur[n-1].text += string(r)
+				continue
+			}
+			cur = append(cur, span{text: string(r), bold: b, italic: i})
+		}
+	}
+
+	for _, tok := range mom.Tokenize(txt) {
+		switch v := tok.(type) {
+		case *mom.Inline:
+			switch v.Escape {
+			case "IT":
+				i = true
+			case "BD":
+				b = true
+			case "BDI":
+				b, i = true, true
+			case "PREV", "ROM", "R":
+				b, i = bold, italic
+			case "lq":
+				add("“")
+			case "rq":
+				add("”")
+			}
+		case *mom.Text:
+			add(v.Value)
+		}
+	}
+
+	if len(cur) > 0 {
+		words = append(words, cur)
+	}
+	return words
+}
+
+// draw draws the given words as a single line onto the given page, returning
+// the position at the end of the line.
+func (ts *Typesetter) draw(page *bytes.Buffer, words []word, x, y, size, gap float64) float64 {
+	for i, w := range words {
+		if i > 0 {
+			x += gap
+		}
+
+		for _, sp := range w {
+			f := ts.font(sp)
+			skew := 0.0
+
+			if sp.italic {
+				skew = obliqueSkew
+			}
+
+			fmt.Fprintf(page, "BT /%s %s Tf 1 0 %s 1 %s %s Tm %s Tj ET\n", f.Res, pdfNum(size), pdfNum(skew), pdfNum(x), pdfNum(y), f.encode(sp.text))
+
+			x += f.Width(sp.text, size)
+		}
+	}
+	return x
+}
+
+// Place sets the given text as a single line on the given page, with its
+// baseline at the given position. This is used for text outside of the body
+// of the page, such as headers and footers.
+func (ts *Typesetter) Place(page *bytes.Buffer, txt, align string, y float64) {
+	words := ts.words(txt, false, false)
+	space := ts.regular.Width(" ", ts.Size)
+
+	width := 0.0
+
+	for i, w := range words {
+		if i > 0 {
+			width += space
+		}
+		width += ts.wordWidth(w, ts.Size)
+	}
+
+	x := ts.Left
+	avail := ts.Width - ts.Left - ts.Right
+
+	switch align {
+	case "center":
+		x += (avail - width) / 2
+	case "right":
+		x += avail - width
+	}
+	ts.draw(page, words, x, y, ts.Size, space)
+}
+
+// Line sets the given text as a paragraph in the given style, without any
+// inline formatting beyond that of the style.
+func (ts *Typesetter) Line(txt string, st *export.Style) {
+	ts.Paragraph(ts.words(txt, st.Bold, st.Italic), st, st.Align, "", 0)
+}
+
+// Paragraph sets the given words as a paragraph in the given style. The
+// alignment is either left, center, right, or empty for justified. If a drop
+// cap is given then it is dropped into the given number of lines.
+func (ts *Typesetter) Paragraph(words []word, st *export.Style, align, dropcap string, drop int) {
+	size := ts.size(st)
+	leading := ts.leading(st)
+	space := ts.regular.Width(" ", size)
+	descent := float64(-ts.regular.Descent) * size / float64(ts.regular.UnitsPerEm)
+
+	left := ts.Left + export.Points(st.Left)
+	width := ts.Width - left - ts.Right - export.Points(st.Right)
+	indent := export.Points(st.Indent)
+
+	var (
+		inset    float64
+		dropSize float64
+	)
+
+	if dropcap == "" {
+		drop = 0
+	}
+
+	if drop > 0 {
+		// The drop cap is sized so its cap height spans from the top of
+		// the first line to the baseline of the last line it drops into.
+		capHeight := float64(ts.regular.CapHeight) / float64(ts.regular.UnitsPerEm)
+
+		dropSize = (float64(drop-1)*leading + capHeight*size) / capHeight
+		inset = ts.regular.Width(dropcap, dropSize) + space
+		indent = 0
+
+		ts.need(float64(drop) * leading)
+	}
+
+	avail := func(n int) float64 {
+		w := width
+
+		if n == 0 {
+			w -= indent
+		}
+
+		if n < drop {
+			w -= inset
+		}
+		return w
+	}
+
+	type line struct {
+		words []word
+		width float64
+	}
+
+	var (
+		lines []line
+		cur   line
+	)
+
+	for _, w := range words {
+		ww := ts.wordWidth(w, size)
+
+		if len(cur.words) > 0 && cur.width+space+ww > avail(len(lines)) {
+			lines = append(lines, cur)
+			cur = line{}
+		}
+
+		if len(cur.words) > 0 {
+			cur.width += space
+		}
+
+		cur.words = append(cur.words, w)
+		cur.width += ww
+	}
+
+	if len(cur.words) > 0 {
+		lines = append(lines, cur)
+	}
+
+	top := ts.y
+
+	for i, ln := range lines {
+		ts.need(leading)
+
+		if i == 0 {
+			top = ts.y
+		}
+
+		x := left
+		w := avail(i)
+
+		if i == 0 {
+			x += indent
+		}
+
+		if i < drop {
+			x += inset
+		}
+
+		gap := space
+
+		switch align {
+		case "center":
+			x += (w - ln.width) / 2
+		case "right":
+			x += w - ln.width
+		case "left":
+		default:
+			// The last line of a justified paragraph is set flush left.
+			if i < len(lines)-1 && len(ln.words) > 1 {
+				gap += (w - ln.width) / float64(len(ln.words)-1)
+			}
+		}
+
+		ts.draw(ts.page, ln.words, x, ts.y-leading+descent, size, gap)
+		ts.y -= leading
+	}
+
+	if drop > 0 {
+		baseline := top - float64(drop)*leading + descent
+
+		ts.draw(ts.page, []word{{{text: dropcap}}}, left, baseline, dropSize, 0)
+
+		// Make sure the next paragraph does not run into the drop cap if
+		// this paragraph is shorter than it.
+		ts.y = min(ts.y, top-float64(drop)*leading)
+	}
+}
+
+// Cover sets the cover page of the manuscript, with the title and author a
+// third of the way down the page, and the copyright at the foot of the page.
+func (ts *Typesetter) Cover(ms *mom.Manuscript, l *export.Layout, styles map[string]*export.Style) {
+	ts.y -= (ts.Height - ts.Top - ts.Bottom) / 3
+
+	ts.Line(ms.DocTitle(), styles[export.StyleTitle])
+	ts.Line("by", styles[export.StyleSubtitle])
+	ts.Line(ms.Author(), styles[export.StyleSubtitle])
+
+	copyright := ms.Copyright()
+
+	if copyright == "" {
+		copyright = fmt.Sprintf("%d %s", l.Date.Year(), ms.Author())
+	}
+	ts.Place(ts.page, "© "+copyright, "right", ts.Bottom/2)
+}
+
+// SMFCover sets the first page of the manuscript in the Standard Manuscript
+// Format, the same as the docx exporter does.
+func (ts *Typesetter) SMFCover(ms *mom.Manuscript, l *export.Layout, styles map[string]*export.Style) {
+	wc := export.CoverWords(ms)
+
+	st := styles[export.StyleContact]
+
+	// The word count is set on the first line of the contact block.
+	top := ts.y
+	descent := float64(-ts.regular.Descent) * ts.size(st) / float64(ts.regular.UnitsPerEm)
+
+	ts.Place(ts.page, wc, "right", top-ts.leading(st)+descent)
+
+	lines := l.Contact.Lines()
+
+	if len(lines) == 0 {
+		ts.y -= ts.leading(st)
+	}
+
+	for _, line := range lines {
+		ts.Line(line, st)
+	}
+
+	ts.y = ts.Height - ts.Top - (ts.Height-ts.Top-ts.Bottom)/2
+
+	ts.Line(ms.DocTitle(), styles[export.StyleTitle])
+	ts.Line("by "+ms.Author(), styles[export.StyleSubtitle])
+}
+
+// Headers sets the running headers and footers on each page of the body of
+// the manuscript, starting from the given page. These follow the same rules as
+// the headers of the docx exporter.
+func (ts *Typesetter) Headers(ms *mom.Manuscript, smf bool, from int) error {
+	pages := ts.pages[from:]
+
+	hdr := ts.Height - ts.Top/2
+	ftr := ts.Bottom / 2
+
+	if smf {
+		for i, page := range pages {
+			ts.Place(page, fmt.Sprintf("%s / %d", export.SMFHeader(ms), i+1), "right", hdr)
+		}
+		return nil
+	}
+
+	hs, err := export.RunningHeaders(ms)
+
+	if err != nil {
+		return err
+	}
+
+	for i, page := range pages {
+		h := hs.Recto
+
+		if (i+1)%2 == 0 {
+			h = hs.Verso
+		}
+
+		if h != nil {
+			ts.Place(page, h.Text, h.Align, hdr)
+		}
+		ts.Place(page, fmt.Sprintf("%d of %d", i+1, len(pages)), "center", ftr)
+	}
+	return nil
+}
+
+// WritePDF writes the typeset pages to the given writer as a PDF.
+func (ts *Typesetter) WritePDF(w io.Writer, ms *mom.Manuscript, date time.Time) error {
+	pw := newPDFWriter()
+
+	catalog := pw.alloc()
+	tree := pw.alloc()
+	info := pw.alloc()
+
+	var fonts strings.Builder
+
+	for _, f := range []*pdfFont{ts.regular, ts.bold} {
+		if len(f.used) == 0 {
+			continue
+		}
+
+		n, err := pw.embed(f)
+
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&fonts, " /%s %d 0 R", f.Res, n)
+	}
+
+	kids := make([]string, 0, len(ts.pages))
+
+	for _, page := range ts.pages {
+		content := pw.alloc()
+		obj := pw.alloc()
+
+		if err := pw.stream(content, "", page.Bytes()); err != nil {
+			return err
+		}
+
+		pw.object(obj, fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font <<%s >> >> /Contents %d 0 R >>",
+			tree,
+			pdfNum(ts.Width),
+			pdfNum(ts.Height),
+			fonts.String(),
+			content,
+		))
+		kids = append(kids, fmt.Sprintf("%d 0 R", obj))
+	}
+
+	pw.object(tree, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	pw.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", tree))
+
+	stamp := pdfString("D:" + date.UTC().Format("20060102150405") + "Z")
+
+	pw.object(info, fmt.Sprintf(
+		"<< /Title %s /Author %s /Creator (book) /Producer (book) /CreationDate %s /ModDate %s >>",
+		pdfString(ms.DocTitle()),
+		pdfString(ms.Author()),
+		stamp,
+		stamp,
+	))
+
+	_, err := w.Write(pw.finish(catalog, info))
+	return err
+}
+
+// WriteToPDF typesets the manuscript and writes it to the given writer as a PDF,
+// without the need for groff. The layout of the manuscript is the same as
+// that of the docx exporter, though the text is always set in DejaVu Serif,
+// with italics slanted from the upright faces.
+func WriteToPDF(w io.Writer, ms *mom.Manuscript, l *export.Layout) error {
+	smf := l.Profile == export.ProfileSMF
+
+	regular, err := ParseFont("DejaVuSerif", fontSerif)
+
+	if err != nil {
+		return err
+	}
+
+	bold, err := ParseFont("DejaVuSerif-Bold", fontSerifBold)
+
+	if err != nil {
+		return err
+	}
+
+	paper := export.Papers[l.Paper]
+	margins := l.Margins
+
+	if margins == (export.Margins{}) {
+		margins = export.Margins{
+			Top:    export.SMFMargin,
+			Right:  export.SMFMargin,
+			Bottom: export.SMFMargin,
+			Left:   export.SMFMargin,
+		}
+	}
+
+	ts := &Typesetter{
+		Width:   export.Points(paper.Width),
+		Height:  export.Points(paper.Height),
+		Top:     export.Points(margins.Top),
+		Right:   export.Points(margins.Right),
+		Bottom:  export.Points(margins.Bottom),
+		Left:    export.Points(margins.Left),
+		Size:    float64(l.FontSize) / 2,
+		regular: newPDFFont(regular, "F1"),
+		bold:    newPDFFont(bold, "F2"),
+	}
+
+	styles := export.NewStyles(l)
+	body := 0
+
+	if l.Cover {
+		ts.NewPage()
+
+		if smf {
+			ts.SMFCover(ms, l, styles)
+		} else {
+			ts.Cover(ms, l, styles)
+		}
+		body = 1
+	}
+
+	ts.NewPage()
+
+	err = export.Walk(ms, &export.Visitor{
+		Chapter: func(heading string) error {
+			h1 := styles[export.StyleHeading1]
+
+			// Chapters in the Standard Manuscript Format start a third of the
+			// way down the page.
+			if smf {
+				ts.y -= float64(export.SMFPageLines/6) * ts.leading(&export.Style{Spacing: l.LineSpacing})
+			}
+
+			// Keep the heading with the first lines of the chapter.
+			ts.need(ts.leading(h1) + ts.leading(styles[export.StyleBodyText])*2)
+			ts.Line(heading, h1)
+			return nil
+		},
+		ChapterTitle: func(title string) error {
+			ts.Line(title, styles[export.StyleHeading2])
+			return nil
+		},
+		Epigraph: func(txt string, attribution bool) error {
+			st := styles[export.StyleEpigraph]
+
+			if attribution {
+				st = styles[export.StyleAttribution]
+			}
+			ts.Paragraph(ts.words(txt, st.Bold, st.Italic), st, st.Align, "", 0)
+			return nil
+		},
+		Paragraph: func(p *export.Paragraph) error {
+			st := styles[export.StyleBodyText]
+
+			if p.First {
+				st = styles[export.StyleBodyTextFirst]
+			}
+
+			for i, seg := range p.Segments {
+				letter := ""
+				lines := 0
+
+				if i == 0 {
+					letter, lines = p.DropCap, p.DropLines
+				}
+				ts.Paragraph(ts.words(seg.Text, st.Bold, st.Italic), st, seg.Align, letter, lines)
+			}
+			return nil
+		},
+		SceneBreak: func() error {
+			// Scene breaks are marked with a single centred # in the Standard
+			// Manuscript Format, otherwise with the asterisks mom uses by
+			// default.
+			mark := "* * *"
+
+			if smf {
+				mark = "#"
+			}
+
+			ts.Line(mark, &export.Style{Align: "center", Spacing: l.LineSpacing})
+			return nil
+		},
+		Collate: func() error {
+			ts.Break()
+			return nil
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if smf {
+		ts.Line("END", &export.Style{Align: "center", Spacing: l.LineSpacing})
+	}
+
+	// A trailing COLLATE leaves an empty page at the end of the manuscript.
+	if n := len(ts.pages); n > body+1 && ts.pages[n-1].Len() == 0 {
+		ts.pages = ts.pages[:n-1]
+	}
+
+	if err := ts.Headers(ms, smf, body); err != nil {
+		return err
+	}
+	return ts.WritePDF(w, ms, l.Date)
+}
@@ -0,0 +1,148 @@
+package pdf
+
+import (
+	"bytes"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/export"
+	"book/mom"
+)
+
+func TestParseFont(t *testing.T) {
+	f, err := ParseFont("DejaVuSerif", fontSerif)
+
+	if err != nil {
+		t.Fatalf("ParseFont: %v\n", err)
+	}
+
+	if f.UnitsPerEm != 2048 {
+		t.Errorf("f.UnitsPerEm = %d, want = %d", f.UnitsPerEm, 2048)
+	}
+
+	for _, r := range "Aa “—é" {
+		if f.Glyph(r) == 0 {
+			t.Errorf("f.Glyph(%q) = 0, want glyph", r)
+		}
+	}
+
+	if got, want := f.Width("AA", 12), f.Width("A", 24); got != want {
+		t.Errorf("f.Width(%q, 12) = %v, want = %v", "AA", got, want)
+	}
+
+	subset := f.Subset(map[uint16]struct{}{
+		f.Glyph('A'): {},
+	})
+
+	if len(subset) >= len(fontSerif) {
+		t.Errorf("len(subset) = %d, want less than %d", len(subset), len(fontSerif))
+	}
+
+	if sum := fontChecksum(subset); sum != 0xB1B0AFBA {
+		t.Errorf("fontChecksum(subset) = %#x, want = %#x", sum, 0xB1B0AFBA)
+	}
+}
+
+func TestTypesetterWords(t *testing.T) {
+	ts := Typesetter{}
+
+	got := ts.words(`\*[lq]The \*[IT]real\*[PREV] thing,\*[rq] \*[BD]she\*[PREV]  said.`, false, false)
+
+	want := []word{
+		{{text: "“The"}},
+		{{text: "real", italic: true}},
+		{{text: "thing,”"}},
+		{{text: "she", bold: true}},
+		{{text: "said."}},
+	}
+
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(span{})); diff != "" {
+		t.Errorf("ts.words mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteToPDF(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "chapters.mom")
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		t.Fatalf("ParseManuscript(%q): %v\n", file, err)
+	}
+
+	l, err := export.NewLayout(ms, nil)
+
+	if err != nil {
+		t.Fatalf("NewLayout: %v\n", err)
+	}
+
+	l.Date = time.Date(2024, time.May, 26, 12, 30, 0, 0, time.UTC)
+
+	files := make([][]byte, 0, 2)
+
+	for range 2 {
+		var buf bytes.Buffer
+
+		if err := WriteToPDF(&buf, ms, l); err != nil {
+			t.Fatalf("WriteToPDF: %v\n", err)
+		}
+		files = append(files, buf.Bytes())
+	}
+
+	b := files[0]
+
+	if !bytes.Equal(b, files[1]) {
+		t.Fatalf("WriteToPDF produced different files for the same manuscript\n")
+	}
+
+	if !bytes.HasPrefix(b, []byte("%PDF-1.7\n")) {
+		t.Fatalf("WriteToPDF did not write a PDF header\n")
+	}
+
+	// Every object in the cross-reference table should point to the start
+	// of that object.
+	i := bytes.LastIndex(b, []byte("startxref\n"))
+
+	if i < 0 {
+		t.Fatalf("WriteToPDF did not write startxref\n")
+	}
+
+	xref, err := strconv.Atoi(string(bytes.Fields(b[i+10:])[0]))
+
+	if err != nil {
+		t.Fatalf("startxref: %v\n", err)
+	}
+
+	lines := bytes.Split(b[xref:], []byte("\n"))
+
+	n, err := strconv.Atoi(string(bytes.Fields(lines[1])[1]))
+
+	if err != nil {
+		t.Fatalf("xref: %v\n", err)
+	}
+
+	for obj := 1; obj < n; obj++ {
+		off, err := strconv.Atoi(string(lines[2+obj][:10]))
+
+		if err != nil {
+			t.Fatalf("xref entry %d: %v\n", obj, err)
+		}
+
+		if !bytes.HasPrefix(b[off:], []byte(strconv.Itoa(obj)+" 0 obj\n")) {
+			t.Errorf("xref entry %d does not point to object", obj)
+		}
+	}
+
+	// The cover, and each of the three chapters.
+	if pages := bytes.Count(b, []byte("/Type /Page ")); pages != 4 {
+		t.Errorf("pages = %d, want = %d", pages, 4)
+	}
+
+	if !bytes.Contains(b, []byte("/CreationDate (D:20240526123000Z)")) {
+		t.Errorf("WriteToPDF did not use the layout date for the creation date")
+	}
+}
@@ -0,0 +1,493 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrFont = errors.New("malformed font")
+
+// Font is a TrueType font that has been parsed for embedding into a PDF. Only
+// the tables needed for measuring text, and for subsetting the font, are
+// parsed.
+type Font struct {
+	// Name is the PostScript name of the font.
+	Name string
+
+	UnitsPerEm int
+	Ascent     int
+	Descent    int
+	CapHeight  int
+	BBox       [4]int
+
+	tables   map[string][]byte
+	advances []int
+	cmap     map[rune]uint16
+	loca     []int
+}
+
+func u16(b []byte, off int) int {
+	return int(binary.BigEndian.Uint16(b[off:]))
+}
+
+func i16(b []byte, off int) int {
+	return int(int16(binary.BigEndian.Uint16(b[off:])))
+}
+
+func u32(b []byte, off int) int {
+	return int(binary.BigEndian.Uint32(b[off:]))
+}
+
+// ParseFont parses the given TrueType font, using the given name as its
+// PostScript name.
+func ParseFont(name string, b []byte) (*Font, error) {
+	if len(b) < 12 {
+		return nil, fmt.Errorf("%w: short header", ErrFont)
+	}
+
+	f := Font{
+		Name:   name,
+		tables: make(map[string][]byte),
+	}
+
+	n := u16(b, 4)
+
+	for i := 0; i < n; i++ {
+		rec := 12 + i*16
+
+		if rec+16 > len(b) {
+			return nil, fmt.Errorf("%w: short table directory", ErrFont)
+		}
+
+		off := u32(b, rec+8)
+		length := u32(b, rec+12)
+
+		if off+length > len(b) {
+			return nil, fmt.Errorf("%w: table %q out of bounds", ErrFont, b[rec:rec+4])
+		}
+		f.tables[string(b[rec:rec+4])] = b[off : off+length]
+	}
+
+	for _, tag := range []string{"head", "hhea", "hmtx", "maxp", "cmap", "loca", "glyf"} {
+		if _, ok := f.tables[tag]; !ok {
+			return nil, fmt.Errorf("%w: missing %s table", ErrFont, tag)
+		}
+	}
+
+	head := f.tables["head"]
+
+	if len(head) < 54 {
+		return nil, fmt.Errorf("%w: short head table", ErrFont)
+	}
+
+	f.UnitsPerEm = u16(head, 18)
+	f.BBox = [4]int{i16(head, 36), i16(head, 38), i16(head, 40), i16(head, 42)}
+
+	hhea := f.tables["hhea"]
+
+	if len(hhea) < 36 {
+		return nil, fmt.Errorf("%w: short hhea table", ErrFont)
+	}
+
+	f.Ascent = i16(hhea, 4)
+	f.Descent = i16(hhea, 6)
+	f.CapHeight = f.Ascent
+
+	if os2, ok := f.tables["OS/2"]; ok && len(os2) >= 90 && u16(os2, 0) >= 2 {
+		f.CapHeight = i16(os2, 88)
+	}
+
+	glyphs := u16(f.tables["maxp"], 4)
+	metrics := u16(hhea, 34)
+	hmtx := f.tables["hmtx"]
+
+	if metrics == 0 || len(hmtx) < metrics*4 {
+		return nil, fmt.Errorf("%w: short hmtx table", ErrFont)
+	}
+
+	f.advances = make([]int, glyphs)
+
+	for i := range f.advances {
+		// Glyphs past the last metric share its advance.
+		f.advances[i] = u16(hmtx, min(i, metrics-1)*4)
+	}
+
+	loca := f.tables["loca"]
+	f.loca = make([]int, glyphs+1)
+
+	for i := range f.loca {
+		if i16(head, 50) == 0 {
+			if (i+1)*2 > len(loca) {
+				return nil, fmt.Errorf("%w: short loca table", ErrFont)
+			}
+			f.loca[i] = u16(loca, i*2) * 2
+			continue
+		}
+
+		if (i+1)*4 > len(loca) {
+			return nil, fmt.Errorf("%w: short loca table", ErrFont)
+		}
+		f.loca[i] = u32(loca, i*4)
+	}
+
+	cmap, err := parseCmap(f.tables["cmap"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.cmap = cmap
+	return &f, nil
+}
+
+// parseCmap parses the Unicode mapping from the given cmap table. Only the
+// segmented mappings of format 4 and 12 are supported, as these are what any
+// font for setting text will have.
+func parseCmap(b []byte) (map[rune]uint16, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("%w: short cmap table", ErrFont)
+	}
+
+	// The preferred subtable is the full Unicode mapping, falling back to
+	// the BMP only mapping.
+	best, rank := -1, 0
+
+	for i := 0; i < u16(b, 2); i++ {
+		rec := 4 + i*8
+
+		if rec+8 > len(b) {
+			break
+		}
+
+		platform, encoding, off := u16(b, rec), u16(b, rec+2), u32(b, rec+4)
+
+		if off+2 > len(b) {
+			continue
+		}
+
+		r := 0
+
+		switch format := u16(b, off); {
+		case platform == 3 && encoding == 10 && format == 12:
+			r = 4
+		case platform == 0 && format == 12:
+			r = 3
+		case platform == 3 && encoding == 1 && format == 4:
+			r = 2
+		case platform == 0 && format == 4:
+			r = 1
+		}
+
+		if r > rank {
+			best, rank = off, r
+		}
+	}
+
+	if best < 0 {
+		return nil, fmt.Errorf("%w: no unicode cmap", ErrFont)
+	}
+
+	b = b[best:]
+	cmap := make(map[rune]uint16)
+
+	if u16(b, 0) == 12 {
+		if len(b) < 16 {
+			return nil, fmt.Errorf("%w: short cmap subtable", ErrFont)
+		}
+
+		for i := 0; i < u32(b, 12); i++ {
+			grp := 16 + i*12
+
+			if grp+12 > len(b) {
+				return nil, fmt.Errorf("%w: short cmap subtable", ErrFont)
+			}
+
+			start, end, g := u32(b, grp), u32(b, grp+4), u32(b, grp+8)
+
+			for c := start; c <= end; c++ {
+				cmap[rune(c)] = uint16(g + c - start)
+			}
+		}
+		return cmap, nil
+	}
+
+	if len(b) < 14 {
+		return nil, fmt.Errorf("%w: short cmap subtable", ErrFont)
+	}
+
+	segs := u16(b, 6) / 2
+
+	ends := 14
+	starts := ends + segs*2 + 2
+	deltas := starts + segs*2
+	offsets := deltas + segs*2
+
+	if offsets+segs*2 > len(b) {
+		return nil, fmt.Errorf("%w: short cmap subtable", ErrFont)
+	}
+
+	for i := 0; i < segs; i++ {
+		start, end := u16(b, starts+i*2), u16(b, ends+i*2)
+		delta, ro := u16(b, deltas+i*2), u16(b, offsets+i*2)
+
+		for c := start; c <= end && c != 0xFFFF; c++ {
+			g := (c + delta) & 0xFFFF
+
+			if ro != 0 {
+				addr := offsets + i*2 + ro + (c-start)*2
+
+				if addr+2 > len(b) {
+					continue
+				}
+
+				if g = u16(b, addr); g != 0 {
+					g = (g + delta) & 0xFFFF
+				}
+			}
+
+			if g != 0 {
+				cmap[rune(c)] = uint16(g)
+			}
+		}
+	}
+	return cmap, nil
+}
+
+// Glyph returns the glyph for the given rune, or the missing glyph if the font
+// has no glyph for it.
+func (f *Font) Glyph(r rune) uint16 {
+	return f.cmap[r]
+}
+
+// Advance returns the advance width of the given glyph in font units.
+func (f *Font) Advance(g uint16) int {
+	if int(g) >= len(f.advances) {
+		return 0
+	}
+	return f.advances[g]
+}
+
+// Width returns the width of the given string when set at the given size.
+func (f *Font) Width(s string, size float64) float64 {
+	w := 0
+
+	for _, r := range s {
+		w += f.Advance(f.Glyph(r))
+	}
+	return float64(w) * size / float64(f.UnitsPerEm)
+}
+
+func (f *Font) glyf(g uint16) []byte {
+	if int(g)+1 >= len(f.loca) {
+		return nil
+	}
+
+	glyf := f.tables["glyf"]
+
+	start, end := f.loca[g], f.loca[g+1]
+
+	if start >= end || end > len(glyf) {
+		return nil
+	}
+	return glyf[start:end]
+}
+
+// components returns the glyphs that make up the given glyph, if it is a
+// composite glyph.
+func (f *Font) components(g uint16) []uint16 {
+	b := f.glyf(g)
+
+	if len(b) < 10 || i16(b, 0) >= 0 {
+		return nil
+	}
+
+	const (
+		argWords  = 0x0001
+		scale     = 0x0008
+		more      = 0x0020
+		xyScale   = 0x0040
+		twoByTwo  = 0x0080
+		component = 4
+	)
+
+	var glyphs []uint16
+
+	off := 10
+
+	for off+component <= len(b) {
+		flags := u16(b, off)
+		glyphs = append(glyphs, uint16(u16(b, off+2)))
+
+		off += component
+
+		if flags&argWords != 0 {
+			off += 4
+		} else {
+			off += 2
+		}
+
+		switch {
+		case flags&scale != 0:
+			off += 2
+		case flags&xyScale != 0:
+			off += 4
+		case flags&twoByTwo != 0:
+			off += 8
+		}
+
+		if flags&more == 0 {
+			break
+		}
+	}
+	return glyphs
+}
+
+// Subset returns the font with the outlines of every glyph not in the given
+// set removed. The glyphs keep their original IDs, so text encoded against
+// the full font can still be used with the subset.
+func (f *Font) Subset(glyphs map[uint16]struct{}) []byte {
+	keep := make(map[uint16]struct{})
+
+	// The missing glyph must always be present.
+	queue := []uint16{0}
+
+	for g := range glyphs {
+		queue = append(queue, g)
+	}
+
+	for len(queue) > 0 {
+		g := queue[0]
+		queue = queue[1:]
+
+		if _, ok := keep[g]; ok {
+			continue
+		}
+
+		keep[g] = struct{}{}
+		queue = append(queue, f.components(g)...)
+	}
+
+	var glyf bytes.Buffer
+
+	loca := make([]byte, 0, len(f.loca)*4)
+
+	for g := 0; g < len(f.loca)-1; g++ {
+		loca = binary.BigEndian.AppendUint32(loca, uint32(glyf.Len()))
+
+		if _, ok := keep[uint16(g)]; !ok {
+			continue
+		}
+
+		glyf.Write(f.glyf(uint16(g)))
+
+		for glyf.Len()%4 != 0 {
+			glyf.WriteByte(0)
+		}
+	}
+	loca = binary.BigEndian.AppendUint32(loca, uint32(glyf.Len()))
+
+	// The subset always uses long offsets for the loca table, and the
+	// checksum adjustment is recalculated once the font is written.
+	head := bytes.Clone(f.tables["head"])
+	binary.BigEndian.PutUint32(head[8:], 0)
+	binary.BigEndian.PutUint16(head[50:], 1)
+
+	tables := map[string][]byte{
+		"head": head,
+		"hhea": f.tables["hhea"],
+		"hmtx": f.tables["hmtx"],
+		"maxp": f.tables["maxp"],
+		"loca": loca,
+		"glyf": glyf.Bytes(),
+	}
+
+	// The hinting instructions are kept, as the glyph programs may call into
+	// them.
+	for _, tag := range []string{"cvt ", "fpgm", "prep"} {
+		if b, ok := f.tables[tag]; ok {
+			tables[tag] = b
+		}
+	}
+
+	b := writeFont(tables)
+
+	off := u32(b, 12+tableIndex(tables, "head")*16+8)
+	binary.BigEndian.PutUint32(b[off+8:], 0xB1B0AFBA-fontChecksum(b))
+
+	return b
+}
+
+func fontChecksum(b []byte) uint32 {
+	var sum uint32
+
+	for i := 0; i < len(b); i += 4 {
+		var word [4]byte
+		copy(word[:], b[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+func tableIndex(tables map[string][]byte, tag string) int {
+	i := 0
+
+	for t := range tables {
+		if t < tag {
+			i++
+		}
+	}
+	return i
+}
+
+// writeFont writes the given tables out as a TrueType font file, with the
+// tables sorted by their tag.
+func writeFont(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	n := len(tags)
+
+	// The search range is the largest power of two less than or equal to
+	// the number of tables, multiplied by 16.
+	pow := 1
+	shift := 0
+
+	for pow*2 <= n {
+		pow *= 2
+		shift++
+	}
+
+	b := make([]byte, 12, 12+n*16)
+	binary.BigEndian.PutUint32(b[0:], 0x00010000)
+	binary.BigEndian.PutUint16(b[4:], uint16(n))
+	binary.BigEndian.PutUint16(b[6:], uint16(pow*16))
+	binary.BigEndian.PutUint16(b[8:], uint16(shift))
+	binary.BigEndian.PutUint16(b[10:], uint16(n*16-pow*16))
+
+	off := 12 + n*16
+
+	var data []byte
+
+	for _, tag := range tags {
+		t := tables[tag]
+
+		b = append(b, tag...)
+		b = binary.BigEndian.AppendUint32(b, fontChecksum(t))
+		b = binary.BigEndian.AppendUint32(b, uint32(off+len(data)))
+		b = binary.BigEndian.AppendUint32(b, uint32(len(t)))
+
+		data = append(data, t...)
+
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	return append(b, data...)
+}
@@ -0,0 +1,163 @@
+package export
+
+import "strings"
+
+// The IDs of the named styles defined in the DOCX document.
+const (
+	StyleTitle         = "Title"
+	StyleContact       = "Contact"
+	StyleSubtitle      = "Subtitle"
+	StyleHeading1      = "Heading1"
+	StyleHeading2      = "Heading2"
+	StyleBodyText      = "BodyText"
+	StyleBodyTextFirst = "BodyTextFirst"
+	StyleEpigraph      = "Epigraph"
+	StyleAttribution   = "EpigraphAttribution"
+	StyleEmphasis      = "Emphasis"
+	StyleStrong        = "Strong"
+)
+
+// Style describes the formatting of a paragraph or run in a DOCX document. If
+// the style has an ID then it is defined as a named style within the document,
+// otherwise its formatting is applied directly.
+type Style struct {
+	ID      string
+	Name    string
+	Char    bool // Char is whether this is a character style.
+	BasedOn string
+	Next    string
+
+	Align   string // Align is the justification, either left, center, or right.
+	Spacing int
+	Indent  int
+	Left    int
+	Right   int
+	Outline int // Outline is the outline level plus one, zero for none.
+	Tab     int // Tab is the position of a right aligned tab stop, zero for none.
+
+	// DropCap is the number of lines the paragraph should drop into the
+	// paragraph that follows it. The paragraph is framed, and the Spacing is
+	// the exact height of the frame.
+	DropCap int
+
+	Size   int
+	Bold   bool
+	Italic bool
+}
+
+// NewStyles returns the named styles for the given layout.
+func NewStyles(l *Layout) map[string]*Style {
+	smf := l.Profile == ProfileSMF
+
+	styles := []*Style{
+		{
+			ID:    StyleTitle,
+			Name:  "Title",
+			Align: "center",
+			Size:  l.TitleSize,
+			Bold:  !smf,
+		},
+		{
+			ID:      StyleContact,
+			Name:    "Contact",
+			Align:   "left",
+			Spacing: SingleSpacing,
+			Tab:     Papers[l.Paper].Width - l.Margins.Left - l.Margins.Right,
+		},
+		{
+			ID:     StyleSubtitle,
+			Name:   "Subtitle",
+			Align:  "center",
+			Size:   l.TitleSize,
+			Italic: !smf,
+		},
+		{
+			ID:      StyleHeading1,
+			Name:    "heading 1",
+			Next:    StyleBodyTextFirst,
+			Align:   "center",
+			Spacing: l.LineSpacing,
+			Outline: 1,
+			Size:    l.HeadingSize,
+			Bold:    !smf,
+		},
+		{
+			ID:      StyleHeading2,
+			Name:    "heading 2",
+			Next:    StyleBodyTextFirst,
+			Align:   "center",
+			Spacing: l.LineSpacing,
+			Outline: 2,
+			Size:    l.HeadingSize,
+			Bold:    !smf,
+			Italic:  !smf,
+		},
+		{
+			ID:      StyleBodyText,
+			Name:    "Body Text",
+			Next:    StyleBodyText,
+			Spacing: l.LineSpacing,
+			Indent:  l.Indent,
+		},
+		{
+			ID:      StyleBodyTextFirst,
+			Name:    "Body Text First",
+			BasedOn: StyleBodyText,
+			Next:    StyleBodyText,
+			Spacing: l.LineSpacing,
+		},
+		{
+			ID:      StyleEpigraph,
+			Name:    "Epigraph",
+			Next:    StyleEpigraph,
+			Spacing: l.LineSpacing,
+			Left:    l.Indent * 2,
+			Right:   l.Indent * 2,
+			Italic:  true,
+		},
+		{
+			ID:      StyleAttribution,
+			Name:    "Epigraph Attribution",
+			Align:   "right",
+			Spacing: l.LineSpacing,
+			Left:    l.Indent * 2,
+			Right:   l.Indent * 2,
+		},
+		{
+			ID:     StyleEmphasis,
+			Name:   "Emphasis",
+			Char:   true,
+			Italic: true,
+		},
+		{
+			ID:   StyleStrong,
+			Name: "Strong",
+			Char: true,
+			Bold: true,
+		},
+	}
+
+	m := make(map[string]*Style)
+
+	for _, st := range styles {
+		m[st.ID] = st
+	}
+
+	// Every paragraph in the Standard Manuscript Format is indented,
+	// including the first of each chapter.
+	if smf {
+		m[StyleBodyTextFirst].Indent = l.Indent
+	}
+	return m
+}
+
+// IsAttribution returns whether the given line of an epigraph is its
+// attribution, that is, whether the line starts with a dash.
+func IsAttribution(s string) bool {
+	for _, prefix := range []string{"—", "–", "―", "--", `\(em`, `\[em]`} {
+		if strings.HasPrefix(strings.TrimSpace(s), prefix) {
+			return true
+		}
+	}
+	return false
+}
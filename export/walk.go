@@ -0,0 +1,315 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"book/mom"
+)
+
+// Segment is part of a paragraph that shares the same alignment, which is
+// either left, center, right, or empty for justified.
+type Segment struct {
+	Align string
+	Text  string
+}
+
+// Paragraph is a paragraph of the body of a manuscript. The paragraph is split
+// into segments whenever the alignment changes, as each segment needs to be
+// set as a paragraph of its own.
+type Paragraph struct {
+	// First is whether this is the first paragraph of a chapter or scene.
+	First bool
+
+	// DropCap is the letter given via DROPCAP, if any, to be dropped into the
+	// given number of lines.
+	DropCap   string
+	DropLines int
+
+	Segments []*Segment
+}
+
+// Visitor is the set of callbacks made by [Walk] for each part of the body of
+// a manuscript, each of which must be set. This is how the exporters that set
+// the manuscript themselves, rather than through groff, share the same
+// structure.
+type Visitor struct {
+	// Chapter is called with the heading of a chapter, such as CHAPTER 1.
+	Chapter func(heading string) error
+
+	// ChapterTitle is called with the title of a chapter.
+	ChapterTitle func(title string) error
+
+	// Epigraph is called with each line of an epigraph, and whether it is
+	// the attribution of the epigraph.
+	Epigraph func(txt string, attribution bool) error
+
+	// Paragraph is called for each paragraph.
+	Paragraph func(p *Paragraph) error
+
+	// SceneBreak is called for each LINEBREAK.
+	SceneBreak func() error
+
+	// Collate is called for each COLLATE, which ends a chapter.
+	Collate func() error
+}
+
+// Walk walks the tokens of the manuscript, calling the callbacks of the given
+// visitor in order for each part of the body. The walk stops at the first
+// error returned by a callback.
+//
+// An alignment given via LEFT, RIGHT, CENTER, or JUSTIFY carries over into
+// the paragraphs that follow, until the next COLLATE or CHAPTER.
+func Walk(ms *mom.Manuscript, v *Visitor) error {
+	sc := mom.Scanner{
+		Tokens: ms.Tokens,
+	}
+
+	first := true
+	align := ""
+
+	tok := sc.Next()
+
+	for tok != nil {
+		if m, ok := tok.(*mom.Macro); ok {
+			var err error
+
+			switch m.Name {
+			case "CHAPTER":
+				align = ""
+
+				str := "CHAPTER"
+
+				if tok := sc.Peek(); tok != nil {
+					if m, ok := tok.(*mom.Macro); ok && m.Name == "CHAPTER_STRING" {
+						str = m.Arg(0)
+						sc.Next()
+					}
+				}
+				err = v.Chapter(fmt.Sprintf("%s %s", str, m.Arg(0)))
+			case "CHAPTER_TITLE":
+				err = v.ChapterTitle(m.Arg(0))
+			case "EPIGRAPH":
+				attribution := false
+
+				tok = sc.Next()
+
+			epiLoop:
+				for tok != nil {
+					switch t := tok.(type) {
+					case *mom.Macro:
+						switch t.Name {
+						case "EPIGRAPH":
+							break epiLoop
+						case "RIGHT":
+							attribution = true
+						case "LEFT", "CENTER", "JUSTIFY":
+							attribution = false
+						}
+					case *mom.Text:
+						if t.Value != "" {
+							if err := v.Epigraph(t.Value, attribution || IsAttribution(t.Value)); err != nil {
+								return err
+							}
+						}
+					}
+					tok = sc.Next()
+				}
+			case "PP":
+				p := &Paragraph{
+					First: first,
+				}
+
+				if tok := sc.Peek(); tok != nil {
+					if m, ok := tok.(*mom.Macro); ok {
+						switch m.Name {
+						case "DROPCAP":
+							p.DropCap = m.Arg(0)
+
+							if p.DropLines, err = strconv.Atoi(m.Arg(1)); err != nil || p.DropLines < 2 {
+								p.DropLines = 3
+							}
+							err = nil
+							sc.Next()
+						case "PP":
+							tok = sc.Next()
+							continue
+						}
+					}
+				}
+
+				p.Segments, align, first = paragraphSegments(&sc, align, first)
+
+				err = v.Paragraph(p)
+			case "LEFT", "RIGHT", "CENTER", "JUSTIFY":
+				align = alignment(m.Name)
+			case "LINEBREAK":
+				err = v.SceneBreak()
+				first = true
+			case "COLLATE":
+				first = true
+				align = ""
+				err = v.Collate()
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+		tok = sc.Next()
+	}
+	return nil
+}
+
+// alignment returns the alignment of a segment for the given LEFT, RIGHT,
+// CENTER, or JUSTIFY macro.
+func alignment(name string) string {
+	if name == "JUSTIFY" {
+		return ""
+	}
+	return strings.ToLower(name)
+}
+
+// paragraphSegments returns the segments of the paragraph that starts at the
+// current token of the scanner with the given alignment, leaving the scanner
+// at the token that ends it. This also returns the alignment in effect at the
+// end of the paragraph, and whether the paragraph that follows is the first of
+// a chapter or scene.
+func paragraphSegments(sc *mom.Scanner, align string, first bool) ([]*Segment, string, bool) {
+	type segment struct {
+		align string
+		text  strings.Builder
+	}
+
+	segs := []*segment{{align: align}}
+
+	tok := sc.Next()
+
+paraLoop:
+	for tok != nil {
+		seg := segs[len(segs)-1]
+
+		switch v := tok.(type) {
+		case *mom.Macro:
+			switch v.Name {
+			case "PP", "LINEBREAK":
+				first = false
+				sc.Back()
+				break paraLoop
+			case "COLLATE":
+				first = true
+				sc.Back()
+				break paraLoop
+			case "LEFT", "RIGHT", "CENTER", "JUSTIFY":
+				if seg.text.Len() > 0 {
+					seg = &segment{}
+					segs = append(segs, seg)
+				}
+				seg.align = alignment(v.Name)
+			}
+		case *mom.Text:
+			seg.text.WriteString(v.Value)
+			seg.text.WriteString(" ")
+		}
+		tok = sc.Next()
+	}
+
+	segments := make([]*Segment, 0, len(segs))
+
+	for i, seg := range segs {
+		if i > 0 && seg.text.Len() == 0 {
+			continue
+		}
+
+		segments = append(segments, &Segment{
+			Align: seg.align,
+			Text:  strings.TrimSuffix(seg.text.String(), " "),
+		})
+	}
+	return segments, segs[len(segs)-1].align, first
+}
+
+// Header is a running header of the pages of a manuscript, aligned either
+// left, center, or right.
+type Header struct {
+	Align string
+	Text  string
+}
+
+// Headers are the running headers of the recto and verso pages of a
+// manuscript, either of which may be nil.
+type Headers struct {
+	Recto *Header
+	Verso *Header
+
+	// RectoVerso is whether the verso pages have a header of their own,
+	// otherwise the verso header is the same as the recto header.
+	RectoVerso bool
+}
+
+var headerAlignments = map[string]string{
+	"LEFT":   "left",
+	"CENTER": "center",
+	"CENTRE": "center",
+	"RIGHT":  "right",
+}
+
+// RunningHeaders returns the headers given via the HEADER_RECTO and
+// HEADER_VERSO macros. If RECTO_VERSO is set, then the verso header is used for
+// even pages and the recto header for odd pages, otherwise the recto header is
+// used for every page. There are no headers if HEADERS is OFF.
+//
+// Header rules are not drawn, so HEADER_RULE is ignored.
+func RunningHeaders(ms *mom.Manuscript) (*Headers, error) {
+	hs := &Headers{}
+
+	if ms.Get("HEADERS") == "OFF" {
+		return hs, nil
+	}
+
+	header := func(m *mom.Macro) (*Header, error) {
+		if m == nil {
+			return nil, nil
+		}
+
+		align, ok := headerAlignments[m.Arg(0)]
+
+		if !ok {
+			return nil, fmt.Errorf("%s: unrecognized position %q, must be one of: [LEFT, CENTER, RIGHT]", m.Name, m.Arg(0))
+		}
+
+		return &Header{
+			Align: align,
+			Text:  ms.Expand(strings.Join(m.Args[1:], " ")),
+		}, nil
+	}
+
+	var err error
+
+	if hs.Recto, err = header(ms.Macro("HEADER_RECTO")); err != nil {
+		return nil, err
+	}
+
+	hs.Verso = hs.Recto
+	hs.RectoVerso = ms.Macro("RECTO_VERSO") != nil
+
+	if hs.RectoVerso {
+		if hs.Verso, err = header(ms.Macro("HEADER_VERSO")); err != nil {
+			return nil, err
+		}
+	}
+	return hs, nil
+}
+
+// SMFHeader returns the running header of the Standard Manuscript Format, the
+// surname of the author and the title, without the page number that follows
+// them.
+func SMFHeader(ms *mom.Manuscript) string {
+	surname := ms.Author()
+
+	if fields := strings.Fields(surname); len(fields) > 0 {
+		surname = fields[len(fields)-1]
+	}
+	return fmt.Sprintf("%s / %s", surname, strings.ToUpper(ms.DocTitle()))
+}
@@ -0,0 +1,85 @@
+package export
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/mom"
+)
+
+func TestWalk(t *testing.T) {
+	ms, err := mom.ParseManuscript(filepath.Join("..", "testdata", "export", "walk.mom"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0)
+
+	add := func(format string, args ...any) error {
+		got = append(got, fmt.Sprintf(format, args...))
+		return nil
+	}
+
+	err = Walk(ms, &Visitor{
+		Chapter:      func(heading string) error { return add("chapter %q", heading) },
+		ChapterTitle: func(title string) error { return add("title %q", title) },
+		Epigraph: func(txt string, attribution bool) error {
+			return add("epigraph %q %v", txt, attribution)
+		},
+		Paragraph: func(p *Paragraph) error {
+			add("paragraph first=%v dropcap=%q %d", p.First, p.DropCap, p.DropLines)
+
+			for _, seg := range p.Segments {
+				add("    %q %q", seg.Align, seg.Text)
+			}
+			return nil
+		},
+		SceneBreak: func() error { return add("scene break") },
+		Collate:    func() error { return add("collate") },
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`chapter "BOOK 1"`,
+		`title "THE FIRST"`,
+		`epigraph "The epigraph." false`,
+		`epigraph "The author." true`,
+		`paragraph first=true dropcap="T" 2`,
+		`    "" "he first paragraph."`,
+		`paragraph first=false dropcap="" 0`,
+		`    "" "The second."`,
+		`    "right" "Signed."`,
+		`scene break`,
+		`paragraph first=true dropcap="" 0`,
+		`    "right" "The scene, still to the right."`,
+		`paragraph first=false dropcap="" 0`,
+		`    "center" "The centre."`,
+		`collate`,
+		`chapter "CHAPTER 2"`,
+		`paragraph first=true dropcap="" 0`,
+		`    "" "The second chapter."`,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Walk() mismatch (-want +got):\n%s", diff)
+	}
+
+	hs, err := RunningHeaders(ms)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recto := &Header{Align: "left", Text: "The recto"}
+
+	if diff := cmp.Diff(&Headers{Recto: recto, Verso: recto}, hs); diff != "" {
+		t.Errorf("RunningHeaders() mismatch (-want +got):\n%s", diff)
+	}
+}
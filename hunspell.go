@@ -0,0 +1,678 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrDictionary = errors.New("dictionary not found")
+	ErrEncoding   = errors.New("unsupported dictionary encoding")
+)
+
+// affix is a single prefix or suffix rule of a Hunspell affix file. A word
+// with the flag of the rule has strip removed, and add added to it, provided
+// the word matches the condition. The continuation flags are those given to
+// the word once the affix is added, allowing another affix to follow it.
+type affix struct {
+	flag  string
+	cross bool
+	strip string
+	add   string
+	cond  *regexp.Regexp
+	cont  []string
+}
+
+// continues returns whether the affix has the given continuation flag.
+func (a *affix) continues(flag string) bool {
+	if flag == "" {
+		return false
+	}
+
+	for _, f := range a.cont {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Dictionary is a Hunspell dictionary, loaded from its .aff and .dic files.
+// Only the parts of Hunspell needed for checking the prose of a manuscript are
+// supported, these being prefixes and suffixes, forbidden words, and the TRY
+// and REP tables for suggestions. Continuation classes are supported to one
+// level, so an affix may follow another, but no more than two. Compounding is
+// not supported.
+type Dictionary struct {
+	words map[string]map[string]struct{}
+
+	prefixes []*affix
+	suffixes []*affix
+
+	flagType  string
+	aliases   [][]string
+	forbidden string
+	needAffix string
+	noSuggest string
+
+	try string
+	rep [][2]string
+}
+
+// NewDictionary returns an empty dictionary, to which words can be added.
+func NewDictionary() *Dictionary {
+	return &Dictionary{
+		words: make(map[string]map[string]struct{}),
+	}
+}
+
+// dictionaryPaths returns the directories searched for dictionaries, in
+// order.
+func dictionaryPaths() []string {
+	paths := filepath.SplitList(os.Getenv("DICPATH"))
+
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, "Library", "Spelling"), filepath.Join(home, ".local", "share", "hunspell"))
+	}
+
+	return append(paths,
+		"/usr/share/hunspell",
+		"/usr/share/myspell",
+		"/usr/share/myspell/dicts",
+		"/usr/local/share/hunspell",
+		"/Library/Spelling",
+	)
+}
+
+// FindDictionary returns the path of the given dictionary without the file
+// extension, such as /usr/share/hunspell/en_GB. If the name is a path, then
+// it is returned as is, otherwise the dictionary paths are searched.
+func FindDictionary(name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".dic"), ".aff")
+
+	if strings.ContainsRune(name, filepath.Separator) {
+		return name, nil
+	}
+
+	for _, dir := range dictionaryPaths() {
+		path := filepath.Join(dir, name)
+
+		if _, err := os.Stat(path + ".dic"); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrDictionary, name)
+}
+
+// LoadDictionary loads the Hunspell dictionary at the given path, without the
+// .aff or .dic extension.
+func LoadDictionary(path string) (*Dictionary, error) {
+	d := NewDictionary()
+
+	aff, err := os.ReadFile(path + ".aff")
+
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := d.parseAffix(aff)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s.aff: %w", path, err)
+	}
+
+	dic, err := os.ReadFile(path + ".dic")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.parseDic(decodeDictionary(dic, enc)); err != nil {
+		return nil, fmt.Errorf("%s.dic: %w", path, err)
+	}
+	return d, nil
+}
+
+// decodeDictionary decodes the contents of a dictionary file in the given
+// encoding to UTF-8.
+func decodeDictionary(b []byte, enc string) []byte {
+	if enc != "ISO8859-1" {
+		return b
+	}
+
+	var buf bytes.Buffer
+
+	for _, c := range b {
+		buf.WriteRune(rune(c))
+	}
+	return buf.Bytes()
+}
+
+// parseFlags parses the flags of a word, which may be the number of an alias
+// given via AF.
+func (d *Dictionary) parseFlags(s string) []string {
+	if len(d.aliases) > 0 {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 && n <= len(d.aliases) {
+			return d.aliases[n-1]
+		}
+	}
+	return d.splitFlags(s)
+}
+
+// splitFlags splits the given flags as per the FLAG type of the dictionary.
+func (d *Dictionary) splitFlags(s string) []string {
+	flags := make([]string, 0, len(s))
+
+	switch d.flagType {
+	case "long":
+		for i := 0; i+1 < len(s); i += 2 {
+			flags = append(flags, s[i:i+2])
+		}
+	case "num":
+		for _, f := range strings.Split(s, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				flags = append(flags, f)
+			}
+		}
+	default:
+		for _, r := range s {
+			flags = append(flags, string(r))
+		}
+	}
+	return flags
+}
+
+// affixCondition returns the regular expression for the given affix
+// condition, which is anchored to the start of the word for prefixes, and the
+// end for suffixes.
+func affixCondition(cond string, prefix bool) (*regexp.Regexp, error) {
+	if cond == "." {
+		return nil, nil
+	}
+
+	var buf strings.Builder
+
+	inClass := false
+
+	for _, r := range cond {
+		switch {
+		case r == '[':
+			inClass = true
+			buf.WriteRune(r)
+		case r == ']':
+			inClass = false
+			buf.WriteRune(r)
+		case inClass:
+			if r == '\\' || r == '-' {
+				buf.WriteRune('\\')
+			}
+			buf.WriteRune(r)
+		case r == '.':
+			buf.WriteRune(r)
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	if prefix {
+		return regexp.Compile("^" + buf.String())
+	}
+	return regexp.Compile(buf.String() + "$")
+}
+
+// parseAffix parses the given affix file, returning its encoding.
+func (d *Dictionary) parseAffix(b []byte) (string, error) {
+	enc := "UTF-8"
+
+	// The encoding must be known before anything else can be parsed.
+	for _, line := range strings.Split(string(b), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "SET" {
+			enc = strings.ToUpper(fields[1])
+		}
+	}
+
+	switch enc {
+	case "UTF-8", "ISO8859-1":
+	default:
+		return "", fmt.Errorf("%w: %s", ErrEncoding, enc)
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(decodeDictionary(b, enc)))
+
+	// The header of each affix class, by its flag.
+	cross := make(map[string]bool)
+
+	aliases := false
+
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "FLAG":
+			if len(fields) > 1 {
+				d.flagType = fields[1]
+			}
+		case "AF":
+			// The first AF line is the number of aliases that follow.
+			if !aliases {
+				aliases = true
+				d.aliases = make([][]string, 0)
+				continue
+			}
+
+			if len(fields) > 1 {
+				d.aliases = append(d.aliases, d.splitFlags(fields[1]))
+			}
+		case "FORBIDDENWORD":
+			if len(fields) > 1 {
+				d.forbidden = fields[1]
+			}
+		case "NEEDAFFIX":
+			if len(fields) > 1 {
+				d.needAffix = fields[1]
+			}
+		case "NOSUGGEST":
+			if len(fields) > 1 {
+				d.noSuggest = fields[1]
+			}
+		case "TRY":
+			if len(fields) > 1 {
+				d.try = fields[1]
+			}
+		case "REP":
+			if len(fields) > 2 {
+				d.rep = append(d.rep, [2]string{
+					strings.ReplaceAll(fields[1], "_", " "),
+					strings.ReplaceAll(fields[2], "_", " "),
+				})
+			}
+		case "PFX", "SFX":
+			if len(fields) < 4 {
+				continue
+			}
+
+			flag := fields[1]
+
+			if _, ok := cross[flag+fields[0]]; !ok {
+				cross[flag+fields[0]] = fields[2] == "Y"
+				continue
+			}
+
+			strip := fields[2]
+
+			if strip == "0" {
+				strip = ""
+			}
+
+			add, cont, _ := strings.Cut(fields[3], "/")
+
+			if add == "0" {
+				add = ""
+			}
+
+			cond := "."
+
+			if len(fields) > 4 {
+				cond = fields[4]
+			}
+
+			re, err := affixCondition(cond, fields[0] == "PFX")
+
+			if err != nil {
+				return "", err
+			}
+
+			a := &affix{
+				flag:  flag,
+				cross: cross[flag+fields[0]],
+				strip: strip,
+				add:   add,
+				cond:  re,
+			}
+
+			if cont != "" {
+				a.cont = d.parseFlags(cont)
+			}
+
+			if fields[0] == "PFX" {
+				d.prefixes = append(d.prefixes, a)
+			} else {
+				d.suffixes = append(d.suffixes, a)
+			}
+		}
+	}
+	return enc, sc.Err()
+}
+
+// parseDic parses the given dic file, the first line of which is the number
+// of words.
+func (d *Dictionary) parseDic(b []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(b))
+
+	first := true
+
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+
+		if first {
+			first = false
+
+			if _, err := strconv.Atoi(line); err == nil {
+				continue
+			}
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Anything after whitespace is morphological information.
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			line = line[:i]
+		}
+
+		word, flags := line, ""
+
+		// A slash escaped with a backslash is part of the word.
+		for i := 0; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+				continue
+			}
+
+			if line[i] == '/' {
+				word, flags = line[:i], line[i+1:]
+				break
+			}
+		}
+
+		word = strings.ReplaceAll(word, `\/`, "/")
+
+		d.Add(word, d.parseFlags(flags)...)
+	}
+	return sc.Err()
+}
+
+// Add adds the word to the dictionary with the given flags.
+func (d *Dictionary) Add(word string, flags ...string) {
+	set, ok := d.words[word]
+
+	if !ok {
+		set = make(map[string]struct{})
+		d.words[word] = set
+	}
+
+	for _, f := range flags {
+		set[f] = struct{}{}
+	}
+}
+
+func (d *Dictionary) hasFlag(word, flag string) bool {
+	if flag == "" {
+		return false
+	}
+
+	set, ok := d.words[word]
+
+	if !ok {
+		return false
+	}
+
+	_, ok = set[flag]
+	return ok
+}
+
+// lookup returns whether the exact word is in the dictionary, either as is,
+// or via its affixes.
+func (d *Dictionary) lookup(word string) bool {
+	if _, ok := d.words[word]; ok {
+		if d.hasFlag(word, d.forbidden) {
+			return false
+		}
+
+		if !d.hasFlag(word, d.needAffix) {
+			return true
+		}
+	}
+
+	for _, sfx := range d.suffixes {
+		if !strings.HasSuffix(word, sfx.add) || len(word) == len(sfx.add) {
+			continue
+		}
+
+		base := word[:len(word)-len(sfx.add)] + sfx.strip
+
+		if sfx.cond != nil && !sfx.cond.MatchString(base) {
+			continue
+		}
+
+		// A suffix that continues with NEEDAFFIX must be followed by
+		// another.
+		if d.hasFlag(base, sfx.flag) && !d.hasFlag(base, d.forbidden) && !sfx.continues(d.needAffix) {
+			return true
+		}
+
+		if d.affixed(base, sfx.flag) {
+			return true
+		}
+
+		if !sfx.cross {
+			continue
+		}
+
+		for _, pfx := range d.prefixes {
+			if !pfx.cross || !strings.HasPrefix(base, pfx.add) || len(base) == len(pfx.add) {
+				continue
+			}
+
+			root := pfx.strip + base[len(pfx.add):]
+
+			if pfx.cond != nil && !pfx.cond.MatchString(root) {
+				continue
+			}
+
+			if d.hasFlag(root, pfx.flag) && d.hasFlag(root, sfx.flag) {
+				return true
+			}
+		}
+	}
+
+	for _, pfx := range d.prefixes {
+		if !strings.HasPrefix(word, pfx.add) || len(word) == len(pfx.add) {
+			continue
+		}
+
+		base := pfx.strip + word[len(pfx.add):]
+
+		if pfx.cond != nil && !pfx.cond.MatchString(base) {
+			continue
+		}
+
+		if d.hasFlag(base, pfx.flag) && !d.hasFlag(base, d.forbidden) && !pfx.continues(d.needAffix) {
+			return true
+		}
+
+		if d.affixed(base, pfx.flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// affixed returns whether the word is made from a word of the dictionary by a
+// single affix, the continuation flags of which include the given flag.
+func (d *Dictionary) affixed(word, flag string) bool {
+	for _, sfx := range d.suffixes {
+		if !sfx.continues(flag) || !strings.HasSuffix(word, sfx.add) || len(word) == len(sfx.add) {
+			continue
+		}
+
+		base := word[:len(word)-len(sfx.add)] + sfx.strip
+
+		if sfx.cond != nil && !sfx.cond.MatchString(base) {
+			continue
+		}
+
+		if d.hasFlag(base, sfx.flag) && !d.hasFlag(base, d.forbidden) {
+			return true
+		}
+	}
+
+	for _, pfx := range d.prefixes {
+		if !pfx.continues(flag) || !strings.HasPrefix(word, pfx.add) || len(word) == len(pfx.add) {
+			continue
+		}
+
+		base := pfx.strip + word[len(pfx.add):]
+
+		if pfx.cond != nil && !pfx.cond.MatchString(base) {
+			continue
+		}
+
+		if d.hasFlag(base, pfx.flag) && !d.hasFlag(base, d.forbidden) {
+			return true
+		}
+	}
+	return false
+}
+
+// capitalize returns the word with its first letter in uppercase, and the rest
+// in lowercase.
+func capitalize(word string) string {
+	r, n := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + strings.ToLower(word[n:])
+}
+
+// Check returns whether the word is spelled correctly. Words in lowercase in
+// the dictionary may also be capitalized, or in uppercase.
+func (d *Dictionary) Check(word string) bool {
+	if word == "" || d.lookup(word) {
+		return true
+	}
+
+	lower := strings.ToLower(word)
+
+	if word == capitalize(word) {
+		return d.lookup(lower)
+	}
+
+	if word == strings.ToUpper(word) {
+		return d.lookup(lower) || d.lookup(capitalize(word))
+	}
+	return false
+}
+
+// Suggest returns up to n suggestions for the given misspelled word. These are
+// taken from the REP table of the dictionary, then from words one edit away.
+func (d *Dictionary) Suggest(word string, n int) []string {
+	suggestions := make([]string, 0, n)
+	seen := make(map[string]struct{})
+
+	capital := word == capitalize(word)
+
+	add := func(s string) bool {
+		if _, ok := seen[s]; ok {
+			return len(suggestions) >= n
+		}
+		seen[s] = struct{}{}
+
+		if s == word {
+			return len(suggestions) >= n
+		}
+
+		// Suggestions from the REP table, or from splitting the word, may be
+		// more than one word.
+		for _, w := range strings.Fields(s) {
+			if !d.Check(w) || d.hasFlag(w, d.noSuggest) {
+				return len(suggestions) >= n
+			}
+		}
+
+		if capital {
+			s = capitalize(s)
+		}
+
+		suggestions = append(suggestions, s)
+		return len(suggestions) >= n
+	}
+
+	lower := strings.ToLower(word)
+
+	for _, rep := range d.rep {
+		for i := strings.Index(lower, rep[0]); i >= 0; {
+			if add(lower[:i] + rep[1] + lower[i+len(rep[0]):]) {
+				return suggestions
+			}
+
+			j := strings.Index(lower[i+1:], rep[0])
+
+			if j < 0 {
+				break
+			}
+			i += j + 1
+		}
+	}
+
+	try := d.try
+
+	if try == "" {
+		try = "esianrtolcdugmphbyfvkwzxjq'"
+	}
+
+	runes := []rune(lower)
+
+	edits := make([]string, 0)
+
+	for i := range runes {
+		// Swap adjacent characters.
+		if i+1 < len(runes) {
+			swap := append([]rune{}, runes...)
+			swap[i], swap[i+1] = swap[i+1], swap[i]
+			edits = append(edits, string(swap))
+		}
+
+		// Replace a character.
+		for _, r := range try {
+			if r != runes[i] {
+				edits = append(edits, string(runes[:i])+string(r)+string(runes[i+1:]))
+			}
+		}
+
+		// Remove a character.
+		edits = append(edits, string(runes[:i])+string(runes[i+1:]))
+	}
+
+	// Insert a character.
+	for i := 0; i <= len(runes); i++ {
+		for _, r := range try {
+			edits = append(edits, string(runes[:i])+string(r)+string(runes[i:]))
+		}
+	}
+
+	for _, e := range edits {
+		if add(e) {
+			return suggestions
+		}
+	}
+
+	// Split into two words.
+	for i := 2; i < len(runes)-1; i++ {
+		if add(string(runes[:i]) + " " + string(runes[i:])) {
+			return suggestions
+		}
+	}
+	return suggestions
+}
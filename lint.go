@@ -0,0 +1,606 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"book/mom"
+)
+
+var LintCmd = &Command{
+	Usage: "lint <-enable checks> <-disable checks> <-list> <file...>",
+	Short: "check the structure of manuscripts",
+	Long: `Check the structure of the given manuscripts for common mistakes that would
+otherwise only show up as an odd looking document, or a wrong word count. Each
+problem found is printed as,
+
+    file:line: check: message
+
+and the command exits with a non-zero status if any are found, so it can be
+used in CI. The checks are,
+
+    epigraph - an EPIGRAPH that is not turned off, or turned off when not on
+    inline   - an inline IT, BD, or BDI without a PREV before the paragraph ends
+    start    - a chapter without a START
+    collate  - a chapter that is not preceded by a COLLATE
+    metadata - a DOCTITLE or AUTHOR that is missing or given more than once
+    macro    - an unknown macro
+
+The -enable flag only runs the given comma separated checks, and the -disable
+flag runs every check but those given. The -list flag lists the checks.
+
+A problem can be ignored by placing a lint:ignore comment on the line before
+it, optionally followed by the checks to ignore, for example,
+
+    \# lint:ignore macro
+    .MY_MACRO
+`,
+	Run: lintCmd,
+}
+
+var (
+	ErrLint      = errors.New("lint failed")
+	ErrLintCheck = errors.New("unknown lint check")
+)
+
+// LintIssue is a problem found in a manuscript by a lint check.
+type LintIssue struct {
+	File    string
+	Line    int
+	Check   string
+	Message string
+}
+
+func (i *LintIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", i.File, i.Line, i.Check, i.Message)
+}
+
+// LintCheck is a named check run against a manuscript.
+type LintCheck struct {
+	Name string
+	Desc string
+
+	// Run returns the issues found in the manuscript. The file of each issue
+	// is set by [Lint].
+	Run func(ms *mom.Manuscript) []*LintIssue
+}
+
+// LintChecks are the checks that can be run against a manuscript.
+var LintChecks = []*LintCheck{
+	{Name: "epigraph", Desc: "an EPIGRAPH that is not turned off, or turned off when not on", Run: lintEpigraph},
+	{Name: "inline", Desc: "an inline IT, BD, or BDI without a PREV before the paragraph ends", Run: lintInline},
+	{Name: "start", Desc: "a chapter without a START", Run: lintStart},
+	{Name: "collate", Desc: "a chapter that is not preceded by a COLLATE", Run: lintCollate},
+	{Name: "metadata", Desc: "a DOCTITLE or AUTHOR that is missing or given more than once", Run: lintMetadata},
+	{Name: "macro", Desc: "an unknown macro", Run: lintMacro},
+}
+
+// LookupLintChecks returns the checks for the given comma separated list of
+// names.
+func LookupLintChecks(s string) ([]*LintCheck, error) {
+	checks := make([]*LintCheck, 0)
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		found := false
+
+		for _, c := range LintChecks {
+			if c.Name == name {
+				checks = append(checks, c)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("%w %q", ErrLintCheck, name)
+		}
+	}
+	return checks, nil
+}
+
+// lintIgnores returns the checks ignored for each line of the manuscript via
+// lint:ignore comments. The empty check name means every check is ignored.
+func lintIgnores(ms *mom.Manuscript) map[int]map[string]struct{} {
+	ignores := make(map[int]map[string]struct{})
+
+	var pending map[string]struct{}
+
+	for _, tok := range ms.Tokens {
+		if c, ok := tok.(mom.Comment); ok {
+			s := strings.TrimSpace(strings.TrimPrefix(c.Value, `\#`))
+
+			rest, ok := strings.CutPrefix(s, "lint:ignore")
+
+			if !ok || (rest != "" && rest[0] != ' ') {
+				continue
+			}
+
+			if pending == nil {
+				pending = make(map[string]struct{})
+			}
+
+			names := strings.FieldsFunc(rest, func(r rune) bool {
+				return r == ',' || r == ' '
+			})
+
+			if len(names) == 0 {
+				names = []string{""}
+			}
+
+			for _, name := range names {
+				pending[name] = struct{}{}
+			}
+			continue
+		}
+
+		if pending != nil {
+			ignores[ms.Line(tok)] = pending
+			pending = nil
+		}
+	}
+	return ignores
+}
+
+// Lint runs the given checks against the manuscript, and returns the issues
+// found sorted by line. Issues ignored via lint:ignore comments are not
+// returned.
+func Lint(ms *mom.Manuscript, checks []*LintCheck) []*LintIssue {
+	ignores := lintIgnores(ms)
+
+	issues := make([]*LintIssue, 0)
+
+	for _, c := range checks {
+		for _, issue := range c.Run(ms) {
+			if set, ok := ignores[issue.Line]; ok {
+				_, all := set[""]
+				_, ignored := set[c.Name]
+
+				if all || ignored {
+					continue
+				}
+			}
+
+			issue.File = ms.Name
+			issue.Check = c.Name
+
+			issues = append(issues, issue)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
+
+func lintEpigraph(ms *mom.Manuscript) []*LintIssue {
+	issues := make([]*LintIssue, 0)
+
+	var open mom.Token
+
+	// block is whether the open EPIGRAPH is a block epigraph, which may be
+	// more than one paragraph.
+	block := false
+
+	closeAt := func(tok mom.Token) {
+		if open != nil {
+			issues = append(issues, &LintIssue{
+				Line:    ms.Line(open),
+				Message: "EPIGRAPH is not turned off before " + tok.(*mom.Macro).Name,
+			})
+		}
+		open = nil
+	}
+
+	for _, tok := range ms.Tokens {
+		m, ok := tok.(*mom.Macro)
+
+		if !ok {
+			continue
+		}
+
+		switch m.Name {
+		case "EPIGRAPH":
+			// Any argument given to EPIGRAPH other than BLOCK turns it off.
+			if len(m.Args) > 0 && m.Arg(0) != "BLOCK" {
+				if open == nil {
+					issues = append(issues, &LintIssue{
+						Line:    ms.Line(tok),
+						Message: "EPIGRAPH " + m.Arg(0) + " without an EPIGRAPH",
+					})
+				}
+				open = nil
+				continue
+			}
+
+			if open != nil {
+				closeAt(tok)
+			}
+			open = tok
+			block = m.Arg(0) == "BLOCK"
+		case "PP":
+			if !block {
+				closeAt(tok)
+			}
+		case "COLLATE", "CHAPTER", "CHAPTER_TITLE":
+			closeAt(tok)
+		}
+	}
+
+	if open != nil {
+		issues = append(issues, &LintIssue{
+			Line:    ms.Line(open),
+			Message: "EPIGRAPH is not turned off",
+		})
+	}
+	return issues
+}
+
+func lintInline(ms *mom.Manuscript) []*LintIssue {
+	issues := make([]*LintIssue, 0)
+
+	var (
+		open mom.Token
+		font string
+	)
+
+	end := func() {
+		if open != nil {
+			issues = append(issues, &LintIssue{
+				Line:    ms.Line(open),
+				Message: `\*[` + font + `] without a \*[PREV] before the end of the paragraph`,
+			})
+		}
+		open = nil
+	}
+
+	for _, tok := range ms.Tokens {
+		switch v := tok.(type) {
+		case *mom.Macro:
+			switch v.Name {
+			case "PP", "COLLATE", "CHAPTER", "CHAPTER_TITLE", "EPIGRAPH", "LINEBREAK", "START":
+				end()
+			}
+		case *mom.Text:
+			if !strings.Contains(v.Value, `\*`) {
+				continue
+			}
+
+			for _, t := range mom.Tokenize(v.Value) {
+				in, ok := t.(*mom.Inline)
+
+				if !ok {
+					continue
+				}
+
+				switch in.Escape {
+				case "IT", "BD", "BDI":
+					if open == nil {
+						open = tok
+					}
+					font = in.Escape
+				case "PREV", "ROM", "R":
+					open = nil
+				}
+			}
+		}
+	}
+	end()
+	return issues
+}
+
+// lintChapter is a chapter as seen by the lint checks, from the macro that
+// starts it.
+type lintChapter struct {
+	tok     mom.Token
+	started bool
+	collate bool // collate is whether a COLLATE came before the chapter.
+}
+
+// lintChapters returns the chapters of the manuscript. Unlike
+// [mom.Manuscript.Chapters] this does not rely on COLLATE to find the end of a
+// chapter.
+func lintChapters(ms *mom.Manuscript) []*lintChapter {
+	chapters := make([]*lintChapter, 0)
+
+	var ch *lintChapter
+
+	// heading is whether we are within the heading of a chapter, so a
+	// CHAPTER_TITLE following a CHAPTER is part of the same chapter.
+	heading := false
+	collate := false
+
+	for _, tok := range ms.Tokens {
+		m, ok := tok.(*mom.Macro)
+
+		if !ok {
+			continue
+		}
+
+		switch m.Name {
+		case "CHAPTER_TITLE":
+			if heading {
+				continue
+			}
+			fallthrough
+		case "CHAPTER":
+			ch = &lintChapter{tok: tok, collate: collate}
+			chapters = append(chapters, ch)
+
+			heading = true
+			collate = false
+		case "START":
+			if ch != nil {
+				ch.started = true
+			}
+			heading = false
+		case "COLLATE":
+			collate = true
+		}
+	}
+	return chapters
+}
+
+func lintStart(ms *mom.Manuscript) []*LintIssue {
+	issues := make([]*LintIssue, 0)
+
+	for _, ch := range lintChapters(ms) {
+		if !ch.started {
+			issues = append(issues, &LintIssue{
+				Line:    ms.Line(ch.tok),
+				Message: "chapter without a START",
+			})
+		}
+	}
+	return issues
+}
+
+func lintCollate(ms *mom.Manuscript) []*LintIssue {
+	issues := make([]*LintIssue, 0)
+
+	for i, ch := range lintChapters(ms) {
+		if i > 0 && !ch.collate {
+			issues = append(issues, &LintIssue{
+				Line:    ms.Line(ch.tok),
+				Message: "missing COLLATE before chapter",
+			})
+		}
+	}
+	return issues
+}
+
+func lintMetadata(ms *mom.Manuscript) []*LintIssue {
+	issues := make([]*LintIssue, 0)
+
+	for _, name := range []string{"DOCTITLE", "AUTHOR"} {
+		count := 0
+
+		for _, tok := range ms.Tokens {
+			if m, ok := tok.(*mom.Macro); ok && m.Name == name {
+				count++
+
+				if count > 1 {
+					issues = append(issues, &LintIssue{
+						Line:    ms.Line(tok),
+						Message: name + " given more than once",
+					})
+				}
+			}
+		}
+
+		if count == 0 {
+			issues = append(issues, &LintIssue{
+				Line:    1,
+				Message: "missing " + name,
+			})
+		}
+	}
+	return issues
+}
+
+// momMacros are the macros of mom that may be used in a manuscript, as listed
+// in the macro reference of its documentation, along with the macros of the
+// preprocessors groff runs for mom.
+var momMacros = map[string]struct{}{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		ALIAS ALIASN MAC END NEWPAGE BLANKPAGE SILENT COMMENT
+		PAPER PAGE PAGEWIDTH PAGELENGTH L_MARGIN R_MARGIN T_MARGIN B_MARGIN
+		FAMILY FAM FT FALLBACK_FONT PT_SIZE PS LS LL AUTOLEAD
+		JUSTIFY QUAD LEFT RIGHT CENTER CENTRE BR EL SPREAD
+		HY HY_SET WS SS KERN RW EW BR_AT_LINE_KERN CONDENSE EXTEND LIGATURES
+		ALD RLD SPACE SP ADD_SPACE SHIM NO_SHIM FLEX NO_FLEX
+		TAB_SET ST TAB TN TQ MCO MCR MCX
+		IL IR IB IQ IX ILX IRX IBX TI HI
+		CAPS SMALLCAPS UNDERLINE UNDERSCORE UNDERSCORE2 PAD LEADER
+		LEADER_CHARACTER DROPCAP DROPCAP_ADJUST DROPCAP_FAMILY DROPCAP_FONT
+		DROPCAP_COLOR DROPCAP_GUTTER DRH DRV DBX DCL RULE_WEIGHT
+		NEWCOLOR XCOLOR COLOR SMARTQUOTES PDF_IMAGE PDF_LINK PDF_TARGET
+		PDF_TITLE
+		DOCTYPE PRINTSTYLE COPYSTYLE START COLLATE COLUMNS COL_NEXT COL_BREAK
+		TITLE DOCTITLE SUBTITLE AUTHOR CHAPTER CHAPTER_TITLE CHAPTER_STRING
+		COPYRIGHT MISC DRAFT REVISION COVERTITLE DOC_COVERTITLE DOCHEADER
+		COVER DOC_COVER COVERS DOC_COVERS
+		DOC_FAMILY DOC_PT_SIZE DOC_LEAD DOC_LEAD_ADJUST DOC_QUAD
+		DOC_LEFT_MARGIN DOC_RIGHT_MARGIN DOC_LINE_LENGTH
+		PP PARA_INDENT PARA_SPACE INDENT_FIRST_PARAS
+		HEAD SUBHEAD SUBSUBHEAD PARAHEAD NUMBER_HEADS NUMBER_SUBHEADS
+		NUMBER_PARAHEADS PREFIX_CHAPTER_NUMBER
+		EPIGRAPH QUOTE BLOCKQUOTE BREAK_QUOTE CODE LINEBREAK FINIS
+		LIST ITEM SHIFT_LIST RESET_LIST PAD_LIST_DIGITS
+		FOOTNOTE ENDNOTE ENDNOTES MN MARGIN_NOTE NUMBER_LINES
+		BIBLIOGRAPHY BIBLIOGRAPHY_TYPE REF TOC TOC_HEADER_STRING FLOAT
+		HEADERS FOOTERS HEADER FOOTER HEADER_LEFT HEADER_CENTER
+		HEADER_CENTRE HEADER_RIGHT FOOTER_LEFT FOOTER_CENTER FOOTER_CENTRE
+		FOOTER_RIGHT HEADER_RECTO HEADER_VERSO FOOTER_RECTO FOOTER_VERSO
+		HEADER_RULE FOOTER_RULE SWITCH_HEADERS RECTO_VERSO
+		PAGINATE PAGINATION PAGENUMBER PAGENUM_STYLE PAGENUM_POS
+		TS TE EQ EN PS PE GS GE R1 R2 [ ]
+	`) {
+		momMacros[name] = struct{}{}
+	}
+}
+
+// defineMacros are the requests and macros that define a new macro, along with
+// the line that ends the definition.
+var defineMacros = map[string]string{
+	"MAC": "END",
+	"de":  ".",
+	"de1": ".",
+	"am":  ".",
+	"ami": ".",
+}
+
+func lintMacro(ms *mom.Manuscript) []*LintIssue {
+	defined := make(map[string]struct{})
+
+	// Collect the user defined macros first, so macros can be used before
+	// they are defined.
+	for _, tok := range ms.Tokens {
+		if m, ok := tok.(*mom.Macro); ok {
+			switch m.Name {
+			case "MAC", "de", "de1", "am", "ami", "als", "rn":
+				defined[m.Arg(0)] = struct{}{}
+			}
+		}
+	}
+
+	issues := make([]*LintIssue, 0)
+
+	// end is the macro that ends the definition we are within, if any.
+	end := ""
+
+	for _, tok := range ms.Tokens {
+		m, ok := tok.(*mom.Macro)
+
+		if !ok {
+			continue
+		}
+
+		if end != "" {
+			if m.Name == end {
+				end = ""
+			}
+			continue
+		}
+
+		if e, ok := defineMacros[m.Name]; ok {
+			end = e
+
+			// The end of the definition may be given as the second argument.
+			if m.Name != "MAC" && m.Arg(1) != "" {
+				end = m.Arg(1)
+			}
+			continue
+		}
+
+		// Requests of groff itself are lowercase, so only the names of
+		// macros are checked.
+		if m.Name == "" || m.Name == "." || strings.ToUpper(m.Name) != m.Name {
+			continue
+		}
+
+		if _, ok := momMacros[m.Name]; ok {
+			continue
+		}
+
+		if _, ok := defined[m.Name]; ok {
+			continue
+		}
+
+		issues = append(issues, &LintIssue{
+			Line:    ms.Line(tok),
+			Message: "unknown macro " + m.Name,
+		})
+	}
+	return issues
+}
+
+func lintCmd(cmd *Command, args []string) error {
+	var (
+		enable  string
+		disable string
+		list    bool
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.StringVar(&enable, "enable", "", "only run the given checks")
+	fs.StringVar(&disable, "disable", "", "do not run the given checks")
+	fs.BoolVar(&list, "list", false, "list the checks")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if list {
+		for _, c := range LintChecks {
+			cmd.Printf("%-8s - %s\n", c.Name, c.Desc)
+		}
+		return nil
+	}
+
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	checks := LintChecks
+
+	if enable != "" {
+		enabled, err := LookupLintChecks(enable)
+
+		if err != nil {
+			return err
+		}
+		checks = enabled
+	}
+
+	if disable != "" {
+		disabled, err := LookupLintChecks(disable)
+
+		if err != nil {
+			return err
+		}
+
+		tmp := make([]*LintCheck, 0, len(checks))
+
+	loop:
+		for _, c := range checks {
+			for _, d := range disabled {
+				if c == d {
+					continue loop
+				}
+			}
+			tmp = append(tmp, c)
+		}
+		checks = tmp
+	}
+
+	n := 0
+
+	for _, file := range args {
+		ms, err := mom.ParseManuscript(file)
+
+		if err != nil {
+			return err
+		}
+
+		for _, issue := range Lint(ms, checks) {
+			cmd.Println(issue)
+			n++
+		}
+	}
+
+	if n > 0 {
+		return fmt.Errorf("%w: %d issue(s)", ErrLint, n)
+	}
+	return nil
+}
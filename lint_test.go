@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/mom"
+)
+
+func TestLint(t *testing.T) {
+	file := filepath.Join("testdata", "lint", "broken.mom")
+
+	issues := []string{
+		file + ":1: metadata: missing AUTHOR",
+		file + ":2: metadata: DOCTITLE given more than once",
+		file + ":7: start: chapter without a START",
+		file + ":8: epigraph: EPIGRAPH is not turned off before PP",
+		file + ":11: inline: \\*[IT] without a \\*[PREV] before the end of the paragraph",
+		file + ":15: macro: unknown macro FOO",
+		file + ":20: collate: missing COLLATE before chapter",
+		file + ":22: epigraph: EPIGRAPH OFF without an EPIGRAPH",
+		"",
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{[]string{file}, issues, ErrLint},
+		{[]string{"-enable", "start,collate", "-disable", "collate", file}, []string{issues[2], ""}, ErrLint},
+		{[]string{"-disable", "metadata", filepath.Join("testdata", "chapters.mom")}, []string{""}, nil},
+		{[]string{"-enable", "start,typo", file}, nil, ErrLintCheck},
+		{[]string{"-disable", "typo", file}, nil, ErrLintCheck},
+		{[]string{}, nil, ErrUsage},
+	}
+
+	for _, test := range tests {
+		buf := CaptureOutput(LintCmd)
+
+		if err := lintCmd(LintCmd, test.args); !errors.Is(err, test.err) {
+			t.Fatalf("lintCmd(LintCmd, %v) = %v, want = %v", test.args, err, test.err)
+		}
+
+		if test.want == nil {
+			continue
+		}
+
+		if diff := cmp.Diff(strings.Join(test.want, "\n"), buf.String()); diff != "" {
+			t.Errorf("lintCmd(LintCmd, %v) mismatch (-want +got):\n%s", test.args, diff)
+		}
+	}
+}
+
+func TestLintCheck(t *testing.T) {
+	tests := []struct {
+		check string
+		file  string
+		want  []string
+	}{
+		{
+			"epigraph",
+			"epigraph.mom",
+			[]string{
+				":11: epigraph: EPIGRAPH is not turned off before PP",
+				":18: epigraph: EPIGRAPH is not turned off before COLLATE",
+				":23: epigraph: EPIGRAPH END without an EPIGRAPH",
+			},
+		},
+		{
+			"macro",
+			"macro.mom",
+			[]string{
+				":13: macro: unknown macro HEADING",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join("testdata", "lint", test.file)
+
+		ms, err := mom.ParseManuscript(file)
+
+		if err != nil {
+			t.Fatalf("ParseManuscript(%q): %v\n", file, err)
+		}
+
+		checks, err := LookupLintChecks(test.check)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]string, 0)
+
+		for _, issue := range Lint(ms, checks) {
+			got = append(got, strings.TrimPrefix(issue.String(), file))
+		}
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Lint(%q, %q) mismatch (-want +got):\n%s", file, test.check, diff)
+		}
+	}
+}
+
+func TestLintTestdata(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.mom"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		ms, err := mom.ParseManuscript(file)
+
+		if err != nil {
+			t.Fatalf("ParseManuscript(%q): %v\n", file, err)
+		}
+
+		for _, issue := range Lint(ms, LintChecks) {
+			t.Errorf("Lint(%q): %s", file, issue)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 	"unicode/utf8"
+
+	"book/mom"
 )
 
 var LsCmd = &Command{
@@ -40,11 +42,11 @@ func lsCmd(cmd *Command, args []string) error {
 			return err
 		}
 
-		books := make([]*Manuscript, 0, len(names))
+		books := make([]*mom.Manuscript, 0, len(names))
 		pad := 0
 
 		for _, name := range names {
-			ms, err := ParseManuscript(name)
+			ms, err := mom.ParseManuscript(name)
 
 			if err != nil {
 				return err
@@ -74,7 +76,7 @@ func lsCmd(cmd *Command, args []string) error {
 		return nil
 	}
 
-	ms, err := ParseManuscript(args[0])
+	ms, err := mom.ParseManuscript(args[0])
 
 	if err != nil {
 		return err
@@ -3,6 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+
+	// The exporters register themselves with the pub command when imported.
+	_ "book/export/docx"
+	_ "book/export/groff"
+	_ "book/export/pdf"
 )
 
 func run(args []string) error {
@@ -16,11 +21,21 @@ Usage:
 `,
 	}
 
+	cmds.Add("cast", CastCmd)
 	cmds.Add("cat", CatCmd)
 	cmds.Add("clean", CleanCmd)
+	cmds.Add("consistency", ConsistencyCmd)
+	cmds.Add("dialogue", DialogueCmd)
+	cmds.Add("echoes", EchoesCmd)
+	cmds.Add("lint", LintCmd)
 	cmds.Add("ls", LsCmd)
 	cmds.Add("new", NewCmd)
 	cmds.Add("pub", PubCmd)
+	cmds.Add("review", ReviewCmd)
+	cmds.Add("spell", SpellCmd)
+	cmds.Add("stats", StatsCmd)
+	cmds.Add("style", StyleCmd)
+	cmds.Add("typo", TypoCmd)
 	cmds.Add("wc", WcCmd)
 
 	cmds.Add("help", HelpCmd(&cmds))
@@ -1,4 +1,6 @@
-package main
+// Package mom parses manuscripts written with the groff mom macros into their
+// tokens, chapters, and paragraphs.
+package mom
 
 import (
 	"bytes"
@@ -179,7 +181,7 @@ type Comment struct {
 
 // Words returns a slice of all the words in the Text token. A word in this case
 // is any sequence of runes that is considered a letter via [unicode.IsLetter].
-// This will split words on spaces and em-dashes.
+// This will split words on spaces, em-dashes, and ellipses.
 func (t *Text) Words() []string {
 	if t.Value == "" || t.Value == " " {
 		return nil
@@ -210,7 +212,7 @@ func (t *Text) Words() []string {
 		}
 
 		switch r {
-		case ' ', '—':
+		case ' ', '—', '…':
 			if len(tmp) > 0 {
 				words = append(words, string(tmp))
 			}
@@ -266,6 +268,28 @@ func (i *Inline) aToken() {}
 
 func (i *Inline) WriteTo(w io.Writer) error { return nil }
 
+// PlainText returns the given string with all inline escape macros removed,
+// except for the quote escapes which are replaced with their respective
+// characters.
+func PlainText(s string) string {
+	var buf bytes.Buffer
+
+	for _, tok := range Tokenize(s) {
+		switch v := tok.(type) {
+		case *Inline:
+			switch v.Escape {
+			case "lq":
+				buf.WriteString("“")
+			case "rq":
+				buf.WriteString("”")
+			}
+		case *Text:
+			buf.WriteString(v.Value)
+		}
+	}
+	return buf.String()
+}
+
 // Tokenize splits up the given string into a slice of tokens. The tokens in the
 // slice will either be of type [Text] or [Inline]. This is used to ensure that
 // inline escape macros for can be used to format the text appropriately for the
@@ -340,7 +364,14 @@ func Tokenize(txt string) []Token {
 // Manuscript represents the parsed groff mom file. The file contents is parsed
 // into a [Token] slice, which will either be of type [Macro] or [Text].
 type Manuscript struct {
+	// Name is the name of the file the manuscript was parsed from.
+	Name string
+
 	Tokens []Token
+
+	// Lines maps each token to the line of the file it was parsed from.
+	// Tokens added after parsing will not be in the map.
+	Lines map[Token]int
 }
 
 // ParseManuscript parses a groff mom manuscript from the given file. The file
@@ -438,11 +469,26 @@ func ParseManuscript(name string) (*Manuscript, error) {
 		})
 	}
 
+	// Each line is parsed into a single token.
+	lines := make(map[Token]int)
+
+	for i, tok := range toks {
+		lines[tok] = i + 1
+	}
+
 	return &Manuscript{
+		Name:   name,
 		Tokens: toks,
+		Lines:  lines,
 	}, nil
 }
 
+// Line returns the line of the file the given token was parsed from, or zero
+// if the token was not parsed from the file.
+func (ms *Manuscript) Line(tok Token) int {
+	return ms.Lines[tok]
+}
+
 // Macro returns the first macro by the given name. This should be used for
 // macros that will only appear once in a manuscript, such as DOCTITLE or
 // AUTHOR.
@@ -469,6 +515,92 @@ func (ms *Manuscript) Get(macro string) string {
 	return ""
 }
 
+// Expand expands the string escapes in the given string. This will expand the
+// $DOCTITLE and $AUTHOR strings, along with any strings defined via the ds
+// macro. Strings that are not defined are expanded to nothing, which is
+// consistent with how groff works.
+func (ms *Manuscript) Expand(s string) string {
+	return ms.expand(s, 0)
+}
+
+func (ms *Manuscript) expand(s string, depth int) string {
+	// Guard against strings that are defined in terms of themselves.
+	if depth > 8 || !strings.Contains(s, `*`) {
+		return s
+	}
+
+	var buf bytes.Buffer
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		j := i + 1
+
+		// \E is the escape character when used within a macro argument, so
+		// treat \E* the same as \*.
+		if j < len(s) && s[j] == 'E' {
+			j++
+		}
+
+		if j >= len(s) || s[j] != '*' {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		j++
+
+		if j >= len(s) {
+			break
+		}
+
+		var name string
+
+		switch s[j] {
+		case '[':
+			end := strings.IndexByte(s[j:], ']')
+
+			if end < 0 {
+				end = len(s) - j
+			}
+
+			name = s[j+1 : j+end]
+			i = j + end
+		case '(':
+			name = s[j+1 : min(j+3, len(s))]
+			i = min(j+2, len(s)-1)
+		default:
+			name = s[j : j+1]
+			i = j
+		}
+		buf.WriteString(ms.expand(ms.String(name), depth+1))
+	}
+	return buf.String()
+}
+
+// String returns the value of the string by the given name, as defined via the
+// ds macro. This also returns the values of the $DOCTITLE and $AUTHOR strings
+// as set via their respective macros.
+func (ms *Manuscript) String(name string) string {
+	switch name {
+	case "$DOCTITLE":
+		return ms.DocTitle()
+	case "$AUTHOR":
+		return ms.Author()
+	}
+
+	val := ""
+
+	for _, tok := range ms.Tokens {
+		if m, ok := tok.(*Macro); ok && m.Name == "ds" && m.Arg(0) == name {
+			val = strings.Join(m.Args[1:], " ")
+		}
+	}
+	return val
+}
+
 // DocTitle returns the title from DOCTITLE.
 func (ms *Manuscript) DocTitle() string {
 	return ms.Get("DOCTITLE")
@@ -479,6 +611,24 @@ func (ms *Manuscript) Author() string {
 	return ms.Get("AUTHOR")
 }
 
+// Copyright returns the copyright from COPYRIGHT, with any strings within it
+// expanded.
+func (ms *Manuscript) Copyright() string {
+	m := ms.Macro("COPYRIGHT")
+
+	if m == nil {
+		return ""
+	}
+
+	// The first argument may be the DOC_COVER or COVER keyword, to specify
+	// where the copyright goes, so skip over it.
+	switch m.Arg(0) {
+	case "DOC_COVER", "COVER":
+		return ms.Expand(m.Arg(1))
+	}
+	return ms.Expand(m.Arg(0))
+}
+
 // PrintStyle returns the print style from PRINTSTYLE.
 func (ms *Manuscript) PrintStyle() string {
 	return ms.Get("PRINTSTYLE")
@@ -514,6 +664,19 @@ func (ch *Chapter) Number() string {
 	return number
 }
 
+// Name returns the title of the chapter, falling back to its number, and then
+// to its position within the manuscript.
+func (ch *Chapter) Name() string {
+	if title := ch.Title(); title != "" {
+		return title
+	}
+
+	if number := ch.Number(); number != "" {
+		return number
+	}
+	return "Chapter " + strconv.Itoa(ch.Count)
+}
+
 // Title returns the title of the chapter as specified via CHAPTER_TITLE.
 func (ch *Chapter) Title() string {
 	title := ""
@@ -564,6 +727,8 @@ var (
 // Chapters returns a slice of the chapters within the manuscript, as specified
 // by the given names. The names can either be chapter titles, numbers, or a
 // range of numbers. For example "1:4", would return chapters 1 through to 4.
+// A chapter numbered by something other than digits, such as CHAPTER IV, can
+// also be given by that number.
 func (ms *Manuscript) Chapters(names ...string) ([]*Chapter, error) {
 	set := make(map[string]struct{})
 
@@ -661,6 +826,9 @@ func (ms *Manuscript) Chapters(names ...string) ([]*Chapter, error) {
 				tok = sc.Next()
 			}
 
+			ch.Tokens = make([]Token, end-start)
+			copy(ch.Tokens, ms.Tokens[start:end])
+
 			// Filter out the chapters that have been specified, if any. First we check
 			// for chapter counts, then fallback to checking chapter titles.
 			if len(set) > 0 {
@@ -670,14 +838,19 @@ func (ms *Manuscript) Chapters(names ...string) ([]*Chapter, error) {
 					title := ch.Title()
 
 					if _, ok := set[title]; !ok {
-						continue
+						number := strings.TrimPrefix(ch.Number(), "Chapter ")
+
+						if _, err := strconv.Atoi(number); err == nil {
+							continue
+						}
+
+						if _, ok := set[number]; !ok || number == "" {
+							continue
+						}
 					}
 				}
 			}
 
-			ch.Tokens = make([]Token, end-start)
-			copy(ch.Tokens, ms.Tokens[start:end])
-
 			chapters = append(chapters, &ch)
 
 			if m, ok := tok.(*Macro); ok {
@@ -693,6 +866,97 @@ func (ms *Manuscript) Chapters(names ...string) ([]*Chapter, error) {
 	return chapters, nil
 }
 
+// Paragraph represents a single paragraph of text within a manuscript, that
+// is, everything from a PP macro up until the next PP or COLLATE macro.
+//
+// Pos and End are the positions of the paragraph within [Manuscript.Tokens],
+// with Pos being the position of the PP macro itself. The Text is the plain
+// text of the paragraph with inline escape macros removed, built the same way
+// as the cat command prints it. The Chapter will be nil if the paragraph does
+// not belong to a chapter.
+type Paragraph struct {
+	Chapter *Chapter
+	Pos     int
+	End     int
+	Text    string
+}
+
+// Paragraphs returns all of the paragraphs within the manuscript.
+func (ms *Manuscript) Paragraphs() ([]*Paragraph, error) {
+	chapters, err := ms.Chapters()
+
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[Token]*Chapter)
+
+	for _, ch := range chapters {
+		for _, tok := range ch.Tokens {
+			set[tok] = ch
+		}
+	}
+
+	paras := make([]*Paragraph, 0)
+
+	sc := Scanner{
+		Tokens: ms.Tokens,
+	}
+
+	tok := sc.Next()
+
+	for tok != nil {
+		m, ok := tok.(*Macro)
+
+		if !ok || m.Name != "PP" {
+			tok = sc.Next()
+			continue
+		}
+
+		p := Paragraph{
+			Chapter: set[tok],
+			Pos:     sc.Pos - 1,
+		}
+
+		var buf bytes.Buffer
+
+	loop:
+		for {
+			tok = sc.Next()
+
+			if tok == nil {
+				break
+			}
+
+			switch v := tok.(type) {
+			case *Macro:
+				switch v.Name {
+				case "DROPCAP":
+					buf.WriteString(v.Arg(0))
+				case "PP", "COLLATE":
+					break loop
+				}
+			case *Text:
+				buf.WriteString(v.Value)
+				buf.WriteString(" ")
+			}
+		}
+
+		p.End = sc.Pos
+
+		if tok != nil {
+			p.End--
+		}
+
+		p.Text = PlainText(strings.TrimSuffix(buf.String(), " "))
+
+		if p.Text != "" {
+			paras = append(paras, &p)
+		}
+	}
+	return paras, nil
+}
+
 // WriteTo writes the contents of the entire manuscript to the given writer.
 // This will produce a 1-to-1 of what is on disk from the original groff mom
 // manuscript file.
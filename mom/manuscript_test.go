@@ -1,4 +1,4 @@
-package main
+package mom
 
 import (
 	"bytes"
@@ -11,7 +11,7 @@ import (
 )
 
 func TestManuscript(t *testing.T) {
-	file := filepath.Join("testdata", "dracula.mom")
+	file := filepath.Join("..", "testdata", "dracula.mom")
 
 	ms, err := ParseManuscript(file)
 
@@ -62,7 +62,7 @@ func TestManuscript(t *testing.T) {
 }
 
 func TestChapters(t *testing.T) {
-	file := filepath.Join("testdata", "chapters.mom")
+	file := filepath.Join("..", "testdata", "chapters.mom")
 
 	ms, err := ParseManuscript(file)
 
@@ -410,6 +410,10 @@ func TestTextWords(t *testing.T) {
 			`word...," word`,
 			[]string{`word`, "word"},
 		},
+		{
+			"word…word… word",
+			[]string{"word", "word", "word"},
+		},
 		{
 			`"—word—", word word...word...word "word...," word`,
 			[]string{`word`, "word", "word", "word", "word", `word`, "word"},
@@ -428,3 +432,60 @@ func TestTextWords(t *testing.T) {
 		})
 	}
 }
+
+func TestExpand(t *testing.T) {
+	file := filepath.Join("..", "testdata", "dracula.mom")
+
+	ms, err := ParseManuscript(file)
+
+	if err != nil {
+		t.Fatalf("ParseManuscript(%q): %v\n", file, err)
+	}
+
+	tests := []struct {
+		str  string
+		want string
+	}{
+		{`\*[STYLE]`, "TYPESET"},
+		{`\E*[$AUTHOR]`, "Bram Stoker"},
+		{`\*[$AUTHOR] - \*[$DOCTITLE]`, "Bram Stoker - DRACULA"},
+		{`1897 \*[$AUTHOR]`, "1897 Bram Stoker"},
+		{`\*[UNDEFINED]text`, "text"},
+		{`\*[IT]italic\*[PREV]`, "italic"},
+		{`no strings`, "no strings"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str, func(t *testing.T) {
+			if got := ms.Expand(test.str); got != test.want {
+				t.Errorf("ms.Expand(%q) = %q, want = %q", test.str, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCopyright(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"dracula.mom", "1897 Bram Stoker"},
+		{"chapters.mom", "2026 Andrew Pillar"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			file := filepath.Join("..", "testdata", test.file)
+
+			ms, err := ParseManuscript(file)
+
+			if err != nil {
+				t.Fatalf("ParseManuscript(%q): %v\n", file, err)
+			}
+
+			if got := ms.Copyright(); got != test.want {
+				t.Errorf("ms.Copyright() = %q, want = %q", got, test.want)
+			}
+		})
+	}
+}
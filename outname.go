@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"book/mom"
+)
+
+// OutputName is what the output name of a published manuscript is formatted
+// from, via the placeholders given to the -o flag of pub.
+type OutputName struct {
+	Manuscript *mom.Manuscript
+
+	// Dir is the directory of the manuscript, the git hash is taken from the
+	// repository this is in.
+	Dir string
+
+	// Chapters are the chapters selected for publishing, if any.
+	Chapters []*mom.Chapter
+
+	Words int // Words is the word limit of the sample, if any.
+	Pages int // Pages is the page limit of the sample, if any.
+
+	Date time.Time
+
+	hash string
+}
+
+// ChapterRange returns the counts of the selected chapters, with consecutive
+// chapters collapsed into a range, for example 1-3,5.
+func (o *OutputName) ChapterRange() string {
+	parts := make([]string, 0, len(o.Chapters))
+
+	for i := 0; i < len(o.Chapters); i++ {
+		start := o.Chapters[i].Count
+		end := start
+
+		for i+1 < len(o.Chapters) && o.Chapters[i+1].Count == end+1 {
+			end++
+			i++
+		}
+
+		part := strconv.Itoa(start)
+
+		if end != start {
+			part += "-" + strconv.Itoa(end)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Default returns the output name to use when none is given. This is the name
+// of the manuscript file, suffixed with the selected chapters and the limit of
+// the sample, if any, so samples do not overwrite the full manuscript.
+func (o *OutputName) Default(file string) string {
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+
+	if len(o.Chapters) > 0 {
+		name += "-ch" + o.ChapterRange()
+	}
+
+	if o.Words > 0 {
+		name += "-" + strconv.Itoa(o.Words) + "w"
+	}
+
+	if o.Pages > 0 {
+		name += "-" + strconv.Itoa(o.Pages) + "p"
+	}
+	return name
+}
+
+// GitHash returns the short hash of the current commit of the repository the
+// manuscript is in.
+func (o *OutputName) GitHash() (string, error) {
+	if o.hash != "" {
+		return o.hash, nil
+	}
+
+	cmd := exec.Command("git", "-C", o.Dir, "rev-parse", "--short", "HEAD")
+
+	out, err := cmd.Output()
+
+	if err != nil {
+		return "", fmt.Errorf("git hash: %w", err)
+	}
+
+	o.hash = strings.TrimSpace(string(out))
+	return o.hash, nil
+}
+
+// Format formats the given output name for the given publishing format. The
+// placeholders are,
+//
+//	%T - The title of the manuscript
+//	%t - The title of the manuscript, slugged
+//	%A - The author of the manuscript
+//	%C - The selected chapters, such as 1-3
+//	%W - The word limit of the sample
+//	%D - The date, optionally followed by a strftime format in braces
+//	%G - The short git hash of the manuscript
+//	%F - The format being published
+//	%% - A literal %
+func (o *OutputName) Format(s, format string) (string, error) {
+	var namebuf bytes.Buffer
+
+	outbuf := mom.BufferString(s)
+
+	r := outbuf.Get()
+
+loop:
+	for r != -1 {
+		if r == '%' {
+			switch outbuf.Get() {
+			case -1:
+				break loop
+			case '%':
+				namebuf.WriteRune('%')
+			case 'T':
+				namebuf.WriteString(o.Manuscript.DocTitle())
+			case 't':
+				namebuf.WriteString(Slug(o.Manuscript.DocTitle()))
+			case 'A':
+				namebuf.WriteString(o.Manuscript.Author())
+			case 'C':
+				namebuf.WriteString(o.ChapterRange())
+			case 'W':
+				if o.Words > 0 {
+					namebuf.WriteString(strconv.Itoa(o.Words))
+				}
+			case 'D':
+				layout := "%Y-%m-%d"
+
+				if outbuf.Pos < outbuf.EOF && outbuf.Buf[outbuf.Pos] == '{' {
+					var buf strings.Builder
+
+					outbuf.Get()
+
+					for r = outbuf.Get(); r != -1 && r != '}'; r = outbuf.Get() {
+						buf.WriteRune(r)
+					}
+					layout = buf.String()
+				}
+				namebuf.WriteString(Strftime(o.Date, layout))
+			case 'G':
+				hash, err := o.GitHash()
+
+				if err != nil {
+					return "", err
+				}
+				namebuf.WriteString(hash)
+			case 'F':
+				namebuf.WriteString(format)
+			}
+
+			r = outbuf.Get()
+			continue
+		}
+
+		namebuf.WriteRune(r)
+		r = outbuf.Get()
+	}
+	return namebuf.String(), nil
+}
+
+// Slug returns the given string in lowercase, with every run of characters
+// that are not letters or digits replaced with a single -.
+func Slug(s string) string {
+	var buf strings.Builder
+
+	dash := false
+
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && buf.Len() > 0 {
+				buf.WriteRune('-')
+			}
+			buf.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return buf.String()
+}
+
+// strftimeLayouts maps the strftime conversions to their Go time layouts.
+var strftimeLayouts = map[rune]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'j': "002",
+	'Z': "MST",
+	'z': "-0700",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+}
+
+// Strftime formats the time using the given strftime layout. Conversions that
+// are not supported are kept as is.
+func Strftime(t time.Time, layout string) string {
+	var buf strings.Builder
+
+	conv := false
+
+	for _, r := range layout {
+		if !conv {
+			if r == '%' {
+				conv = true
+				continue
+			}
+			buf.WriteRune(r)
+			continue
+		}
+
+		conv = false
+
+		if r == '%' {
+			buf.WriteRune('%')
+			continue
+		}
+
+		if l, ok := strftimeLayouts[r]; ok {
+			buf.WriteString(t.Format(l))
+			continue
+		}
+		buf.WriteRune('%')
+		buf.WriteRune(r)
+	}
+
+	if conv {
+		buf.WriteRune('%')
+	}
+	return buf.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"book/mom"
+)
+
+func TestOutputName(t *testing.T) {
+	file := filepath.Join("testdata", "chapters.mom")
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		t.Fatalf("ParseManuscript(%q): %v\n", file, err)
+	}
+
+	chapters, err := ms.Chapters("1:2")
+
+	if err != nil {
+		t.Fatalf("ms.Chapters(%q): %v\n", "1:2", err)
+	}
+
+	o := &OutputName{
+		Manuscript: ms,
+		Chapters:   chapters,
+		Words:      5000,
+		Date:       time.Date(2024, time.May, 26, 12, 30, 0, 0, time.UTC),
+		hash:       "abc1234",
+	}
+
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"%T - %A", "CHAPTERS EXAMPLE - Andrew Pillar"},
+		{"%t-ch%C-%Ww", "chapters-example-ch1-2-5000w"},
+		{"%t-%D", "chapters-example-2024-05-26"},
+		{"%t-%D{%d %b %Y}-%F", "chapters-example-26 May 2024-pdf"},
+		{"%t-%G", "chapters-example-abc1234"},
+		{"100%% %t%", "100% chapters-example"},
+	}
+
+	for _, test := range tests {
+		name, err := o.Format(test.out, "pdf")
+
+		if err != nil {
+			t.Fatalf("o.Format(%q): %v\n", test.out, err)
+		}
+
+		if name != test.want {
+			t.Errorf("o.Format(%q) = %q, want = %q", test.out, name, test.want)
+		}
+	}
+
+	if name, want := o.Default(file), filepath.Join("testdata", "chapters-ch1-2-5000w"); name != want {
+		t.Errorf("o.Default(%q) = %q, want = %q", file, name, want)
+	}
+
+	o.Chapters = append(o.Chapters[:1], &mom.Chapter{Count: 3})
+
+	if s := o.ChapterRange(); s != "1,3" {
+		t.Errorf("o.ChapterRange() = %q, want = %q", s, "1,3")
+	}
+}
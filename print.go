@@ -3,24 +3,26 @@ package main
 import (
 	"bytes"
 	"strings"
+
+	"book/mom"
 )
 
 func PrintText(cmd *Command, s string) {
-	sc := Scanner{
-		Tokens: Tokenize(s),
+	sc := mom.Scanner{
+		Tokens: mom.Tokenize(s),
 	}
 
 	tok := sc.Next()
 
 	for tok != nil {
-		if txt, ok := tok.(*Text); ok {
+		if txt, ok := tok.(*mom.Text); ok {
 			cmd.Print(txt.Value)
 		}
 		tok = sc.Next()
 	}
 }
 
-func PrintEpigraph(cmd *Command, sc *Scanner) {
+func PrintEpigraph(cmd *Command, sc *mom.Scanner) {
 loop:
 	for {
 		tok := sc.Next()
@@ -30,20 +32,20 @@ loop:
 		}
 
 		switch v := tok.(type) {
-		case *Macro:
+		case *mom.Macro:
 			if v.Name == "EPIGRAPH" {
 				if v.Arg(0) == "OFF" {
 					break loop
 				}
 			}
-		case *Text:
+		case *mom.Text:
 			PrintText(cmd, v.Value)
 			cmd.Println()
 		}
 	}
 }
 
-func PrintParagraph(cmd *Command, sc *Scanner) {
+func PrintParagraph(cmd *Command, sc *mom.Scanner) {
 	var buf bytes.Buffer
 
 loop:
@@ -55,7 +57,7 @@ loop:
 		}
 
 		switch v := tok.(type) {
-		case *Macro:
+		case *mom.Macro:
 			switch v.Name {
 			case "DROPCAP":
 				buf.WriteString(v.Arg(0))
@@ -66,7 +68,7 @@ loop:
 				sc.Back()
 				break loop
 			}
-		case *Text:
+		case *mom.Text:
 			buf.WriteString(v.Value)
 			buf.WriteString(" ")
 		}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"book/mom"
+)
+
+// Distribution summarizes a set of lengths, such as the lengths of sentences
+// in words.
+type Distribution struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	Max    int     `json:"max"`
+}
+
+// NewDistribution returns the distribution of the given lengths.
+func NewDistribution(ns []int) Distribution {
+	d := Distribution{
+		Count: len(ns),
+	}
+
+	if len(ns) == 0 {
+		return d
+	}
+
+	sorted := make([]int, len(ns))
+	copy(sorted, ns)
+	sort.Ints(sorted)
+
+	sum := 0
+
+	for _, n := range sorted {
+		sum += n
+	}
+
+	d.Mean = float64(sum) / float64(len(sorted))
+	d.Max = sorted[len(sorted)-1]
+
+	if mid := len(sorted) / 2; len(sorted)%2 == 0 {
+		d.Median = float64(sorted[mid-1]+sorted[mid]) / 2
+	} else {
+		d.Median = float64(sorted[mid])
+	}
+	return d
+}
+
+// SentenceLocation is the location of a sentence within a manuscript.
+type SentenceLocation struct {
+	Line    int    `json:"line"`
+	Chapter string `json:"chapter,omitempty"`
+	Words   int    `json:"words"`
+	Text    string `json:"text"`
+}
+
+// notAdverbs are words ending in -ly that are not adverbs.
+var notAdverbs = map[string]struct{}{
+	"ally":     {},
+	"apply":    {},
+	"belly":    {},
+	"bully":    {},
+	"chilly":   {},
+	"costly":   {},
+	"curly":    {},
+	"deadly":   {},
+	"early":    {},
+	"elderly":  {},
+	"family":   {},
+	"folly":    {},
+	"friendly": {},
+	"ghastly":  {},
+	"holy":     {},
+	"hilly":    {},
+	"italy":    {},
+	"jelly":    {},
+	"jolly":    {},
+	"july":     {},
+	"lily":     {},
+	"lonely":   {},
+	"lovely":   {},
+	"lowly":    {},
+	"only":     {},
+	"rally":    {},
+	"reply":    {},
+	"silly":    {},
+	"supply":   {},
+	"ugly":     {},
+	"wily":     {},
+}
+
+// adverb returns whether the given word is most likely an adverb, that is a
+// word ending in -ly.
+func adverb(word string) bool {
+	word = strings.ToLower(word)
+
+	if len(word) < 4 || !strings.HasSuffix(word, "ly") {
+		return false
+	}
+
+	_, ok := notAdverbs[word]
+	return !ok
+}
+
+// ProseStats is the style of the prose of a chapter, or of a whole
+// manuscript. The lengths of sentences and paragraphs are in words, and the
+// dialogue and adverbs are percentages of the words.
+type ProseStats struct {
+	Words          int                 `json:"words"`
+	Sentences      Distribution        `json:"sentences"`
+	Paragraphs     Distribution        `json:"paragraphs"`
+	Longest        []*SentenceLocation `json:"longest"`
+	Dialogue       float64             `json:"dialogue"`
+	Narration      float64             `json:"narration"`
+	TypeTokenRatio float64             `json:"type_token_ratio"`
+	Adverbs        float64             `json:"adverbs"`
+}
+
+// NewProseStats returns the style of the prose of the given paragraphs of the
+// manuscript, along with the given number of its longest sentences.
+func NewProseStats(ms *mom.Manuscript, paras []*mom.Paragraph, longest int) *ProseStats {
+	st := &ProseStats{}
+
+	sentences := make([]int, 0)
+	paragraphs := make([]int, 0, len(paras))
+
+	locs := make([]*SentenceLocation, 0)
+
+	types := make(map[string]struct{})
+
+	dialogue := 0
+	adverbs := 0
+
+	for _, p := range paras {
+		words := (&mom.Text{Value: p.Text}).Words()
+
+		if len(words) == 0 {
+			continue
+		}
+
+		st.Words += len(words)
+		paragraphs = append(paragraphs, len(words))
+
+		for _, word := range words {
+			types[strings.ToLower(word)] = struct{}{}
+
+			if adverb(word) {
+				adverbs++
+			}
+		}
+
+		for _, span := range DialogueSpans(p.Text) {
+			dialogue += len((&mom.Text{Value: p.Text[span[0]:span[1]]}).Words())
+		}
+
+		parts := paragraphParts(ms, p)
+
+		for _, span := range SentenceSpans(p.Text) {
+			sentence := p.Text[span[0]:span[1]]
+
+			n := len((&mom.Text{Value: sentence}).Words())
+
+			if n == 0 {
+				continue
+			}
+
+			sentences = append(sentences, n)
+
+			loc := &SentenceLocation{
+				Words: n,
+				Text:  sentence,
+			}
+
+			if p.Chapter != nil {
+				loc.Chapter = p.Chapter.Name()
+			}
+
+			i := sort.Search(len(parts), func(i int) bool {
+				return parts[i].pos > span[0]
+			}) - 1
+
+			if i >= 0 {
+				loc.Line = parts[i].line
+			}
+			locs = append(locs, loc)
+		}
+	}
+
+	st.Sentences = NewDistribution(sentences)
+	st.Paragraphs = NewDistribution(paragraphs)
+
+	sort.SliceStable(locs, func(i, j int) bool {
+		return locs[i].Words > locs[j].Words
+	})
+
+	st.Longest = locs[:min(longest, len(locs))]
+
+	if st.Words > 0 {
+		st.Dialogue = 100 * float64(dialogue) / float64(st.Words)
+		st.Narration = 100 - st.Dialogue
+		st.TypeTokenRatio = float64(len(types)) / float64(st.Words)
+		st.Adverbs = 100 * float64(adverbs) / float64(st.Words)
+	}
+	return st
+}
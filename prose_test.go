@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewDistribution(t *testing.T) {
+	tests := []struct {
+		ns   []int
+		want Distribution
+	}{
+		{nil, Distribution{}},
+		{[]int{5}, Distribution{Count: 1, Mean: 5, Median: 5, Max: 5}},
+		{[]int{9, 1, 5}, Distribution{Count: 3, Mean: 5, Median: 5, Max: 9}},
+		{[]int{4, 1, 2, 9}, Distribution{Count: 4, Mean: 4, Median: 3, Max: 9}},
+	}
+
+	for _, test := range tests {
+		if diff := cmp.Diff(test.want, NewDistribution(test.ns)); diff != "" {
+			t.Errorf("NewDistribution(%v) mismatch (-want +got):\n%s", test.ns, diff)
+		}
+	}
+}
+
+func TestStatsStyle(t *testing.T) {
+	file := filepath.Join("testdata", "stats", "style.mom")
+
+	tests := []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{
+			[]string{"-style", file},
+			[]string{
+				"                Sentence       Paragraph  Dialogue   TTR  Adverbs",
+				"THE FIRST   9.3 / 7 / 19  14.0 / 14 / 19     14.3%  0.86     7.1%",
+				"THE SECOND   3.0 / 3 / 3     3.0 / 3 / 3      0.0%  1.00     0.0%",
+				"Manuscript  7.8 / 5 / 19   10.3 / 9 / 19     12.9%  0.84     6.5%",
+				"",
+				"Longest sentences:",
+				"    " + file + ":7: 19 words (THE FIRST)",
+				"    " + file + ":5: 7 words (THE FIRST)",
+				"    " + file + ":5: 2 words (THE FIRST)",
+				"    " + file + ":14: 3 words (THE SECOND)",
+				"",
+			},
+			nil,
+		},
+		{[]string{"-style", filepath.Join("testdata", "stats", "missing.mom")}, nil, os.ErrNotExist},
+		{[]string{"-style"}, nil, ErrUsage},
+	}
+
+	for _, test := range tests {
+		buf := CaptureOutput(StatsCmd)
+
+		if err := statsCmd(StatsCmd, test.args); !errors.Is(err, test.err) {
+			t.Fatalf("statsCmd(StatsCmd, %v) = %v, want = %v", test.args, err, test.err)
+		}
+
+		if test.err != nil {
+			continue
+		}
+
+		if diff := cmp.Diff(strings.Join(test.want, "\n"), buf.String()); diff != "" {
+			t.Errorf("statsCmd(StatsCmd, %v) mismatch (-want +got):\n%s", test.args, diff)
+		}
+	}
+
+	buf := CaptureOutput(StatsCmd)
+
+	if err := statsCmd(StatsCmd, []string{"-style", "-json", file}); err != nil {
+		t.Fatalf("statsCmd(StatsCmd, %q): %v\n", file, err)
+	}
+
+	var report struct {
+		Chapters   []*Stats
+		Manuscript *Stats
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("json.Unmarshal: %v\n", err)
+	}
+
+	if report.Manuscript.Readability != nil {
+		t.Errorf("report.Manuscript.Readability = %v, want = nil", report.Manuscript.Readability)
+	}
+
+	if got, want := report.Chapters[0].Style.Longest[0].Text, "The night was cold, and the only light was from the lamp which he held slowly above his head."; got != want {
+		t.Errorf("report.Chapters[0].Style.Longest[0].Text = %q, want = %q", got, want)
+	}
+}
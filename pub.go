@@ -1,34 +1,137 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"book/export"
+	"book/mom"
 )
 
 var PubCmd = &Command{
-	Usage: "pub <-f docx|pdf> <-wc count> <-o file> <-v> <file> [chapter,...]",
-	Short: "publish the manuscript into a pdf or docx file",
-	Long: `Publish the manuscript as the given format, either docx or pdf as specified via
-the -f flag. If pdf, then pdfmom is used under the hood to produce the final
-pdf.
+	Usage: "pub <-f format> <-engine name> <-groff-args args> <-profile name> <-layout file> <-wc count> <-wc-boundary name> <-pages count> <-wc-end marker> <-o file> <-Werror> <-v> <file> [chapter,...]",
+	Short: "publish the manuscript into a pdf, docx, or other file",
+	Long: `Publish the manuscript as the given format, as specified via the -f flag. This
+can be one of,
+
+    docx       - Microsoft Word document
+    pdf        - PDF document, via pdfmom or the native engine
+    ps         - PostScript document, via groff -Tps
+    txt        - Plain text for proofing in a terminal, via groff -Tutf8
+    groff-html - HTML document, via groff -Thtml
+
+Other formats may be available, -f help lists every format that can be given.
+
+Multiple formats can be given as a comma separated list, or all can be given
+for every format. Each format is published at the same time, and any failures
+are reported together once they have all finished, with the warnings of each
+prefixed with the name of the format.
+
+The groff preprocessors needed by the manuscript are detected from the macros
+within it, so tbl is used if the manuscript has a table, eqn if it has an
+equation, pic if it has a picture, and refer if it has references. Additional
+flags can be given to groff via the -groff-args flag, for example,
+
+    -groff-args "-t -dpaper=a5"
+
+The -engine flag controls how the pdf is produced, either groff, or native. The
+native engine typesets the manuscript itself, without the need for groff, using
+the same layout as the docx format. If not given, then the native engine is
+used when pdfmom cannot be found.
+
+Warnings and errors reported by groff are printed against the lines of the
+manuscript they were reported for, along with the chapter. Publishing fails if
+groff reports any errors, or any warnings if the -Werror flag is given.
 
 The -wc flag can be given to only publish the first N words of the manuscript.
 If given alongside a chapter, then the word count limit will be applied from
-that chapter onwards.
+that chapter onwards. The sample ends at the boundary nearest to that count,
+as given via the -wc-boundary flag, either paragraph, scene, chapter, or
+sentence. By default this is paragraph. The -wc-end flag can be given to end
+the sample with a closing marker, for example,
+
+    -wc 5000 -wc-boundary scene -wc-end "[End of sample]"
+
+The -pages flag can be given instead of -wc to only publish the first N pages
+of the manuscript. The pages are estimated from the layout, at 250 words a page
+for the smf profile, otherwise from the number of lines that fit on a page
+given the paper, margins, font size, and spacing. The sample ends at the
+paragraph nearest to the last page. The cover page is not counted.
+
+The actual word count of the sample, along with its estimated page count, is
+printed once published.
+
+The -profile flag controls the layout of the docx file, this can either be
+default, or smf. The smf profile produces the Standard Manuscript Format as
+described by William Shunn. The contact block on the first page is taken from
+the git configuration, via the following keys,
+
+    book.name    - The legal name of the author, defaults to user.name
+    book.address - The address, can be given multiple times, one for each line
+    book.phone   - The phone number
+    book.email   - The email address, defaults to user.email
+
+The page and typography of the docx file, and of the pdf file when produced via
+the native engine, can be controlled via the following flags,
+
+    -paper        The paper size, either a4, a5, letter, or legal
+    -margins      The page margins, either one length or four for top, right,
+                  bottom, and left
+    -font         The font family, either a name or a mom family such as T
+    -font-size    The font size in points
+    -spacing      The line spacing, such as 1, 1.5, or 2
+    -indent       The first line indent of paragraphs
+    -heading-size The font size of chapter headings in points
+    -title-size   The font size of the title on the cover in points
+    -cover        Whether to include the cover page, either on or off
+
+Lengths can be given in in, cm, mm, pt, or P (picas), and are in points if no
+unit is given. Defaults for these are taken from the PAPER, PRINTSTYLE, and
+FAMILY macros of the manuscript.
+
+These can also be set in a layout file for the manuscript. By default this is
+the name of the manuscript suffixed with .layout, though a different file can
+be given via the -layout flag. Each line of the file is the name of the setting
+followed by its value, for example,
+
+    profile   smf
+    font      Courier New
+    spacing   1.5
+
+Flags given on the command line take precedence over the layout file.
 
 The -o flag can be given to control the output name of the file. By default the
 output name of the final file will be the name of the manuscript, suffixed with
-the format, either pdf or docx.
+the selected chapters and the limit of the sample if given, such as
+dracula-ch1-3-5000w, so a sample does not overwrite the full manuscript. The
+extension of the format is always added to the name, so each format gets its
+own file when publishing multiple formats.
 
 The -o flag takes placeholder strings to better control the formatting of the
 filename,
 
     %T - The title of the manuscript
+    %t - The title of the manuscript, slugged, such as the-vampyre
     %A - The author of the manuscript
+    %C - The selected chapters, such as 1-3
+    %W - The word limit given via -wc
+    %D - The date of the manuscript, see below
+    %G - The short git hash of the current commit
+    %F - The format being published
+    %% - A literal %
+
+The date is formatted as %Y-%m-%d by default, though a strftime format can be
+given in braces, for example %D{%d %b %Y}. This is the same date used for the
+timestamps of the published file.
 `,
 
 	Run: pubCmd,
@@ -37,20 +140,62 @@ filename,
 func pubCmd(cmd *Command, args []string) error {
 	var (
 		format  string
+		engine  string
+		gargs   string
+		profile string
+		lfile   string
 		wc      int
+		pages   int
+		bound   string
+		marker  string
 		out     string
 		verbose bool
+		werror  bool
 	)
 
 	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
-	fs.StringVar(&format, "f", "", "the format to publish in, either docx or pdf")
+	fs.StringVar(&format, "f", "", "the format to publish in, or help to list the formats")
+	fs.StringVar(&engine, "engine", "", "the engine to publish pdf with, either groff or native")
+	fs.StringVar(&gargs, "groff-args", "", "additional flags to pass to groff")
+	fs.StringVar(&profile, "profile", "", "the layout profile to use for docx, either default or smf")
+	fs.StringVar(&lfile, "layout", "", "the layout file to use, defaults to the manuscript name with .layout")
+
+	layoutFlags := []string{"paper", "margins", "font", "font-size", "spacing", "indent", "heading-size", "title-size", "cover"}
+	layoutVals := make(map[string]*string)
+
+	for _, name := range layoutFlags {
+		layoutVals[name] = fs.String(name, "", "set the "+name+" of the docx layout")
+	}
+
 	fs.IntVar(&wc, "wc", 0, "the number of words to publish")
+	fs.StringVar(&bound, "wc-boundary", BoundaryParagraph, "the boundary to end the sample at, either paragraph, scene, chapter, or sentence")
+	fs.IntVar(&pages, "pages", 0, "the number of pages to publish")
+	fs.StringVar(&marker, "wc-end", "", "the marker to end the sample with")
 	fs.StringVar(&out, "o", "", "write to file instead of the default")
+	fs.BoolVar(&werror, "Werror", false, "treat groff warnings as errors")
 	fs.BoolVar(&verbose, "v", false, "print the name of the file once published")
 	fs.Parse(args)
 
 	args = fs.Args()
 
+	if format == "help" {
+		width := 0
+
+		for _, e := range export.Exporters() {
+			width = max(width, len(e.Name()))
+		}
+
+		for _, e := range export.Exporters() {
+			line := fmt.Sprintf("%-*s .%s", width, e.Name(), e.Ext())
+
+			if desc := export.Describe(e); desc != "" {
+				line += " - " + desc
+			}
+			cmd.Println(line)
+		}
+		return nil
+	}
+
 	if len(args) == 0 {
 		return ErrUsage
 	}
@@ -59,28 +204,82 @@ func pubCmd(cmd *Command, args []string) error {
 		return ErrUsage
 	}
 
+	if wc > 0 && pages > 0 {
+		return ErrUsage
+	}
+
+	formats, err := ParseFormats(format)
+
+	if err != nil {
+		return err
+	}
+
+	if engine != "" && engine != export.EngineGroff && engine != export.EngineNative {
+		return export.ErrEngine
+	}
+
+	if _, ok := breaksBefore[bound]; !ok {
+		return ErrBoundary
+	}
+
 	file := args[0]
 	args = args[1:]
 
-	ms, err := ParseManuscript(file)
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		return err
+	}
+
+	if lfile == "" {
+		lfile = file[:len(file)-4] + ".layout"
+	} else {
+		if _, err := os.Stat(lfile); err != nil {
+			return err
+		}
+	}
+
+	settings, err := export.ReadLayoutFile(lfile)
+
+	if err != nil {
+		return err
+	}
+
+	if profile != "" {
+		settings = append(settings, export.Setting{Key: "profile", Val: profile})
+	}
+
+	for _, name := range layoutFlags {
+		if val := *layoutVals[name]; val != "" {
+			settings = append(settings, export.Setting{Key: name, Val: val})
+		}
+	}
+
+	layout, err := export.NewLayout(ms, settings)
 
 	if err != nil {
 		return err
 	}
 
+	if layout.Date, err = export.SourceDate(file); err != nil {
+		return err
+	}
+
 	// If chapters have been given, then make sure the manuscript only
 	// contains that chapters we want to publish.
+	var chapters []*mom.Chapter
+
 	if len(args) > 0 {
-		chapters, err := ms.Chapters(args...)
+		chapters, err = ms.Chapters(args...)
 
 		if err != nil {
 			return err
 		}
 
-		toks := make([]Token, 0, len(ms.Tokens))
+		toks := make([]mom.Token, 0, len(ms.Tokens))
 
 		for _, tok := range ms.Tokens {
-			if m, ok := tok.(*Macro); ok {
+			if m, ok := tok.(*mom.Macro); ok {
 				if m.Name == "CHAPTER" || m.Name == "CHAPTER_TITLE" {
 					break
 				}
@@ -94,52 +293,42 @@ func pubCmd(cmd *Command, args []string) error {
 		ms.Tokens = toks
 	}
 
-	name := file[:len(file)-4] + "." + format
-
-	if out != "" {
-		var namebuf bytes.Buffer
-
-		outbuf := BufferString(out)
+	dir := filepath.Dir(file)
 
-		r := outbuf.Get()
+	absdir, err := filepath.Abs(dir)
 
-	loop:
-		for r != -1 {
-			if r == '%' {
-				switch outbuf.Get() {
-				case -1:
-					break loop
-				case 'T':
-					namebuf.WriteString(ms.DocTitle())
-				case 'A':
-					namebuf.WriteString(ms.Author())
-				}
+	if err != nil {
+		return err
+	}
 
-				r = outbuf.Get()
-				continue
-			}
+	outname := &OutputName{
+		Manuscript: ms,
+		Dir:        absdir,
+		Chapters:   chapters,
+		Words:      wc,
+		Pages:      pages,
+		Date:       layout.Date,
+	}
 
-			namebuf.WriteRune(r)
-			r = outbuf.Get()
-		}
-		name = namebuf.String() + "." + format
+	// The default name is made absolute, since the directory is changed to
+	// that of the manuscript before publishing.
+	if out == "" {
+		out = strings.ReplaceAll(outname.Default(filepath.Join(absdir, filepath.Base(file))), "%", "%%")
 	}
 
-	if wc > 0 {
-		sum := 0
-		pos := 0
+	samplewc, samplepages := 0, 0
 
-		for i, tok := range ms.Tokens {
-			if sum >= wc {
-				pos = i
-				break
-			}
+	if wc > 0 {
+		ms.Tokens, samplewc, err = Sample(ms.Tokens, wc, bound)
 
-			if txt, ok := tok.(*Text); ok {
-				sum += len(txt.Words())
-			}
+		if err != nil {
+			return err
 		}
-		ms.Tokens = ms.Tokens[:pos]
+		samplepages = EstimatePages(ms.Tokens, layout)
+	}
+
+	if pages > 0 {
+		ms.Tokens, samplewc, samplepages = SamplePages(ms.Tokens, layout, pages)
 	}
 
 	// In the case of publishing a single chapter we want to remove the
@@ -147,13 +336,15 @@ func pubCmd(cmd *Command, args []string) error {
 	// blank page to the document, which we don't want.
 	last := ms.Tokens[len(ms.Tokens)-1]
 
-	if m, ok := last.(*Macro); ok {
+	if m, ok := last.(*mom.Macro); ok {
 		if m.Name == "COLLATE" {
 			ms.Tokens = ms.Tokens[:len(ms.Tokens)-1]
 		}
 	}
 
-	dir := filepath.Dir(file)
+	if (wc > 0 || pages > 0) && marker != "" {
+		ms.Tokens = EndSample(ms.Tokens, marker)
+	}
 
 	// Change into the directory of the source file being published. This is done
 	// to ensure that relative paths used via PDF_IMAGE, and such other macros,
@@ -162,54 +353,129 @@ func pubCmd(cmd *Command, args []string) error {
 		return err
 	}
 
-	switch format {
-	case "docx":
-		if err := os.Remove(name); err != nil {
-			if !errors.Is(err, os.ErrNotExist) {
-				return err
-			}
-		}
-
-		if err := WriteToDOCX(name, ms); err != nil {
-			return err
-		}
-	case "pdf":
+	opts := export.PubOptions{
+		Layout:    layout,
+		Engine:    engine,
+		GroffArgs: strings.Fields(gargs),
+		Werror:    werror,
+	}
 
-		tmp, err := os.CreateTemp("", name)
+	publish := func(ctx context.Context, e export.Exporter, name string) error {
+		f, err := os.Create(name)
 
 		if err != nil {
 			return err
 		}
 
-		defer os.Remove(tmp.Name())
-		defer tmp.Close()
+		defer f.Close()
 
-		if err := ms.WriteTo(tmp); err != nil {
+		if err := e.Export(ctx, ms, f); err != nil {
+			f.Close()
+			os.Remove(name)
 			return err
 		}
+		return f.Close()
+	}
 
-		f, err := os.Create(name)
+	// Each format is published concurrently from the same manuscript, so
+	// the manuscript must not be modified from here on. The diagnostics of
+	// each are buffered, so they are not interleaved.
+	names := make([]string, len(formats))
+	errs := make([]error, len(formats))
+	stderrs := make([]bytes.Buffer, len(formats))
+
+	var wg sync.WaitGroup
+
+	for i, format := range formats {
+		e, _ := export.LookupExporter(format)
+
+		name, err := outname.Format(out, format)
 
 		if err != nil {
 			return err
 		}
 
-		defer f.Close()
+		names[i] = name + "." + e.Ext()
 
-		c := exec.Command("pdfmom", "-k", tmp.Name())
-		c.Stdin = os.Stdin
-		c.Stdout = f
-		c.Stderr = os.Stderr
+		wg.Add(1)
 
-		if err := c.Run(); err != nil {
-			return err
+		opts := opts
+		opts.Stderr = &stderrs[i]
+
+		ctx := export.WithPubOptions(context.Background(), &opts)
+
+		go func(i int, e export.Exporter) {
+			defer wg.Done()
+
+			if err := publish(ctx, e, names[i]); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", e.Name(), err)
+			}
+		}(i, e)
+	}
+
+	wg.Wait()
+
+	// The diagnostics are prefixed with the format they are for, when more
+	// than one format is published.
+	for i, format := range formats {
+		sc := bufio.NewScanner(&stderrs[i])
+
+		for sc.Scan() {
+			if len(formats) > 1 {
+				fmt.Fprint(os.Stderr, format+": ")
+			}
+			fmt.Fprintln(os.Stderr, sc.Text())
 		}
-	default:
-		return errors.New("unrecognized publish format, must be one of: [docx, pdf]")
+	}
+
+	if wc > 0 || pages > 0 {
+		cmd.Printf("sample: %d words, about %d pages\n", samplewc, samplepages)
 	}
 
 	if verbose {
-		cmd.Println(name)
+		for i, name := range names {
+			if errs[i] == nil {
+				cmd.Println(name)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var ErrFormat = errors.New("unrecognized publish format")
+
+// ParseFormats parses the comma separated list of formats given to the -f
+// flag. The format all is every registered format.
+func ParseFormats(s string) ([]string, error) {
+	formats := make([]string, 0)
+
+	for _, format := range strings.Split(s, ",") {
+		format = strings.TrimSpace(format)
+
+		if format == "" {
+			continue
+		}
+
+		if format == "all" {
+			for _, format := range export.Formats() {
+				if !slices.Contains(formats, format) {
+					formats = append(formats, format)
+				}
+			}
+			continue
+		}
+
+		if _, ok := export.LookupExporter(format); !ok {
+			return nil, fmt.Errorf("%w %q, must be one of: [%s]", ErrFormat, format, strings.Join(export.Formats(), ", "))
+		}
+
+		if !slices.Contains(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+
+	if len(formats) == 0 {
+		return nil, ErrUsage
 	}
-	return nil
+	return formats, nil
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/export"
+	"book/export/groff"
+)
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		str  string
+		want []string
+		err  error
+	}{
+		{"pdf", []string{"pdf"}, nil},
+		{"pdf,docx", []string{"pdf", "docx"}, nil},
+		{"pdf, docx,pdf", []string{"pdf", "docx"}, nil},
+		{"all", export.Formats(), nil},
+		{"docx,all", export.Formats(), nil},
+		{"pdf,epub", nil, ErrFormat},
+		{",", nil, ErrUsage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str, func(t *testing.T) {
+			formats, err := ParseFormats(test.str)
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ParseFormats(%q) = %v, want = %v", test.str, err, test.err)
+			}
+
+			if diff := cmp.Diff(test.want, formats); diff != "" {
+				t.Errorf("ParseFormats(%q) mismatch (-want +got):\n%s", test.str, diff)
+			}
+		})
+	}
+}
+
+func TestPubMultipleFormats(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+
+	b, err := os.ReadFile(filepath.Join("testdata", "chapters.mom"))
+
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v\n", err)
+	}
+
+	dir := t.TempDir()
+
+	t.Chdir(dir)
+
+	// Without pdfmom the native engine is used for the pdf, and the fake
+	// groff fails the txt.
+	script := "#!/bin/sh\nfor f; do :; done\necho \"troff: $f:16: error: cannot open file\" >&2\nexit 1\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "groff"), []byte(script), 0755); err != nil {
+		t.Fatalf("os.WriteFile: %v\n", err)
+	}
+
+	t.Setenv("PATH", dir)
+
+	file := filepath.Join(dir, "chapters.mom")
+
+	if err := os.WriteFile(file, b, 0644); err != nil {
+		t.Fatalf("os.WriteFile(%q): %v\n", file, err)
+	}
+
+	buf := CaptureOutput(PubCmd)
+
+	args := []string{"-f", "pdf,txt", "-v", file}
+
+	err = pubCmd(PubCmd, args)
+
+	if !errors.Is(err, groff.ErrGroff) {
+		t.Fatalf("pubCmd(PubCmd, %v) = %v, want = %v", args, err, groff.ErrGroff)
+	}
+
+	if !strings.HasPrefix(err.Error(), "txt: ") {
+		t.Errorf("pubCmd(PubCmd, %v) = %q, want txt error", args, err)
+	}
+
+	pdf := filepath.Join(dir, "chapters.pdf")
+
+	if _, err := os.Stat(pdf); err != nil {
+		t.Errorf("os.Stat(%q): %v", pdf, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "chapters.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("failed txt was not removed: %v", err)
+	}
+
+	if got := buf.String(); got != pdf+"\n" {
+		t.Errorf("pubCmd(PubCmd, %v) output = %q, want = %q", args, got, pdf+"\n")
+	}
+}
+
+func TestPubFormatHelp(t *testing.T) {
+	buf := CaptureOutput(PubCmd)
+
+	if err := pubCmd(PubCmd, []string{"-f", "help"}); err != nil {
+		t.Fatalf("pubCmd(PubCmd, -f help): %v\n", err)
+	}
+
+	want := strings.Join([]string{
+		"docx       .docx - Microsoft Word document",
+		"groff-html .html - HTML document, via groff -Thtml",
+		"pdf        .pdf - PDF document, via pdfmom or the native engine",
+		"ps         .ps - PostScript document, via groff -Tps",
+		"txt        .txt - Plain text for proofing in a terminal, via groff -Tutf8",
+		"",
+	}, "\n")
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("pubCmd(PubCmd, -f help) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPubRelative(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "chapters.mom"))
+
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v\n", err)
+	}
+
+	tests := []struct {
+		cwd  string
+		file string
+	}{
+		{".", filepath.Join("book", "chapters.mom")},
+		{"book", "chapters.mom"},
+		{"other", filepath.Join("..", "book", "chapters.mom")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, sub := range []string{"book", "other"} {
+				if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+					t.Fatalf("os.Mkdir: %v\n", err)
+				}
+			}
+
+			if err := os.WriteFile(filepath.Join(dir, "book", "chapters.mom"), b, 0644); err != nil {
+				t.Fatalf("os.WriteFile: %v\n", err)
+			}
+
+			t.Chdir(filepath.Join(dir, test.cwd))
+
+			buf := CaptureOutput(PubCmd)
+
+			args := []string{"-f", "pdf", "-engine", "native", "-v", test.file}
+
+			if err := pubCmd(PubCmd, args); err != nil {
+				t.Fatalf("pubCmd(PubCmd, %v): %v\n", args, err)
+			}
+
+			pdf := filepath.Join(dir, "book", "chapters.pdf")
+
+			if _, err := os.Stat(pdf); err != nil {
+				t.Errorf("os.Stat(%q): %v", pdf, err)
+			}
+
+			if got := buf.String(); got != pdf+"\n" {
+				t.Errorf("pubCmd(PubCmd, %v) output = %q, want = %q", args, got, pdf+"\n")
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"book/mom"
+)
+
+// abbreviations are the words that are commonly abbreviated with a full stop,
+// and so do not end a sentence.
+var abbreviations = map[string]struct{}{
+	"mr":     {},
+	"mrs":    {},
+	"ms":     {},
+	"messrs": {},
+	"dr":     {},
+	"st":     {},
+	"jr":     {},
+	"sr":     {},
+	"prof":   {},
+	"rev":    {},
+	"capt":   {},
+	"lt":     {},
+	"sgt":    {},
+	"mt":     {},
+	"vol":    {},
+	"vs":     {},
+	"viz":    {},
+	"cf":     {},
+	"e.g":    {},
+	"i.e":    {},
+}
+
+// titles are the abbreviations of titles that are also words, such as a col
+// in the mountains, and so are only abbreviations when capitalized.
+var titles = map[string]struct{}{
+	"col": {},
+	"gen": {},
+}
+
+// numbered are the abbreviations that are also words, and so are only
+// abbreviations when followed by a number, such as No. 7.
+var numbered = map[string]struct{}{
+	"no": {},
+}
+
+// closers are the runes that may follow the end of a sentence, but are still
+// part of it.
+const closers = `”’"')]`
+
+// abbreviated returns whether the word before a full stop is an abbreviation,
+// or an initial such as the P in P. M., given the rune that follows the space
+// after the full stop.
+func abbreviated(word string, next rune) bool {
+	lower := strings.ToLower(word)
+
+	if _, ok := abbreviations[lower]; ok {
+		return true
+	}
+
+	r, n := utf8.DecodeRuneInString(word)
+
+	if _, ok := titles[lower]; ok {
+		return unicode.IsUpper(r)
+	}
+
+	if _, ok := numbered[lower]; ok {
+		return unicode.IsDigit(next)
+	}
+
+	// A single capital is an initial, except for I.
+	return n == len(word) && unicode.IsUpper(r) && r != 'I'
+}
+
+// Sentences splits the given text of a paragraph into sentences. A sentence
+// ends with a full stop, question mark, exclamation mark, or ellipsis that is
+// followed by a space and then anything other than a lowercase letter. A full
+// stop following an abbreviation such as Mr. or an initial does not end a
+// sentence.
+func Sentences(s string) []string {
+	sentences := make([]string, 0)
+
+	for _, span := range SentenceSpans(s) {
+		sentences = append(sentences, s[span[0]:span[1]])
+	}
+	return sentences
+}
+
+// SentenceSpans returns the byte ranges of the sentences within the given text
+// of a paragraph, as split by [Sentences].
+func SentenceSpans(s string) [][2]int {
+	spans := make([][2]int, 0)
+
+	runes := []rune(s)
+
+	// The byte offset of each rune, and of the end of the text.
+	offsets := make([]int, 0, len(runes)+1)
+
+	for i := range s {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(s))
+
+	add := func(start, end int) {
+		for start < end && unicode.IsSpace(runes[start]) {
+			start++
+		}
+
+		for end > start && unicode.IsSpace(runes[end-1]) {
+			end--
+		}
+
+		if start < end {
+			spans = append(spans, [2]int{offsets[start], offsets[end]})
+		}
+	}
+
+	start := 0
+
+	for i := 0; i < len(runes); i++ {
+		if !strings.ContainsRune(".!?…", runes[i]) {
+			continue
+		}
+
+		stop := runes[i] == '.'
+
+		// The word before the full stop, including any full stops within it,
+		// such as e.g.
+		j := i
+
+		for j > 0 && (unicode.IsLetter(runes[j-1]) || (runes[j-1] == '.' && j-1 > 0 && unicode.IsLetter(runes[j-2]))) {
+			j--
+		}
+
+		word := string(runes[j:i])
+
+		end := i + 1
+
+		for end < len(runes) && (strings.ContainsRune(".!?…", runes[end]) || strings.ContainsRune(closers, runes[end])) {
+			end++
+		}
+
+		if end < len(runes) && !unicode.IsSpace(runes[end]) {
+			i = end - 1
+			continue
+		}
+
+		next := end
+
+		for next < len(runes) && unicode.IsSpace(runes[next]) {
+			next++
+		}
+
+		if next < len(runes) {
+			if unicode.IsLower(runes[next]) {
+				i = end - 1
+				continue
+			}
+
+			if stop && end == i+1 && abbreviated(word, runes[next]) {
+				continue
+			}
+		}
+
+		add(start, end)
+
+		start = end
+		i = end - 1
+	}
+
+	add(start, len(runes))
+
+	return spans
+}
+
+// Syllables returns an estimate of the number of syllables in the given word,
+// by counting the groups of vowels within it, less any that are silent.
+func Syllables(word string) int {
+	word = strings.ToLower(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return r
+		}
+		return -1
+	}, word))
+
+	if word == "" {
+		return 0
+	}
+
+	if utf8.RuneCountInString(word) <= 3 {
+		return 1
+	}
+
+	vowel := func(r rune) bool {
+		return strings.ContainsRune("aeiouyàáâäèéêëìíîïòóôöùúûü", r)
+	}
+
+	runes := []rune(word)
+
+	n := 0
+	prev := false
+
+	for i, r := range runes {
+		// A y at the start of a word is a consonant, as in yes.
+		v := vowel(r) && !(i == 0 && r == 'y')
+
+		if v && !prev {
+			n++
+		}
+		prev = v
+	}
+
+	last := len(runes) - 1
+
+	switch {
+	// A silent e at the end of the word, as in make, but not as in table.
+	case runes[last] == 'e' && !(runes[last-1] == 'l' && !vowel(runes[last-2])) && !vowel(runes[last-1]):
+		n--
+	// A silent e in the endings -es and -ed, as in makes and walked, but not
+	// as in wishes and wanted.
+	case (strings.HasSuffix(word, "es") || strings.HasSuffix(word, "ed")) && !vowel(runes[last-2]):
+		if !strings.ContainsRune("cgsxzhtd", runes[last-2]) {
+			n--
+		}
+	}
+	return max(n, 1)
+}
+
+// Readability is the counts of the sentences, words, and syllables of some
+// text, from which the readability scores are derived.
+type Readability struct {
+	Sentences int
+	Words     int
+	Syllables int
+
+	// Polysyllables is the number of words of three or more syllables.
+	Polysyllables int
+
+	// Complex is the number of polysyllables that are not proper nouns,
+	// hyphenated, or only three syllables because of an -es, -ed, or -ing
+	// ending, as per the Gunning Fog index.
+	Complex int
+}
+
+// Add adds the counts of the given text to the readability.
+func (r *Readability) Add(s string) {
+	for _, sentence := range Sentences(s) {
+		txt := &mom.Text{Value: sentence}
+
+		words := txt.Words()
+
+		if len(words) == 0 {
+			continue
+		}
+
+		r.Sentences++
+
+		for i, word := range strings.Fields(sentence) {
+			word = strings.TrimFunc(word, func(r rune) bool {
+				return !unicode.IsLetter(r)
+			})
+
+			n := 0
+
+			for _, part := range strings.Split(word, "-") {
+				n += Syllables(part)
+			}
+
+			if n < 3 {
+				continue
+			}
+
+			r.Polysyllables++
+
+			if strings.Contains(word, "-") {
+				continue
+			}
+
+			if ch, _ := utf8.DecodeRuneInString(word); i > 0 && unicode.IsUpper(ch) {
+				continue
+			}
+
+			lower := strings.ToLower(word)
+
+			if n == 3 && (strings.HasSuffix(lower, "es") || strings.HasSuffix(lower, "ed") || strings.HasSuffix(lower, "ing")) {
+				continue
+			}
+			r.Complex++
+		}
+
+		for _, word := range words {
+			r.Syllables += Syllables(word)
+		}
+		r.Words += len(words)
+	}
+}
+
+// FleschReadingEase returns the Flesch Reading Ease score, from 0 to 100 with
+// higher scores being easier to read.
+func (r *Readability) FleschReadingEase() float64 {
+	if r.Sentences == 0 || r.Words == 0 {
+		return 0
+	}
+	return 206.835 - 1.015*float64(r.Words)/float64(r.Sentences) - 84.6*float64(r.Syllables)/float64(r.Words)
+}
+
+// FleschKincaidGrade returns the Flesch-Kincaid Grade Level, the US school
+// grade needed to understand the text.
+func (r *Readability) FleschKincaidGrade() float64 {
+	if r.Sentences == 0 || r.Words == 0 {
+		return 0
+	}
+	return 0.39*float64(r.Words)/float64(r.Sentences) + 11.8*float64(r.Syllables)/float64(r.Words) - 15.59
+}
+
+// GunningFog returns the Gunning Fog index, the years of formal education
+// needed to understand the text on a first reading.
+func (r *Readability) GunningFog() float64 {
+	if r.Sentences == 0 || r.Words == 0 {
+		return 0
+	}
+	return 0.4 * (float64(r.Words)/float64(r.Sentences) + 100*float64(r.Complex)/float64(r.Words))
+}
+
+// SMOG returns the SMOG grade, the years of education needed to understand the
+// text. This is normalized to 30 sentences, which the formula was designed for.
+func (r *Readability) SMOG() float64 {
+	if r.Sentences == 0 {
+		return 0
+	}
+	return 1.0430*math.Sqrt(float64(r.Polysyllables)*30/float64(r.Sentences)) + 3.1291
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{
+			"Left Munich at 8:35 P. M., on 1st May. Buda-Pesth seems a wonderful place.",
+			[]string{"Left Munich at 8:35 P. M., on 1st May.", "Buda-Pesth seems a wonderful place."},
+		},
+		{
+			"Mr. Harker met Dr. Seward. “Welcome!” he said. “Enter freely.”",
+			[]string{"Mr. Harker met Dr. Seward.", "“Welcome!” he said.", "“Enter freely.”"},
+		},
+		{
+			"It was late… too late. Was it? I think so, i.e. it was. The end",
+			[]string{"It was late… too late.", "Was it?", "I think so, i.e. it was.", "The end"},
+		},
+		{
+			"It was I. Then it was him.",
+			[]string{"It was I.", "Then it was him."},
+		},
+		{
+			"“No. I will not,” he said. I said no. Then I went.",
+			[]string{"“No.", "I will not,” he said.", "I said no.", "Then I went."},
+		},
+		{
+			"He lodged at No. 7 with Col. Hamilton. We crossed the col. Then we rested.",
+			[]string{"He lodged at No. 7 with Col. Hamilton.", "We crossed the col.", "Then we rested."},
+		},
+		{
+			"It was Harker vs. Dracula. Gen. Grant agreed.",
+			[]string{"It was Harker vs. Dracula.", "Gen. Grant agreed."},
+		},
+	}
+
+	for _, test := range tests {
+		if diff := cmp.Diff(test.want, Sentences(test.s)); diff != "" {
+			t.Errorf("Sentences(%q) mismatch (-want +got):\n%s", test.s, diff)
+		}
+	}
+}
+
+func TestSyllables(t *testing.T) {
+	tests := []struct {
+		word string
+		want int
+	}{
+		{"the", 1},
+		{"make", 1},
+		{"makes", 1},
+		{"walked", 1},
+		{"wanted", 2},
+		{"wishes", 2},
+		{"table", 2},
+		{"yellow", 2},
+		{"wonderful", 3},
+		{"beautiful", 3},
+		{"readability", 5},
+	}
+
+	for _, test := range tests {
+		if got := Syllables(test.word); got != test.want {
+			t.Errorf("Syllables(%q) = %d, want = %d", test.word, got, test.want)
+		}
+	}
+}
+
+func TestStatsReadability(t *testing.T) {
+	file := filepath.Join("testdata", "chapters.mom")
+
+	buf := CaptureOutput(StatsCmd)
+
+	if err := statsCmd(StatsCmd, []string{"-readability", file}); err != nil {
+		t.Fatalf("statsCmd(StatsCmd, %q): %v\n", file, err)
+	}
+
+	want := []string{
+		"            Sentences  Words   Ease  Grade  Fog  SMOG",
+		"THE FIRST           1      2  120.2   -3.0  0.8   3.1",
+		"THE SECOND          1      2   77.9    2.9  0.8   3.1",
+		"THE THIRD           1      2  120.2   -3.0  0.8   3.1",
+		"Manuscript          3      6  106.1   -1.0  0.8   3.1",
+		"",
+	}
+
+	if diff := cmp.Diff(strings.Join(want, "\n"), buf.String()); diff != "" {
+		t.Errorf("statsCmd(StatsCmd, %q) mismatch (-want +got):\n%s", file, diff)
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"book/mom"
+)
+
+var ReviewCmd = &Command{
+	Usage: "review [-w] [-o file] <docx> <file>",
+	Short: "map docx comments and tracked changes back to the manuscript",
+	Long: `Review takes a DOCX file returned by an editor and maps each comment and
+tracked change within it back to the paragraph of the original manuscript it
+was made against. Paragraphs are matched by their text, so the DOCX does not
+need to have been produced by book itself.
+
+A report of the annotations is printed, grouped by chapter. Annotations that
+could not be matched to a paragraph are listed as unplaced.
+
+The -w flag will insert each annotation into the manuscript as a comment line
+directly above the paragraph it was made against.
+
+The -o flag will write the annotations to the given side-car file, one per line
+in the format of file:line: kind: author: text.`,
+	Run: reviewCmd,
+}
+
+// Annotation is a single comment, insertion, or deletion made within a DOCX
+// file.
+type Annotation struct {
+	Kind   string // Kind is either comment, insertion, or deletion.
+	Author string
+	Text   string
+
+	// Anchor is the text the comment was made against, if any.
+	Anchor string
+
+	// Para is the index of the DOCX paragraph the annotation was made in.
+	Para int
+}
+
+func (a *Annotation) String() string {
+	s := a.Kind
+
+	if a.Author != "" {
+		s += " (" + a.Author + ")"
+	}
+
+	s += ": " + a.Text
+
+	if a.Anchor != "" {
+		s += fmt.Sprintf(" [on %q]", a.Anchor)
+	}
+	return s
+}
+
+// Review is the parsed content of a reviewed DOCX file. Paras contains the
+// original text of each paragraph, that is the text as it was before any of
+// the tracked changes were made.
+type Review struct {
+	Paras       []string
+	Annotations []*Annotation
+}
+
+func readZipFile(z *zip.Reader, name string) ([]byte, error) {
+	f, err := z.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// parseComments parses the comments.xml part of a DOCX file into a map of the
+// comment ID to its annotation.
+func parseComments(b []byte) (map[string]*Annotation, error) {
+	comments := make(map[string]*Annotation)
+
+	dec := xml.NewDecoder(strings.NewReader(string(b)))
+
+	var (
+		cur  *Annotation
+		text bool
+	)
+
+	for {
+		tok, err := dec.Token()
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		switch v := tok.(type) {
+		case xml.StartElement:
+			switch v.Name.Local {
+			case "comment":
+				cur = &Annotation{
+					Kind:   "comment",
+					Author: attr(v, "author"),
+				}
+				comments[attr(v, "id")] = cur
+			case "p":
+				if cur != nil && cur.Text != "" {
+					cur.Text += " "
+				}
+			case "t":
+				text = true
+			}
+		case xml.EndElement:
+			switch v.Name.Local {
+			case "comment":
+				cur = nil
+			case "t":
+				text = false
+			}
+		case xml.CharData:
+			if cur != nil && text {
+				cur.Text += string(v)
+			}
+		}
+	}
+	return comments, nil
+}
+
+// ParseReview parses the comments and tracked changes from the given DOCX
+// file.
+func ParseReview(name string) (*Review, error) {
+	z, err := zip.OpenReader(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer z.Close()
+
+	doc, err := readZipFile(&z.Reader, "word/document.xml")
+
+	if err != nil {
+		return nil, err
+	}
+
+	comments := make(map[string]*Annotation)
+
+	if b, err := readZipFile(&z.Reader, "word/comments.xml"); err == nil {
+		if comments, err = parseComments(b); err != nil {
+			return nil, err
+		}
+	}
+
+	rv := Review{}
+
+	var (
+		para     strings.Builder
+		change   *Annotation
+		text     bool
+		anchored = make(map[string]*Annotation)
+		placed   = make(map[string]struct{})
+	)
+
+	dec := xml.NewDecoder(strings.NewReader(string(doc)))
+
+	for {
+		tok, err := dec.Token()
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		switch v := tok.(type) {
+		case xml.StartElement:
+			switch v.Name.Local {
+			case "ins", "del":
+				kind := "insertion"
+
+				if v.Name.Local == "del" {
+					kind = "deletion"
+				}
+
+				change = &Annotation{
+					Kind:   kind,
+					Author: attr(v, "author"),
+					Para:   len(rv.Paras),
+				}
+			case "t", "delText":
+				text = true
+			case "tab", "br":
+				para.WriteString(" ")
+			case "commentRangeStart", "commentReference":
+				id := attr(v, "id")
+
+				if _, ok := placed[id]; ok {
+					break
+				}
+
+				if c, ok := comments[id]; ok {
+					c.Para = len(rv.Paras)
+					rv.Annotations = append(rv.Annotations, c)
+					placed[id] = struct{}{}
+
+					if v.Name.Local == "commentRangeStart" {
+						anchored[id] = c
+					}
+				}
+			case "commentRangeEnd":
+				delete(anchored, attr(v, "id"))
+			}
+		case xml.EndElement:
+			switch v.Name.Local {
+			case "p":
+				rv.Paras = append(rv.Paras, para.String())
+				para.Reset()
+			case "ins", "del":
+				if change != nil && change.Text != "" {
+					rv.Annotations = append(rv.Annotations, change)
+				}
+				change = nil
+			case "t", "delText":
+				text = false
+			}
+		case xml.CharData:
+			if !text {
+				break
+			}
+
+			s := string(v)
+
+			if change != nil {
+				change.Text += s
+
+				if change.Kind == "insertion" {
+					break
+				}
+			}
+
+			para.WriteString(s)
+
+			for _, c := range anchored {
+				c.Anchor += s
+			}
+		}
+	}
+	return &rv, nil
+}
+
+func reviewWords(s string) map[string]int {
+	words := make(map[string]int)
+
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		words[w]++
+	}
+	return words
+}
+
+// similarity returns the Sørensen–Dice coefficient of the words in the two
+// given sets.
+func similarity(a, b map[string]int) float64 {
+	total := 0
+	common := 0
+
+	for w, n := range a {
+		total += n
+		common += min(n, b[w])
+	}
+
+	for _, n := range b {
+		total += n
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return float64(2*common) / float64(total)
+}
+
+// Align returns the paragraph from the given paragraphs that best matches each
+// DOCX paragraph that has an annotation. If no paragraph is a close enough
+// match, then the annotation will not have an entry in the returned map.
+func (rv *Review) Align(paras []*mom.Paragraph) map[*Annotation]*mom.Paragraph {
+	words := make([]map[string]int, 0, len(paras))
+
+	for _, p := range paras {
+		words = append(words, reviewWords(p.Text))
+	}
+
+	matches := make(map[int]*mom.Paragraph)
+	aligned := make(map[*Annotation]*mom.Paragraph)
+
+	for _, a := range rv.Annotations {
+		if a.Para >= len(rv.Paras) {
+			continue
+		}
+
+		p, ok := matches[a.Para]
+
+		if !ok {
+			target := reviewWords(rv.Paras[a.Para])
+			best := 0.5
+
+			for i, w := range words {
+				if score := similarity(target, w); score > best || (p == nil && score == best) {
+					best = score
+					p = paras[i]
+				}
+			}
+			matches[a.Para] = p
+		}
+
+		if p != nil {
+			aligned[a] = p
+		}
+	}
+	return aligned
+}
+
+func reviewCmd(cmd *Command, args []string) error {
+	var (
+		write bool
+		out   string
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.BoolVar(&write, "w", false, "write annotations into the manuscript as comments")
+	fs.StringVar(&out, "o", "", "write annotations to the given side-car file")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) < 2 {
+		return ErrUsage
+	}
+
+	rv, err := ParseReview(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	file := args[1]
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		return err
+	}
+
+	paras, err := ms.Paragraphs()
+
+	if err != nil {
+		return err
+	}
+
+	aligned := rv.Align(paras)
+
+	var (
+		unplaced []*Annotation
+		order    []*mom.Chapter
+		lines    []string
+	)
+
+	groups := make(map[*mom.Chapter][]*Annotation)
+
+	for _, a := range rv.Annotations {
+		p, ok := aligned[a]
+
+		if !ok {
+			unplaced = append(unplaced, a)
+			continue
+		}
+
+		if _, ok := groups[p.Chapter]; !ok {
+			order = append(order, p.Chapter)
+		}
+
+		groups[p.Chapter] = append(groups[p.Chapter], a)
+
+		// Each line of the manuscript is parsed into a single token, so the
+		// position of the paragraph is the line number minus one.
+		lines = append(lines, fmt.Sprintf("%s:%d: %s: %s: %s", file, p.Pos+1, a.Kind, a.Author, a.Text))
+	}
+
+	for i, ch := range order {
+		if i > 0 {
+			cmd.Println()
+		}
+
+		if ch == nil {
+			cmd.Println(ms.DocTitle())
+		} else {
+			cmd.Println(ch.Name())
+		}
+
+		for _, a := range groups[ch] {
+			cmd.Printf("    %s:%d: %s\n", file, aligned[a].Pos+1, a)
+		}
+	}
+
+	if len(unplaced) > 0 {
+		if len(order) > 0 {
+			cmd.Println()
+		}
+
+		cmd.Println("Unplaced")
+
+		for _, a := range unplaced {
+			cmd.Printf("    %s\n", a)
+		}
+	}
+
+	if out != "" {
+		for _, a := range unplaced {
+			lines = append(lines, fmt.Sprintf("%s:0: %s: %s: %s", file, a.Kind, a.Author, a.Text))
+		}
+
+		if err := os.WriteFile(out, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+
+	if !write || len(aligned) == 0 {
+		return nil
+	}
+
+	comments := make(map[int][]mom.Token)
+
+	for _, a := range rv.Annotations {
+		p, ok := aligned[a]
+
+		if !ok {
+			continue
+		}
+
+		val := "\\# review: " + a.String()
+
+		// Skip over annotations that have already been written into the
+		// manuscript from a previous review.
+		written := false
+
+		for i := p.Pos - 1; i >= 0; i-- {
+			c, ok := ms.Tokens[i].(mom.Comment)
+
+			if !ok {
+				break
+			}
+
+			if c.Value == val {
+				written = true
+				break
+			}
+		}
+
+		if written {
+			continue
+		}
+
+		comments[p.Pos] = append(comments[p.Pos], mom.Comment{
+			Text: &mom.Text{Value: val},
+		})
+	}
+
+	toks := make([]mom.Token, 0, len(ms.Tokens)+len(rv.Annotations))
+
+	for i, tok := range ms.Tokens {
+		toks = append(toks, comments[i]...)
+		toks = append(toks, tok)
+	}
+	ms.Tokens = toks
+
+	f, err := os.Create(file)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return ms.WriteTo(f)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"book/mom"
+)
+
+const reviewDocument = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:body>
+<w:p><w:r><w:t>CHAPTERS EXAMPLE</w:t></w:r></w:p>
+<w:p><w:r><w:t>The </w:t></w:r><w:commentRangeStart w:id="0"/><w:r><w:t>first</w:t></w:r><w:commentRangeEnd w:id="0"/><w:r><w:t>.</w:t></w:r></w:p>
+<w:p><w:r><w:t>The </w:t></w:r><w:del w:id="1" w:author="Editor"><w:r><w:delText>second</w:delText></w:r></w:del><w:ins w:id="2" w:author="Editor"><w:r><w:t>2nd</w:t></w:r></w:ins><w:r><w:t>.</w:t></w:r></w:p>
+<w:p><w:commentRangeStart w:id="3"/><w:r><w:t>Something else entirely.</w:t></w:r><w:commentRangeEnd w:id="3"/></w:p>
+</w:body>
+</w:document>`
+
+const reviewComments = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:comments xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:comment w:id="0" w:author="Editor"><w:p><w:r><w:t>Which first?</w:t></w:r></w:p></w:comment>
+<w:comment w:id="3" w:author="Editor"><w:p><w:r><w:t>Where is this?</w:t></w:r></w:p></w:comment>
+</w:comments>`
+
+func writeReviewDOCX(t *testing.T, name string) {
+	f, err := os.Create(name)
+
+	if err != nil {
+		t.Fatalf("os.Create(%q): %v\n", name, err)
+	}
+
+	defer f.Close()
+
+	z := zip.NewWriter(f)
+
+	parts := map[string]string{
+		"word/document.xml": reviewDocument,
+		"word/comments.xml": reviewComments,
+	}
+
+	for name, content := range parts {
+		w, err := z.Create(name)
+
+		if err != nil {
+			t.Fatalf("z.Create(%q): %v\n", name, err)
+		}
+		w.Write([]byte(content))
+	}
+
+	if err := z.Close(); err != nil {
+		t.Fatalf("z.Close(): %v\n", err)
+	}
+}
+
+func TestReview(t *testing.T) {
+	dir := t.TempDir()
+
+	docx := filepath.Join(dir, "review.docx")
+	writeReviewDOCX(t, docx)
+
+	b, err := os.ReadFile(filepath.Join("testdata", "chapters.mom"))
+
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v\n", err)
+	}
+
+	path := filepath.Join(dir, "chapters.mom")
+
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("os.WriteFile(%q): %v\n", path, err)
+	}
+
+	buf := CaptureOutput(ReviewCmd)
+
+	args := []string{"-w", docx, path}
+
+	if err := reviewCmd(ReviewCmd, args); err != nil {
+		t.Fatalf("reviewCmd(ReviewCmd, %v): %v\n", args, err)
+	}
+
+	want := `THE FIRST
+    ` + path + `:22: comment (Editor): Which first? [on "first"]
+
+THE SECOND
+    ` + path + `:29: deletion (Editor): second
+    ` + path + `:29: insertion (Editor): 2nd
+
+Unplaced
+    comment (Editor): Where is this? [on "Something else entirely."]
+`
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("reviewCmd(ReviewCmd, %v) mismatch (-want +got):\n%s", args, diff)
+	}
+
+	ms, err := mom.ParseManuscript(path)
+
+	if err != nil {
+		t.Fatalf("ParseManuscript(%q): %v\n", path, err)
+	}
+
+	paras, err := ms.Paragraphs()
+
+	if err != nil {
+		t.Fatalf("ms.Paragraphs(): %v\n", err)
+	}
+
+	comments := []string{
+		`\# review: comment (Editor): Which first? [on "first"]`,
+		`\# review: deletion (Editor): second`,
+		`\# review: insertion (Editor): 2nd`,
+	}
+
+	got := make([]string, 0)
+
+	for _, p := range paras {
+		i := p.Pos
+
+		for i > 0 {
+			if _, ok := ms.Tokens[i-1].(mom.Comment); !ok {
+				break
+			}
+			i--
+		}
+
+		for _, tok := range ms.Tokens[i:p.Pos] {
+			got = append(got, tok.(mom.Comment).Value)
+		}
+	}
+
+	if diff := cmp.Diff(comments, got); diff != "" {
+		t.Fatalf("manuscript comments mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"book/export"
+	"book/mom"
+)
+
+// The boundaries a word count sample can end at.
+const (
+	BoundaryParagraph = "paragraph"
+	BoundaryScene     = "scene"
+	BoundaryChapter   = "chapter"
+	BoundarySentence  = "sentence"
+)
+
+var ErrBoundary = errors.New("unrecognized boundary, must be one of: [paragraph, scene, chapter, sentence]")
+
+// sampleBreak is a position within the manuscript that a sample can end at.
+// The sample is every token up to pos, followed by the text, if any, which is
+// the start of the line at pos up to the end of a sentence. The words and
+// pages are those of the sample ending at the break, pages being an estimate
+// that is only set for page based samples.
+type sampleBreak struct {
+	pos   int
+	text  string
+	words int
+	pages float64
+}
+
+// sampleLine is a line of text within a paragraph, along with its position in
+// the tokens and the number of words before it.
+type sampleLine struct {
+	pos   int
+	value string
+	words int
+}
+
+// fontOpen returns whether an inline font is left open by the given text,
+// given whether one was open before it.
+func fontOpen(s string, open bool) bool {
+	for _, tok := range mom.Tokenize(s) {
+		if in, ok := tok.(*mom.Inline); ok {
+			switch in.Escape {
+			case "IT", "BD", "BDI":
+				open = true
+			case "PREV", "ROM", "R":
+				open = false
+			}
+		}
+	}
+	return open
+}
+
+// sentenceBreaks returns the breaks at the end of each sentence within the
+// given lines of a paragraph, other than the last, as split by
+// [SentenceSpans]. A sentence ending part way through a line is cut from the
+// source text of that line, and any inline font left open at the cut is
+// closed.
+func sentenceBreaks(lines []sampleLine) []sampleBreak {
+	breaks := make([]sampleBreak, 0)
+
+	plain := make([]string, 0, len(lines))
+
+	// Whether an inline font is open at the start of each line.
+	open := make([]bool, 0, len(lines))
+
+	for i, line := range lines {
+		plain = append(plain, mom.PlainText(line.value))
+
+		if i == 0 {
+			open = append(open, false)
+			continue
+		}
+		open = append(open, fontOpen(lines[i-1].value, open[i-1]))
+	}
+
+	spans := SentenceSpans(strings.Join(plain, " "))
+
+	if len(spans) == 0 {
+		return breaks
+	}
+
+	k := 0
+	start := 0
+
+	for _, span := range spans[:len(spans)-1] {
+		for span[1] > start+len(plain[k]) {
+			start += len(plain[k]) + 1
+			k++
+		}
+
+		line := lines[k]
+
+		text := line.value
+
+		if span[1] < start+len(plain[k]) {
+			col := sourceColumn(line.value, span[1]-start)
+			text = strings.TrimRight(string([]rune(line.value)[:col-1]), " ")
+		}
+
+		words := line.words + len((&mom.Text{Value: text}).Words())
+
+		if fontOpen(text, open[k]) {
+			text += `\*[PREV]`
+		}
+
+		// A sentence ending the line is a break before the next token.
+		if text == line.value {
+			breaks = append(breaks, sampleBreak{pos: line.pos + 1, words: words})
+			continue
+		}
+
+		breaks = append(breaks, sampleBreak{
+			pos:   line.pos,
+			text:  text,
+			words: words,
+		})
+	}
+	return breaks
+}
+
+// breaksBefore are the macros that a sample can end before, for each
+// boundary.
+var breaksBefore = map[string][]string{
+	BoundaryParagraph: {"PP", "LINEBREAK", "COLLATE", "CHAPTER"},
+	BoundaryScene:     {"LINEBREAK", "COLLATE", "CHAPTER"},
+	BoundaryChapter:   {"COLLATE", "CHAPTER"},
+	BoundarySentence:  {"PP", "LINEBREAK", "COLLATE", "CHAPTER"},
+}
+
+// Sample returns the tokens for a sample of roughly wc words, ending at the
+// given boundary nearest to that count, along with the actual number of words
+// in the sample. The sentence boundary ends the sample at the end of the
+// nearest sentence, even if that is part way through a paragraph, sentences
+// being split by [SentenceSpans].
+func Sample(toks []mom.Token, wc int, boundary string) ([]mom.Token, int, error) {
+	macros, ok := breaksBefore[boundary]
+
+	if !ok {
+		return nil, 0, ErrBoundary
+	}
+
+	breaks := make([]sampleBreak, 0)
+	sum := 0
+
+	// The lines of the current paragraph, for the sentence boundary.
+	para := make([]sampleLine, 0)
+
+	flush := func() {
+		breaks = append(breaks, sentenceBreaks(para)...)
+		para = para[:0]
+	}
+
+	for i, tok := range toks {
+		switch v := tok.(type) {
+		case *mom.Macro:
+			flush()
+
+			for _, name := range macros {
+				if v.Name == name {
+					breaks = append(breaks, sampleBreak{pos: i, words: sum})
+					break
+				}
+			}
+		case *mom.Text:
+			n := len(v.Words())
+
+			if boundary == BoundarySentence {
+				para = append(para, sampleLine{pos: i, value: v.Value, words: sum})
+			}
+			sum += n
+		}
+	}
+
+	flush()
+
+	breaks = append(breaks, sampleBreak{pos: len(toks), words: sum})
+
+	best := nearestBreak(breaks, func(br sampleBreak) float64 {
+		return math.Abs(float64(br.words - wc))
+	})
+
+	if best == nil {
+		return toks, sum, nil
+	}
+	return best.cut(toks), best.words, nil
+}
+
+// nearestBreak returns the break nearest to some target, as measured by the
+// given distance, preferring the earliest of any that are as near. Breaks
+// before any words are ignored.
+func nearestBreak(breaks []sampleBreak, dist func(sampleBreak) float64) *sampleBreak {
+	var best *sampleBreak
+
+	for i, br := range breaks {
+		if br.words == 0 {
+			continue
+		}
+
+		if best == nil || dist(br) < dist(*best) {
+			best = &breaks[i]
+		}
+	}
+	return best
+}
+
+// cut returns the tokens of the sample ending at the break. The given tokens
+// are left as is.
+func (br *sampleBreak) cut(toks []mom.Token) []mom.Token {
+	sample := toks[:br.pos:br.pos]
+
+	if br.text != "" {
+		sample = append(sample, &mom.Text{Value: br.text})
+	}
+	return sample
+}
+
+// pageBreaks returns the paragraph breaks of the tokens, along with the
+// estimated number of pages up to each break when published with the given
+// layout. The cover page is not included in the estimate.
+func pageBreaks(toks []mom.Token, l *export.Layout) []sampleBreak {
+	perPage, perLine := l.PageMetrics()
+
+	// Chapter headings take up a few lines, or the top third of the page in
+	// the Standard Manuscript Format.
+	heading := 3.0
+
+	if l.Profile == export.ProfileSMF {
+		heading = math.Floor(perPage / 3)
+	}
+
+	breaks := make([]sampleBreak, 0)
+
+	lines := 0.0
+	para := 0
+	sum := 0
+
+	mark := func(pos int) {
+		if para > 0 {
+			lines += math.Ceil(float64(para) / perLine)
+		}
+		para = 0
+
+		breaks = append(breaks, sampleBreak{
+			pos:   pos,
+			words: sum,
+			pages: lines / perPage,
+		})
+	}
+
+	for i, tok := range toks {
+		switch v := tok.(type) {
+		case *mom.Macro:
+			switch v.Name {
+			case "PP":
+				mark(i)
+			case "LINEBREAK":
+				mark(i)
+				lines++
+			case "COLLATE":
+				mark(i)
+				lines = math.Ceil(lines/perPage) * perPage
+			case "CHAPTER":
+				mark(i)
+				lines += heading
+			}
+		case *mom.Text:
+			n := len(v.Words())
+
+			para += n
+			sum += n
+		}
+	}
+
+	mark(len(toks))
+	return breaks
+}
+
+// SamplePages returns the tokens for a sample of roughly the given number of
+// pages when published with the given layout, ending at the paragraph nearest
+// to that page. The actual word count of the sample is returned along with
+// the estimated number of pages.
+func SamplePages(toks []mom.Token, l *export.Layout, pages int) ([]mom.Token, int, int) {
+	breaks := pageBreaks(toks, l)
+
+	best := nearestBreak(breaks, func(br sampleBreak) float64 {
+		return math.Abs(br.pages - float64(pages))
+	})
+
+	if best == nil {
+		best = &breaks[len(breaks)-1]
+	}
+	return best.cut(toks), best.words, pageCount(best.pages)
+}
+
+// EstimatePages returns the estimated number of pages of the tokens when
+// published with the given layout, not including the cover page.
+func EstimatePages(toks []mom.Token, l *export.Layout) int {
+	breaks := pageBreaks(toks, l)
+	return pageCount(breaks[len(breaks)-1].pages)
+}
+
+// pageCount rounds the estimated pages up to whole pages, allowing for some
+// error in the estimate from floating point.
+func pageCount(pages float64) int {
+	return int(math.Ceil(pages - 1e-9))
+}
+
+// EndSample appends the given marker to the end of the sample as its own
+// paragraph.
+func EndSample(toks []mom.Token, marker string) []mom.Token {
+	return append(toks,
+		&mom.Macro{Raw: []rune(".PP"), Name: "PP"},
+		&mom.Text{Value: marker},
+	)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"book/export"
+	"book/mom"
+)
+
+func TestSample(t *testing.T) {
+	lines := []string{
+		".PP",
+		"One two three. Four five.",
+		"Six seven.",
+		".PP",
+		"Eight nine ten.",
+		".LINEBREAK",
+		".PP",
+		"Eleven twelve.",
+		".COLLATE",
+		".CHAPTER 2",
+		".PP",
+		"Thirteen.",
+	}
+
+	toks := make([]mom.Token, 0, len(lines))
+
+	for _, line := range lines {
+		if strings.HasPrefix(line, ".") {
+			fields := strings.Fields(line[1:])
+
+			toks = append(toks, &mom.Macro{Raw: []rune(line), Name: fields[0], Args: fields[1:]})
+			continue
+		}
+		toks = append(toks, &mom.Text{Value: line})
+	}
+
+	tests := []struct {
+		wc       int
+		boundary string
+		words    int
+		last     string
+	}{
+		{4, BoundaryParagraph, 7, "Six seven."},
+		{9, BoundaryParagraph, 10, "Eight nine ten."},
+		{4, BoundarySentence, 3, "One two three."},
+		{6, BoundarySentence, 5, "One two three. Four five."},
+		{4, BoundaryScene, 10, "Eight nine ten."},
+		{4, BoundaryChapter, 12, "Eleven twelve."},
+		{100, BoundaryParagraph, 13, "Thirteen."},
+	}
+
+	for _, test := range tests {
+		sample, words, err := Sample(toks, test.wc, test.boundary)
+
+		if err != nil {
+			t.Fatalf("Sample(%d, %q): %v\n", test.wc, test.boundary, err)
+		}
+
+		if words != test.words {
+			t.Errorf("Sample(%d, %q) words = %d, want = %d", test.wc, test.boundary, words, test.words)
+		}
+
+		txt, ok := sample[len(sample)-1].(*mom.Text)
+
+		if !ok {
+			t.Errorf("Sample(%d, %q) ends with %T, want text", test.wc, test.boundary, sample[len(sample)-1])
+			continue
+		}
+
+		if txt.Value != test.last {
+			t.Errorf("Sample(%d, %q) ends with %q, want = %q", test.wc, test.boundary, txt.Value, test.last)
+		}
+	}
+
+	// The original tokens should be left as is.
+	if txt := toks[1].(*mom.Text); txt.Value != lines[1] {
+		t.Errorf("Sample modified the tokens, toks[1] = %q", txt.Value)
+	}
+
+	if _, _, err := Sample(toks, 4, "page"); !errors.Is(err, ErrBoundary) {
+		t.Errorf("Sample(4, %q) = %v, want = %v", "page", err, ErrBoundary)
+	}
+
+	// Abbreviations and initials do not end a sentence, even at the end of a
+	// line.
+	toks = []mom.Token{
+		&mom.Macro{Raw: []rune(".PP"), Name: "PP"},
+		&mom.Text{Value: "Mr. Harker met Dr."},
+		&mom.Text{Value: "Van Helsing at 10 P. M. and they talked. It was late."},
+	}
+
+	sample, words, err := Sample(toks, 4, BoundarySentence)
+
+	if err != nil {
+		t.Fatalf("Sample(4, %q): %v\n", BoundarySentence, err)
+	}
+
+	if words != 12 {
+		t.Errorf("Sample(4, %q) words = %d, want = %d", BoundarySentence, words, 12)
+	}
+
+	if txt := sample[len(sample)-1].(*mom.Text); txt.Value != "Van Helsing at 10 P. M. and they talked." {
+		t.Errorf("Sample(4, %q) ends with %q, want = %q", BoundarySentence, txt.Value, "Van Helsing at 10 P. M. and they talked.")
+	}
+
+	// An inline font open at the end of the sample is closed.
+	toks = []mom.Token{
+		&mom.Macro{Raw: []rune(".PP"), Name: "PP"},
+		&mom.Text{Value: `He wrote \*[IT]Stop.`},
+		&mom.Text{Value: `Go back.\*[PREV] Then he left.`},
+	}
+
+	tests = []struct {
+		wc       int
+		boundary string
+		words    int
+		last     string
+	}{
+		{3, BoundarySentence, 3, `He wrote \*[IT]Stop.\*[PREV]`},
+		{5, BoundarySentence, 5, `Go back.\*[PREV]`},
+	}
+
+	for _, test := range tests {
+		sample, words, _ := Sample(toks, test.wc, test.boundary)
+
+		if words != test.words {
+			t.Errorf("Sample(%d, %q) words = %d, want = %d", test.wc, test.boundary, words, test.words)
+		}
+
+		if txt := sample[len(sample)-1].(*mom.Text); txt.Value != test.last {
+			t.Errorf("Sample(%d, %q) ends with %q, want = %q", test.wc, test.boundary, txt.Value, test.last)
+		}
+	}
+}
+
+func TestSamplePages(t *testing.T) {
+	toks := []mom.Token{
+		&mom.Macro{Raw: []rune(".CHAPTER 1"), Name: "CHAPTER", Args: []string{"1"}},
+	}
+
+	para := strings.TrimSpace(strings.Repeat("word ", 20))
+
+	for range 100 {
+		toks = append(toks, &mom.Macro{Raw: []rune(".PP"), Name: "PP"}, &mom.Text{Value: para})
+	}
+
+	l := &export.Layout{Profile: export.ProfileSMF}
+
+	// Each paragraph takes two lines of the 23 lines on a page, after the
+	// chapter heading takes the top third of the first page.
+	tests := []struct {
+		pages int
+		words int
+		want  int
+	}{
+		{1, 160, 1},
+		{2, 380, 2},
+		{100, 2000, 9},
+	}
+
+	for _, test := range tests {
+		_, words, pages := SamplePages(toks, l, test.pages)
+
+		if words != test.words {
+			t.Errorf("SamplePages(%d) words = %d, want = %d", test.pages, words, test.words)
+		}
+
+		if pages != test.want {
+			t.Errorf("SamplePages(%d) pages = %d, want = %d", test.pages, pages, test.want)
+		}
+	}
+
+	if pages := EstimatePages(toks, l); pages != 9 {
+		t.Errorf("EstimatePages = %d, want = %d", pages, 9)
+	}
+}
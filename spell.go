@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"book/mom"
+)
+
+var SpellCmd = &Command{
+	Usage: "spell <-d dict> <-w words> <-i> <file...>",
+	Short: "check the spelling of manuscripts",
+	Long: `Check the spelling of the prose in the given manuscripts against a Hunspell
+dictionary. Only the text of the manuscript is checked, never the macros,
+comments, or inline escapes. Each misspelling is printed as,
+
+    file:line: word (chapter): suggestion, ...
+
+The -d flag specifies the dictionary to use, by default this is the value of
+the DICTIONARY environment variable, or en_US if unset. This is either a path
+to the dictionary without the .aff or .dic extension, or the name of a
+dictionary to find in the directories of the DICPATH environment variable, and
+the usual system directories for Hunspell dictionaries. No spell checker needs
+to be installed, only its dictionaries. Prefixes, suffixes, and continuation
+classes to one level are supported, so at most two affixes are stripped from
+a word. Compounding is not supported, so compound words are reported as
+misspelled.
+
+The -w flag specifies the project word list of invented names and the like that
+are not in the dictionary, one word per line. By default this is the book.words
+file next to each manuscript. A word in lowercase will also match when
+capitalized or in uppercase.
+
+The -i flag checks the spelling interactively, prompting for what to do with
+each misspelling,
+
+    a - add the word to the project word list
+    i - ignore the word for the rest of the check
+    s - skip the word, the default
+    q - quit
+`,
+	Run: spellCmd,
+}
+
+var ErrSpell = errors.New("misspellings found")
+
+// spellInput is where the answers to the prompts of interactive spell checking
+// are read from.
+var spellInput io.Reader = os.Stdin
+
+// Misspelling is a word not found in the dictionary, or the project word list.
+type Misspelling struct {
+	File        string
+	Line        int
+	Chapter     string
+	Word        string
+	Suggestions []string
+}
+
+func (m *Misspelling) String() string {
+	s := fmt.Sprintf("%s:%d: %s", m.File, m.Line, m.Word)
+
+	if m.Chapter != "" {
+		s += " (" + m.Chapter + ")"
+	}
+
+	if len(m.Suggestions) > 0 {
+		s += ": " + strings.Join(m.Suggestions, ", ")
+	}
+	return s
+}
+
+// splitWords splits the plain text of the given line into words, a word being
+// a run of letters and digits. Any other rune is passed to the join function,
+// along with the runes of the text and the word so far, which returns whether
+// it is kept as part of the word, such as the apostrophe of don't.
+func splitWords(s string, join func(runes []rune, i int, word []rune) bool) []string {
+	runes := []rune(mom.PlainText(s))
+
+	words := make([]string, 0)
+	tmp := make([]rune, 0)
+
+	for i, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || join(runes, i, tmp) {
+			tmp = append(tmp, r)
+			continue
+		}
+
+		if len(tmp) > 0 {
+			words = append(words, string(tmp))
+		}
+		tmp = tmp[0:0]
+	}
+
+	if len(tmp) > 0 {
+		words = append(words, string(tmp))
+	}
+	return words
+}
+
+// between returns whether the rune at the given position is between two
+// letters.
+func between(runes []rune, i int) bool {
+	return i > 0 && i+1 < len(runes) && unicode.IsLetter(runes[i-1]) && unicode.IsLetter(runes[i+1])
+}
+
+// SpellWords returns the words of the given line of text to check. Unlike
+// [mom.Text.Words], apostrophes within a word are kept, and hyphenated words
+// are split into each part. Words containing digits are not returned.
+func SpellWords(s string) []string {
+	words := make([]string, 0)
+
+	for _, word := range splitWords(s, func(runes []rune, i int, _ []rune) bool {
+		return (runes[i] == '\'' || runes[i] == apostrophe) && between(runes, i)
+	}) {
+		if strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+// LoadWords adds the words in the given word list to the dictionary. Blank
+// lines, and lines starting with # are ignored. A missing word list is not an
+// error.
+func LoadWords(d *Dictionary, file string) error {
+	f, err := os.Open(file)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+
+	for sc.Scan() {
+		word := strings.TrimSpace(sc.Text())
+
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		d.Add(strings.ReplaceAll(word, string(apostrophe), "'"))
+	}
+	return sc.Err()
+}
+
+// AddWord appends the given word to the word list, creating it if it does not
+// exist. A word in uppercase is added capitalized, since it will still match
+// when in uppercase.
+func AddWord(file, word string) error {
+	if utf8.RuneCountInString(word) > 1 && word == strings.ToUpper(word) {
+		word = capitalize(word)
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(f, word); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// spellCheck returns whether the word is spelled correctly in any of the given
+// dictionaries. Dictionaries use straight apostrophes, and names in the
+// project word list will not have their possessive form, so both are tried.
+func spellCheck(word string, dicts ...*Dictionary) bool {
+	word = strings.ReplaceAll(word, string(apostrophe), "'")
+
+	stem, possessive := strings.CutSuffix(word, "'s")
+
+	for _, d := range dicts {
+		if d.Check(word) || (possessive && d.Check(stem)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Spell checks the spelling of the manuscript against the given dictionary,
+// along with the project word list layered on top of it, and returns each
+// misspelling found in order. Suggestions are only taken from the dictionary.
+func Spell(ms *mom.Manuscript, d, words *Dictionary) ([]*Misspelling, error) {
+	chapters, err := ms.Chapters()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokch := make(map[mom.Token]*mom.Chapter)
+
+	for _, ch := range chapters {
+		for _, tok := range ch.Tokens {
+			tokch[tok] = ch
+		}
+	}
+
+	// Suggestions are cached, since a misspelling such as a name is likely to
+	// be repeated.
+	suggestions := make(map[string][]string)
+
+	misspellings := make([]*Misspelling, 0)
+
+	for _, txt := range typoLines(ms) {
+		for _, word := range SpellWords(txt.Value) {
+			if spellCheck(word, d, words) {
+				continue
+			}
+
+			sugg, ok := suggestions[word]
+
+			if !ok {
+				sugg = d.Suggest(word, 5)
+				suggestions[word] = sugg
+			}
+
+			m := &Misspelling{
+				Line:        ms.Line(txt),
+				Word:        word,
+				Suggestions: sugg,
+			}
+
+			if ch, ok := tokch[txt]; ok {
+				m.Chapter = ch.Name()
+			}
+			misspellings = append(misspellings, m)
+		}
+	}
+	return misspellings, nil
+}
+
+func spellCmd(cmd *Command, args []string) error {
+	var (
+		dict        string
+		words       string
+		interactive bool
+	)
+
+	dict = os.Getenv("DICTIONARY")
+
+	if dict == "" {
+		dict = "en_US"
+	}
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.StringVar(&dict, "d", dict, "the dictionary to check against")
+	fs.StringVar(&words, "w", "", "the project word list")
+	fs.BoolVar(&interactive, "i", false, "check the spelling interactively")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	path, err := FindDictionary(dict)
+
+	if err != nil {
+		return err
+	}
+
+	d, err := LoadDictionary(path)
+
+	if err != nil {
+		return err
+	}
+
+	in := bufio.NewReader(spellInput)
+
+	n := 0
+
+	for _, file := range args {
+		list := words
+
+		if list == "" {
+			list = filepath.Join(filepath.Dir(file), "book.words")
+		}
+
+		// The project word list of each manuscript, along with the words
+		// added or ignored whilst checking it.
+		project := NewDictionary()
+
+		if err := LoadWords(project, list); err != nil {
+			return err
+		}
+
+		ms, err := mom.ParseManuscript(file)
+
+		if err != nil {
+			return err
+		}
+
+		misspellings, err := Spell(ms, d, project)
+
+		if err != nil {
+			return err
+		}
+
+		for _, m := range misspellings {
+			m.File = file
+
+			if !interactive {
+				cmd.Println(m)
+				n++
+				continue
+			}
+
+			// Words added or ignored during this check are no longer
+			// misspelled.
+			if spellCheck(m.Word, d, project) {
+				continue
+			}
+
+			cmd.Println(m)
+			cmd.Print("[a]dd, [i]gnore, [s]kip, [q]uit? ")
+
+			answer, err := in.ReadString('\n')
+
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+
+			switch strings.TrimSpace(answer) {
+			case "a":
+				if err := AddWord(list, m.Word); err != nil {
+					return err
+				}
+				project.Add(strings.ReplaceAll(m.Word, string(apostrophe), "'"))
+			case "i":
+				project.Add(strings.ReplaceAll(m.Word, string(apostrophe), "'"))
+			case "q":
+				return nil
+			default:
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+			}
+		}
+	}
+
+	if n > 0 {
+		return fmt.Errorf("%w: %d word(s)", ErrSpell, n)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDictionary(t *testing.T) {
+	d, err := LoadDictionary(filepath.Join("testdata", "en_TEST"))
+
+	if err != nil {
+		t.Fatalf("LoadDictionary: %v\n", err)
+	}
+
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{"night", true},
+		{"Night", true},
+		{"NIGHT", true},
+		{"nIght", false},
+		{"locks", true},
+		{"unlocked", true},
+		{"unlock", true},
+		{"undoor", false},
+		{"carries", true},
+		{"carrys", false},
+		{"carried", false},
+		{"doors", true},
+		{"don't", true},
+		{"Harker", false},
+	}
+
+	for _, test := range tests {
+		if got := d.Check(test.word); got != test.want {
+			t.Errorf("d.Check(%q) = %v, want = %v", test.word, got, test.want)
+		}
+	}
+
+	suggestions := []struct {
+		word string
+		want []string
+	}{
+		{"fone", []string{"phone"}},
+		{"nigth", []string{"night"}},
+		{"Dorr", []string{"Door"}},
+		{"thenight", []string{"the night"}},
+	}
+
+	for _, test := range suggestions {
+		if diff := cmp.Diff(test.want, d.Suggest(test.word, 5)); diff != "" {
+			t.Errorf("d.Suggest(%q) mismatch (-want +got):\n%s", test.word, diff)
+		}
+	}
+}
+
+func TestDictionaryContinuation(t *testing.T) {
+	d, err := LoadDictionary(filepath.Join("testdata", "spell", "en_CONT"))
+
+	if err != nil {
+		t.Fatalf("LoadDictionary: %v\n", err)
+	}
+
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{"drink", true},
+		{"drinkable", true},
+		{"drinkables", true},
+		{"drinks", false},
+		{"drinkabless", false},
+		{"lock", true},
+		{"unlock", true},
+		{"unlockable", true},
+		{"lockable", false},
+		{"nation", true},
+		{"national", false},
+		{"nationals", true},
+	}
+
+	for _, test := range tests {
+		if got := d.Check(test.word); got != test.want {
+			t.Errorf("d.Check(%q) = %v, want = %v", test.word, got, test.want)
+		}
+	}
+}
+
+func TestSpellCmd(t *testing.T) {
+	dir := filepath.Join("testdata", "spell")
+	file := filepath.Join(dir, "night.mom")
+	dict := filepath.Join("testdata", "en_TEST")
+
+	tests := []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{
+			[]string{"-d", dict, file},
+			[]string{
+				file + ":6: nigth (The Nigth): night",
+				file + ":9: unlokced (The Nigth): unlocked",
+				file + ":9: Mina (The Nigth)",
+				"",
+			},
+			ErrSpell,
+		},
+		{
+			[]string{"-d", dict, "-w", filepath.Join(dir, "names.words"), file},
+			[]string{
+				file + ":6: nigth (The Nigth): night",
+				file + ":9: unlokced (The Nigth): unlocked",
+				"",
+			},
+			ErrSpell,
+		},
+		{[]string{"-d", "en_MISSING", file}, nil, ErrDictionary},
+		{[]string{"-d", dict}, nil, ErrUsage},
+	}
+
+	for _, test := range tests {
+		buf := CaptureOutput(SpellCmd)
+
+		if err := spellCmd(SpellCmd, test.args); !errors.Is(err, test.err) {
+			t.Fatalf("spellCmd(SpellCmd, %v) = %v, want = %v", test.args, err, test.err)
+		}
+
+		if test.want == nil {
+			continue
+		}
+
+		if diff := cmp.Diff(strings.Join(test.want, "\n"), buf.String()); diff != "" {
+			t.Errorf("spellCmd(SpellCmd, %v) mismatch (-want +got):\n%s", test.args, diff)
+		}
+	}
+}
+
+func TestSpellInteractive(t *testing.T) {
+	// Words are added to the word list in place, so check a copy of the
+	// fixtures.
+	dir := t.TempDir()
+
+	for _, name := range []string{"night.mom", "upper.mom", "book.words"} {
+		b, err := os.ReadFile(filepath.Join("testdata", "spell", name))
+
+		if err != nil {
+			t.Fatalf("os.ReadFile: %v\n", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatalf("os.WriteFile: %v\n", err)
+		}
+	}
+
+	defer func() { spellInput = os.Stdin }()
+
+	tests := []struct {
+		file  string
+		input string
+		want  string
+	}{
+		{"night.mom", "s\na\ni\n", "# Names\nHarker\nunlokced\n"},
+
+		// A word in uppercase is added capitalized.
+		{"upper.mom", "a\nq\n", "# Names\nHarker\nunlokced\nJonathan\n"},
+	}
+
+	for _, test := range tests {
+		CaptureOutput(SpellCmd)
+
+		spellInput = strings.NewReader(test.input)
+
+		args := []string{"-d", filepath.Join("testdata", "en_TEST"), "-i", filepath.Join(dir, test.file)}
+
+		if err := spellCmd(SpellCmd, args); err != nil {
+			t.Fatalf("spellCmd(SpellCmd, %v): %v\n", args, err)
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, "book.words"))
+
+		if err != nil {
+			t.Fatalf("os.ReadFile: %v\n", err)
+		}
+
+		if got := string(b); got != test.want {
+			t.Errorf("word list = %q, want = %q", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"book/mom"
+)
+
+var StatsCmd = &Command{
+	Usage: "stats <-readability> <-style> <-json> <file>",
+	Short: "show statistics about the prose of a manuscript",
+	Long: `Show statistics about the prose of the given manuscript, per chapter and for
+the whole manuscript. The statistics shown are chosen via the flags, by default
+all are shown.
+
+The -readability flag shows the readability scores of the prose, these being,
+
+    Ease  - the Flesch Reading Ease, from 0 to 100, higher being easier to read
+    Grade - the Flesch-Kincaid Grade Level, the US school grade of the text
+    Fog   - the Gunning Fog index, the years of education needed to read it
+    SMOG  - the SMOG grade, the years of education needed to read it
+
+The scores are derived from the number of words, sentences, and syllables in the
+text of each paragraph. Syllables are estimated, so the scores are close to,
+but may not exactly match those of other tools.
+
+The -style flag shows the style of the prose, these being,
+
+    Sentence  - the mean, median, and longest length of sentences in words
+    Paragraph - the mean, median, and longest length of paragraphs in words
+    Dialogue  - the percentage of words in dialogue, the rest being narration
+    TTR       - the type-token ratio, the number of distinct words over all words
+    Adverbs   - the percentage of words that are adverbs ending in -ly
+
+followed by the location of the three longest sentences of each chapter.
+Dialogue is any text within double quotes, or single quotes that open a
+quotation.
+
+The -json flag prints the statistics as JSON instead of as a table.
+`,
+	Run: statsCmd,
+}
+
+// statsRow is a single row of a table of statistics.
+type statsRow struct {
+	label string
+	cols  []string
+}
+
+// printStats prints the given rows as a table, with the label of each row
+// left aligned, and the columns right aligned.
+func printStats(cmd *Command, header []string, rows []statsRow) {
+	labels := 0
+	widths := make([]int, len(header))
+
+	for i, h := range header {
+		widths[i] = len(h)
+	}
+
+	for _, row := range rows {
+		labels = max(labels, len([]rune(row.label)))
+
+		for i, col := range row.cols {
+			widths[i] = max(widths[i], len([]rune(col)))
+		}
+	}
+
+	cmd.Print(strings.Repeat(" ", labels))
+
+	for i, h := range header {
+		cmd.Printf("  %*s", widths[i], h)
+	}
+	cmd.Println()
+
+	for _, row := range rows {
+		cmd.Printf("%-*s", labels, row.label)
+
+		for i, col := range row.cols {
+			cmd.Printf("  %*s", widths[i], col)
+		}
+		cmd.Println()
+	}
+}
+
+// chapterParagraphs is the paragraphs of a single chapter of a manuscript.
+type chapterParagraphs struct {
+	chapter *mom.Chapter
+	paras   []*mom.Paragraph
+}
+
+// paragraphsByChapter returns the paragraphs of each chapter of the
+// manuscript, along with all of the paragraphs of the manuscript.
+func paragraphsByChapter(ms *mom.Manuscript) ([]*chapterParagraphs, []*mom.Paragraph, error) {
+	chapters, err := ms.Chapters()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paras, err := ms.Paragraphs()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cps := make([]*chapterParagraphs, 0, len(chapters))
+
+	// The chapters of each paragraph are not the same as those returned
+	// above, so are matched by their count.
+	counts := make(map[int]*chapterParagraphs)
+
+	for _, ch := range chapters {
+		cp := &chapterParagraphs{chapter: ch}
+
+		cps = append(cps, cp)
+		counts[ch.Count] = cp
+	}
+
+	for _, p := range paras {
+		if p.Chapter == nil {
+			continue
+		}
+
+		if cp, ok := counts[p.Chapter.Count]; ok {
+			cp.paras = append(cp.paras, p)
+		}
+	}
+	return cps, paras, nil
+}
+
+func formatScore(f float64) string {
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
+
+// ReadabilityStats is the readability of a chapter, or of a whole manuscript.
+type ReadabilityStats struct {
+	Sentences int     `json:"sentences"`
+	Words     int     `json:"words"`
+	Syllables int     `json:"syllables"`
+	Ease      float64 `json:"ease"`
+	Grade     float64 `json:"grade"`
+	Fog       float64 `json:"fog"`
+	SMOG      float64 `json:"smog"`
+}
+
+// NewReadabilityStats returns the readability of the given paragraphs.
+func NewReadabilityStats(paras []*mom.Paragraph) *ReadabilityStats {
+	r := &Readability{}
+
+	for _, p := range paras {
+		r.Add(p.Text)
+	}
+
+	return &ReadabilityStats{
+		Sentences: r.Sentences,
+		Words:     r.Words,
+		Syllables: r.Syllables,
+		Ease:      r.FleschReadingEase(),
+		Grade:     r.FleschKincaidGrade(),
+		Fog:       r.GunningFog(),
+		SMOG:      r.SMOG(),
+	}
+}
+
+// Stats is the statistics of a single chapter, or of a whole manuscript.
+type Stats struct {
+	Name        string            `json:"name"`
+	Readability *ReadabilityStats `json:"readability,omitempty"`
+	Style       *ProseStats       `json:"style,omitempty"`
+}
+
+// longestSentences is the number of longest sentences shown per chapter.
+const longestSentences = 3
+
+func statsCmd(cmd *Command, args []string) error {
+	var (
+		readability bool
+		style       bool
+		asJSON      bool
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.BoolVar(&readability, "readability", false, "show the readability scores")
+	fs.BoolVar(&style, "style", false, "show the style of the prose")
+	fs.BoolVar(&asJSON, "json", false, "print the statistics as JSON")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) != 1 {
+		return ErrUsage
+	}
+
+	if !readability && !style {
+		readability = true
+		style = true
+	}
+
+	file := args[0]
+
+	ms, err := mom.ParseManuscript(file)
+
+	if err != nil {
+		return err
+	}
+
+	cps, paras, err := paragraphsByChapter(ms)
+
+	if err != nil {
+		return err
+	}
+
+	stats := func(name string, paras []*mom.Paragraph) *Stats {
+		st := &Stats{
+			Name: name,
+		}
+
+		if readability {
+			st.Readability = NewReadabilityStats(paras)
+		}
+
+		if style {
+			st.Style = NewProseStats(ms, paras, longestSentences)
+		}
+		return st
+	}
+
+	chapters := make([]*Stats, 0, len(cps))
+
+	for _, cp := range cps {
+		chapters = append(chapters, stats(cp.chapter.Name(), cp.paras))
+	}
+
+	total := stats("Manuscript", paras)
+
+	if asJSON {
+		b, err := json.MarshalIndent(map[string]any{
+			"file":       file,
+			"chapters":   chapters,
+			"manuscript": total,
+		}, "", "\t")
+
+		if err != nil {
+			return err
+		}
+
+		cmd.Println(string(b))
+		return nil
+	}
+
+	all := append(chapters, total)
+
+	if readability {
+		rows := make([]statsRow, 0, len(all))
+
+		for _, st := range all {
+			r := st.Readability
+
+			rows = append(rows, statsRow{
+				label: st.Name,
+				cols: []string{
+					formatNumber(r.Sentences),
+					formatNumber(r.Words),
+					formatScore(r.Ease),
+					formatScore(r.Grade),
+					formatScore(r.Fog),
+					formatScore(r.SMOG),
+				},
+			})
+		}
+		printStats(cmd, []string{"Sentences", "Words", "Ease", "Grade", "Fog", "SMOG"}, rows)
+	}
+
+	if style {
+		if readability {
+			cmd.Println()
+		}
+
+		rows := make([]statsRow, 0, len(all))
+
+		for _, st := range all {
+			p := st.Style
+
+			rows = append(rows, statsRow{
+				label: st.Name,
+				cols: []string{
+					fmt.Sprintf("%.1f / %.0f / %d", p.Sentences.Mean, p.Sentences.Median, p.Sentences.Max),
+					fmt.Sprintf("%.1f / %.0f / %d", p.Paragraphs.Mean, p.Paragraphs.Median, p.Paragraphs.Max),
+					fmt.Sprintf("%.1f%%", p.Dialogue),
+					fmt.Sprintf("%.2f", p.TypeTokenRatio),
+					fmt.Sprintf("%.1f%%", p.Adverbs),
+				},
+			})
+		}
+		printStats(cmd, []string{"Sentence", "Paragraph", "Dialogue", "TTR", "Adverbs"}, rows)
+
+		if len(chapters) > 0 {
+			cmd.Println()
+			cmd.Println("Longest sentences:")
+
+			for _, st := range chapters {
+				for _, loc := range st.Style.Longest {
+					cmd.Printf("    %s:%d: %d words (%s)\n", file, loc.Line, loc.Words, loc.Chapter)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"book/mom"
+)
+
+var StyleCmd = &Command{
+	Usage: "style <-rules file> <file...>",
+	Short: "check manuscripts against house style rules",
+	Long: `Check the paragraphs of the given manuscripts against a file of house style
+rules. Each violation of a rule is printed as,
+
+    file:line:col: severity: rule: "match": message, use "suggestion" (in chapter)
+
+followed by the number of violations of each rule. The command exits with a
+non-zero status if any rule with the error severity is violated.
+
+The -rules flag specifies the rules file, by default this is the book.rules
+file next to each manuscript. Each rule starts with a rule line giving its name,
+followed by its settings, one per line, for example,
+
+    # Show, don't tell.
+    rule     suddenly
+    words    suddenly, all of a sudden
+    message  show the surprise instead
+    scope    narration
+
+    rule     okay
+    pattern  \b[Oo]kay\b
+    severity error
+    message  anachronism
+    suggest  all right
+    chapters 1:4
+
+The settings of a rule are,
+
+    words    - a comma separated list of words or phrases to match, ignoring case
+    pattern  - a regular expression to match, instead of words
+    severity - either error, warning, or info, by default warning
+    message  - the message to print for each violation
+    suggest  - the suggested replacement of each match
+    scope    - either all, dialogue, or narration, by default all
+    chapters - the chapters to check, as numbers, titles, or ranges such as 1:4
+
+Dialogue is any text within double quotes, or single quotes that open a
+quotation.
+`,
+	Run: styleCmd,
+}
+
+var (
+	ErrStyle      = errors.New("house style errors found")
+	ErrStyleScope = errors.New("unrecognized scope, must be one of: [all, dialogue, narration]")
+	ErrSeverity   = errors.New("unrecognized severity, must be one of: [error, warning, info]")
+)
+
+// StyleRule is a single rule of a house style, matching the text of the
+// paragraphs that violate it.
+type StyleRule struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Severity string
+	Message  string
+	Suggest  string
+	Scope    string
+	Chapters []string
+}
+
+// StyleViolation is a match of a style rule in a paragraph.
+type StyleViolation struct {
+	File    string
+	Line    int
+	Col     int
+	Chapter string
+	Rule    *StyleRule
+	Match   string
+}
+
+func (v *StyleViolation) String() string {
+	s := fmt.Sprintf("%s:%d:%d: %s: %s: %q", v.File, v.Line, v.Col, v.Rule.Severity, v.Rule.Name, v.Match)
+
+	if v.Rule.Message != "" {
+		s += ": " + v.Rule.Message
+	}
+
+	if v.Rule.Suggest != "" {
+		s += fmt.Sprintf(", use %q", v.Rule.Suggest)
+	}
+
+	if v.Chapter != "" {
+		s += " (in " + v.Chapter + ")"
+	}
+	return s
+}
+
+// wordsPattern returns the pattern matching any of the given comma separated
+// words or phrases, ignoring case.
+func wordsPattern(words string) (*regexp.Regexp, error) {
+	alts := make([]string, 0)
+
+	for _, w := range strings.Split(words, ",") {
+		if w = strings.TrimSpace(w); w != "" {
+			alts = append(alts, strings.Join(strings.Fields(regexp.QuoteMeta(w)), `\s+`))
+		}
+	}
+	return regexp.Compile(`(?i)\b(?:` + strings.Join(alts, "|") + `)\b`)
+}
+
+// ReadStyleRules reads the style rules from the given file. Each rule starts
+// with a rule line, and is followed by its settings. Lines starting with a #
+// are ignored.
+func ReadStyleRules(name string) ([]*StyleRule, error) {
+	f, err := os.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	rules := make([]*StyleRule, 0)
+
+	var rule *StyleRule
+
+	sc := bufio.NewScanner(f)
+	line := 0
+
+	for sc.Scan() {
+		line++
+
+		s := strings.TrimSpace(sc.Text())
+
+		if s == "" || s[0] == '#' {
+			continue
+		}
+
+		key, val, _ := strings.Cut(s, " ")
+		val = strings.TrimSpace(val)
+
+		if val == "" {
+			return nil, fmt.Errorf("%s:%d: no value for %s", name, line, key)
+		}
+
+		if key == "rule" {
+			rule = &StyleRule{
+				Name:     val,
+				Severity: "warning",
+				Scope:    "all",
+			}
+			rules = append(rules, rule)
+			continue
+		}
+
+		if rule == nil {
+			return nil, fmt.Errorf("%s:%d: %s before a rule", name, line, key)
+		}
+
+		switch key {
+		case "words":
+			rule.Pattern, err = wordsPattern(val)
+		case "pattern":
+			rule.Pattern, err = regexp.Compile(val)
+		case "severity":
+			switch val {
+			case "error", "warning", "info":
+				rule.Severity = val
+			default:
+				err = ErrSeverity
+			}
+		case "message":
+			rule.Message = val
+		case "suggest":
+			rule.Suggest = val
+		case "scope":
+			switch val {
+			case "all", "dialogue", "narration":
+				rule.Scope = val
+			default:
+				err = ErrStyleScope
+			}
+		case "chapters":
+			for _, ch := range strings.Split(val, ",") {
+				if ch = strings.TrimSpace(ch); ch != "" {
+					rule.Chapters = append(rule.Chapters, ch)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown setting %s", key)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if rule.Pattern == nil {
+			return nil, fmt.Errorf("%s: rule %s has no words or pattern", name, rule.Name)
+		}
+	}
+	return rules, nil
+}
+
+// DialogueSpans returns the byte ranges of the dialogue within the given text
+// of a paragraph. Dialogue is any text within double quotes, or within single
+// quotes that open a quotation, rather than being an apostrophe. Dialogue that
+// is not closed runs to the end of the paragraph, since speech spanning
+// multiple paragraphs is only closed in the last.
+func DialogueSpans(s string) [][2]int {
+	spans := make([][2]int, 0)
+
+	start := -1
+
+	// The quote that closes the current dialogue.
+	var closing rune
+
+	prev := rune(-1)
+
+	for i, r := range s {
+		if start < 0 {
+			switch {
+			case r == '“' || r == '„' || r == '"':
+				start = i
+				closing = '”'
+
+				if r == '„' {
+					closing = '“'
+				}
+				if r == '"' {
+					closing = '"'
+				}
+			case (r == '‘' || r == '\'') && opening(prev):
+				start = i
+				closing = '’'
+
+				if r == '\'' {
+					closing = '\''
+				}
+			}
+			prev = r
+			continue
+		}
+
+		if r == closing {
+			next, _ := utf8.DecodeRuneInString(s[i+utf8.RuneLen(r):])
+
+			// A closing single quote followed by a letter is an apostrophe.
+			if (closing == '’' || closing == '\'') && unicode.IsLetter(next) {
+				prev = r
+				continue
+			}
+
+			spans = append(spans, [2]int{start, i + utf8.RuneLen(r)})
+			start = -1
+		}
+		prev = r
+	}
+
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+// paragraphPart is a line of the manuscript that is part of the text of a
+// paragraph, and its offset within the text.
+type paragraphPart struct {
+	pos  int
+	line int
+	src  string
+}
+
+// paragraphParts returns the parts of the text of the paragraph, so a position
+// within the text can be mapped back to the manuscript.
+func paragraphParts(ms *mom.Manuscript, p *mom.Paragraph) []paragraphPart {
+	parts := make([]paragraphPart, 0)
+
+	pos := 0
+
+	for _, tok := range ms.Tokens[p.Pos:p.End] {
+		switch v := tok.(type) {
+		case *mom.Macro:
+			if v.Name == "DROPCAP" {
+				parts = append(parts, paragraphPart{pos: pos, line: ms.Line(tok), src: v.Arg(0)})
+				pos += len(mom.PlainText(v.Arg(0)))
+			}
+		case *mom.Text:
+			parts = append(parts, paragraphPart{pos: pos, line: ms.Line(tok), src: v.Value})
+			pos += len(mom.PlainText(v.Value)) + 1
+		}
+	}
+	return parts
+}
+
+// sourceColumn returns the column within the given source text of the given
+// byte offset within its plain text, as returned by [mom.PlainText]. This walks
+// the source the same way as [mom.Tokenize]. Escapes that have no plain text,
+// such as a change of font, are skipped over, so the column is that of the text
+// itself.
+func sourceColumn(s string, off int) int {
+	runes := []rune(s)
+
+	plain := 0
+	col := 1
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		if r == '\\' && i+1 < len(runes) {
+			if next := runes[i+1]; next == '*' || next == '[' {
+				j := i + 2
+
+				if next == '*' && j < len(runes) && runes[j] == '[' {
+					j++
+				}
+
+				k := j
+
+				for k < len(runes) && runes[k] != ']' {
+					k++
+				}
+
+				switch string(runes[j:k]) {
+				case "lq", "rq":
+					if plain >= off {
+						return col
+					}
+					plain += len("“")
+				}
+
+				col += min(k+1, len(runes)) - i
+				i = k + 1
+				continue
+			}
+
+			if plain >= off {
+				return col
+			}
+
+			// The backslash of any other escape is dropped.
+			col++
+			i++
+			r = runes[i]
+		}
+
+		if plain >= off {
+			return col
+		}
+
+		plain += utf8.RuneLen(r)
+		col++
+		i++
+	}
+	return col
+}
+
+// CheckStyle checks the paragraphs of the manuscript against the given rules,
+// and returns the violations found in order.
+func CheckStyle(ms *mom.Manuscript, rules []*StyleRule) ([]*StyleViolation, error) {
+	paras, err := ms.Paragraphs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The chapters each rule applies to, by their count, if the rule has a
+	// chapter selector.
+	selected := make(map[*StyleRule]map[int]struct{})
+
+	for _, rule := range rules {
+		if len(rule.Chapters) == 0 {
+			continue
+		}
+
+		chapters, err := ms.Chapters(rule.Chapters...)
+
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+
+		set := make(map[int]struct{})
+
+		for _, ch := range chapters {
+			set[ch.Count] = struct{}{}
+		}
+		selected[rule] = set
+	}
+
+	violations := make([]*StyleViolation, 0)
+
+	for _, p := range paras {
+		spans := DialogueSpans(p.Text)
+
+		dialogue := func(start, end int) bool {
+			for _, span := range spans {
+				if start >= span[0] && end <= span[1] {
+					return true
+				}
+			}
+			return false
+		}
+
+		parts := paragraphParts(ms, p)
+
+		chapter := ""
+
+		if p.Chapter != nil {
+			chapter = p.Chapter.Name()
+		}
+
+		for _, rule := range rules {
+			if set, ok := selected[rule]; ok {
+				if p.Chapter == nil {
+					continue
+				}
+
+				if _, ok := set[p.Chapter.Count]; !ok {
+					continue
+				}
+			}
+
+			for _, m := range rule.Pattern.FindAllStringIndex(p.Text, -1) {
+				switch rule.Scope {
+				case "dialogue":
+					if !dialogue(m[0], m[1]) {
+						continue
+					}
+				case "narration":
+					if dialogue(m[0], m[1]) {
+						continue
+					}
+				}
+
+				// The last part of the paragraph starting at, or before the
+				// match.
+				i := sort.Search(len(parts), func(i int) bool {
+					return parts[i].pos > m[0]
+				}) - 1
+
+				v := &StyleViolation{
+					Chapter: chapter,
+					Rule:    rule,
+					Match:   p.Text[m[0]:m[1]],
+				}
+
+				if i >= 0 {
+					v.Line = parts[i].line
+					v.Col = sourceColumn(parts[i].src, m[0]-parts[i].pos)
+				}
+				violations = append(violations, v)
+			}
+		}
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].Line == violations[j].Line {
+			return violations[i].Col < violations[j].Col
+		}
+		return violations[i].Line < violations[j].Line
+	})
+	return violations, nil
+}
+
+func styleCmd(cmd *Command, args []string) error {
+	var rulesFile string
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.StringVar(&rulesFile, "rules", "", "the file of house style rules")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	errs := 0
+
+	for _, file := range args {
+		name := rulesFile
+
+		if name == "" {
+			name = filepath.Join(filepath.Dir(file), "book.rules")
+		}
+
+		rules, err := ReadStyleRules(name)
+
+		if err != nil {
+			return err
+		}
+
+		ms, err := mom.ParseManuscript(file)
+
+		if err != nil {
+			return err
+		}
+
+		violations, err := CheckStyle(ms, rules)
+
+		if err != nil {
+			return err
+		}
+
+		counts := make(map[*StyleRule]int)
+
+		for _, v := range violations {
+			v.File = file
+
+			cmd.Println(v)
+			counts[v.Rule]++
+
+			if v.Rule.Severity == "error" {
+				errs++
+			}
+		}
+
+		width := 0
+
+		for _, rule := range rules {
+			if counts[rule] > 0 {
+				width = max(width, len(rule.Name))
+			}
+		}
+
+		for _, rule := range rules {
+			if n := counts[rule]; n > 0 {
+				cmd.Printf("%s: %-*s %d (%s)\n", file, width, rule.Name, n, rule.Severity)
+			}
+		}
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("%w: %d error(s)", ErrStyle, errs)
+	}
+	return nil
+}
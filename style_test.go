@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDialogueSpans(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{`“Welcome,” he said. “Enter freely.”`, []string{"“Welcome,”", "“Enter freely.”"}},
+		{`He said "okay" and 'left' the Count’s room.`, []string{`"okay"`, `'left'`}},
+		{`‘Don’t go,’ she said.`, []string{"‘Don’t go,’"}},
+		{`“It runs on`, []string{"“It runs on"}},
+		{`No dialogue at all.`, []string{}},
+	}
+
+	for _, test := range tests {
+		got := make([]string, 0)
+
+		for _, span := range DialogueSpans(test.s) {
+			got = append(got, test.s[span[0]:span[1]])
+		}
+
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("DialogueSpans(%q) mismatch (-want +got):\n%s", test.s, diff)
+		}
+	}
+}
+
+func TestSourceColumn(t *testing.T) {
+	tests := []struct {
+		s    string
+		off  int
+		want int
+	}{
+		{`Suddenly he left.`, 0, 1},
+		{`\*[IT]Suddenly\*[PREV] he left.`, 0, 7},
+		{`He \*[BD]left\*[PREV] suddenly.`, 3, 10},
+		{`He left \*[lq]suddenly\*[rq].`, 8, 9},
+		{`He left \*[lq]suddenly\*[rq].`, 11, 15},
+	}
+
+	for _, test := range tests {
+		if got := sourceColumn(test.s, test.off); got != test.want {
+			t.Errorf("sourceColumn(%q, %d) = %d, want = %d", test.s, test.off, got, test.want)
+		}
+	}
+}
+
+func TestReadStyleRules(t *testing.T) {
+	tests := []struct {
+		file string
+		err  string
+	}{
+		{"book.rules", ""},
+		{"scope.rules", ":2: " + ErrStyleScope.Error()},
+		{"severity.rules", ":3: " + ErrSeverity.Error()},
+		{"value.rules", ":2: no value for words"},
+		{"orphan.rules", ":1: words before a rule"},
+		{"pattern.rules", ": rule odd has no words or pattern"},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join("testdata", "style", test.file)
+
+		_, err := ReadStyleRules(file)
+
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("ReadStyleRules(%q): %v\n", file, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ReadStyleRules(%q) = %v, want error containing %q", file, err, test.err)
+		}
+	}
+}
+
+func TestStyleCmd(t *testing.T) {
+	dir := filepath.Join("testdata", "style")
+	file := filepath.Join(dir, "style.mom")
+
+	tests := []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{
+			[]string{file},
+			[]string{
+				file + `:5:1: warning: suddenly: "Suddenly": show the surprise instead (in THE FIRST)`,
+				file + `:5:33: error: okay: "Okay", use "all right" (in THE FIRST)`,
+				file + `:6:5: warning: suddenly: "suddenly": show the surprise instead (in THE FIRST)`,
+				file + `:12:15: info: said: "exclaimed" (in THE SECOND)`,
+				file + `:12:33: error: okay: "okay", use "all right" (in THE SECOND)`,
+				file + `: suddenly 2 (warning)`,
+				file + `: okay     2 (error)`,
+				file + `: said     1 (info)`,
+				"",
+			},
+			ErrStyle,
+		},
+		{
+			[]string{"-rules", filepath.Join(dir, "suddenly.rules"), file},
+			[]string{
+				file + `:5:1: warning: suddenly: "Suddenly" (in THE FIRST)`,
+				file + `:6:5: warning: suddenly: "suddenly" (in THE FIRST)`,
+				file + `:12:2: warning: suddenly: "Suddenly" (in THE SECOND)`,
+				file + `: suddenly 3 (warning)`,
+				"",
+			},
+			nil,
+		},
+		{[]string{"-rules", filepath.Join(dir, "scope.rules"), file}, nil, ErrStyleScope},
+		{[]string{}, nil, ErrUsage},
+	}
+
+	for _, test := range tests {
+		buf := CaptureOutput(StyleCmd)
+
+		if err := styleCmd(StyleCmd, test.args); !errors.Is(err, test.err) {
+			t.Fatalf("styleCmd(StyleCmd, %v) = %v, want = %v", test.args, err, test.err)
+		}
+
+		if test.want == nil {
+			continue
+		}
+
+		if diff := cmp.Diff(strings.Join(test.want, "\n"), buf.String()); diff != "" {
+			t.Errorf("styleCmd(StyleCmd, %v) mismatch (-want +got):\n%s", test.args, diff)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"book/mom"
+)
+
+var TypoCmd = &Command{
+	Usage: "typo <-fix> <-diff> <-locale name> <file...>",
+	Short: "check and fix the typography of manuscripts",
+	Long: `Check the typography of the prose in the given manuscripts. Only the text of
+the manuscript is checked, never the macros or comments. Each problem found is
+printed as,
+
+    file:line:col: check: message
+
+The checks are,
+
+    quotes      - straight quotes instead of curly quotes
+    quote-style - curly quotes that do not match the locale
+    dash        - -- or --- instead of an em dash
+    dash-space  - spaces around an em dash
+    ellipsis    - ... instead of an ellipsis
+    space       - more than one space after a full stop
+
+The -fix flag rewrites the manuscript in place with each problem fixed. The
+-diff flag prints the fixes as a diff instead, without writing them, so they
+can be reviewed first.
+
+The -locale flag controls the style of quotes expected, this can be one of,
+
+    en-US - “double” and ‘single’ quotes, double quotes first
+    en-GB - ‘single’ and “double” quotes, single quotes first
+    de    - „double“ and ‚single‘ quotes, double quotes first
+
+By default this is en-US. Straight double quotes are fixed to the first quotes
+of the locale, and straight single quotes to the single quotes of the locale,
+or an apostrophe if within a word.
+`,
+	Run: typoCmd,
+}
+
+var (
+	ErrTypo   = errors.New("typography problems found")
+	ErrLocale = errors.New("unrecognized locale, must be one of: [en-US, en-GB, de]")
+)
+
+// QuoteLocale is the style of quotes used by a locale. Each pair of quotes is
+// the opening and closing quote.
+type QuoteLocale struct {
+	Name    string
+	Primary [2]rune
+	Double  [2]rune
+	Single  [2]rune
+}
+
+var QuoteLocales = map[string]*QuoteLocale{
+	"en-US": {
+		Name:    "en-US",
+		Primary: [2]rune{'“', '”'},
+		Double:  [2]rune{'“', '”'},
+		Single:  [2]rune{'‘', '’'},
+	},
+	"en-GB": {
+		Name:    "en-GB",
+		Primary: [2]rune{'‘', '’'},
+		Double:  [2]rune{'“', '”'},
+		Single:  [2]rune{'‘', '’'},
+	},
+	"de": {
+		Name:    "de",
+		Primary: [2]rune{'„', '“'},
+		Double:  [2]rune{'„', '“'},
+		Single:  [2]rune{'‚', '‘'},
+	},
+}
+
+// apostrophe is also the closing single quote of English.
+const apostrophe = '’'
+
+// TypoIssue is a typographical problem found in the text of a manuscript,
+// along with its fix.
+type TypoIssue struct {
+	File    string
+	Line    int
+	Col     int
+	Check   string
+	Message string
+
+	start int
+	end   int
+	fix   string
+}
+
+func (i *TypoIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", i.File, i.Line, i.Col, i.Check, i.Message)
+}
+
+// typoEscapes returns the byte ranges of the groff escapes in the given line of
+// text. An inline comment runs to the end of the line.
+func typoEscapes(s string) [][2]int {
+	ranges := make([][2]int, 0)
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			continue
+		}
+
+		start := i
+		i++
+
+		if i >= len(s) {
+			ranges = append(ranges, [2]int{start, len(s)})
+			break
+		}
+
+		switch s[i] {
+		case '"', '#':
+			ranges = append(ranges, [2]int{start, len(s)})
+			return ranges
+		case '*', 'f', 'n', 'F', 'm', 'M', 'g':
+			// Escapes that take a name, either a single character, two
+			// characters following a (, or any within brackets.
+			if i+1 < len(s) {
+				i++
+			}
+			fallthrough
+		case '[', '(':
+			switch s[i] {
+			case '[':
+				if j := strings.IndexByte(s[i:], ']'); j >= 0 {
+					i += j
+				} else {
+					i = len(s) - 1
+				}
+			case '(':
+				i = min(i+2, len(s)-1)
+			}
+		default:
+			// Escapes of a single character, such as \- or \', skipping the
+			// whole of the character.
+			_, w := utf8.DecodeRuneInString(s[i:])
+			i += w - 1
+		}
+		ranges = append(ranges, [2]int{start, i + 1})
+	}
+	return ranges
+}
+
+var (
+	reTypoDash     = regexp.MustCompile(` *-{2,3} *`)
+	reTypoDashSp   = regexp.MustCompile(` +— *|— +`)
+	reTypoEllipsis = regexp.MustCompile(`\.\.\.|\. \. \.`)
+	reTypoSpace    = regexp.MustCompile(`[.!?…][”’“‘"')\]]*( {2,})`)
+)
+
+// opening returns whether a quote following the given rune opens a quote.
+func opening(prev rune) bool {
+	return prev == -1 || unicode.IsSpace(prev) || strings.ContainsRune("([{—–-/„“‚‘«‹", prev)
+}
+
+// CheckTypography checks the given line of text, and returns the problems
+// found with it. Each problem can be fixed via [FixTypography].
+func CheckTypography(s string, loc *QuoteLocale) []*TypoIssue {
+	escapes := typoEscapes(s)
+
+	escaped := func(start, end int) bool {
+		for _, r := range escapes {
+			if start < r[1] && end > r[0] {
+				return true
+			}
+		}
+		return false
+	}
+
+	issues := make([]*TypoIssue, 0)
+
+	add := func(start, end int, check, msg, fix string) {
+		if escaped(start, end) {
+			return
+		}
+
+		for _, issue := range issues {
+			if start < issue.end && end > issue.start {
+				return
+			}
+		}
+
+		issues = append(issues, &TypoIssue{
+			Col:     utf8.RuneCountInString(s[:start]) + 1,
+			Check:   check,
+			Message: msg,
+			start:   start,
+			end:     end,
+			fix:     fix,
+		})
+	}
+
+	for _, m := range reTypoDash.FindAllStringIndex(s, -1) {
+		// A dash at the very start of the line may be a list, or the like.
+		if strings.TrimSpace(s[:m[0]]) == "" {
+			continue
+		}
+		add(m[0], m[1], "dash", "use an em dash instead of "+strings.TrimSpace(s[m[0]:m[1]]), "—")
+	}
+
+	for _, m := range reTypoDashSp.FindAllStringIndex(s, -1) {
+		// Spaces at either end of the line are not within the text.
+		if m[0] == 0 || m[1] == len(s) {
+			continue
+		}
+		add(m[0], m[1], "dash-space", "no spaces around an em dash", "—")
+	}
+
+	for _, m := range reTypoEllipsis.FindAllStringIndex(s, -1) {
+		add(m[0], m[1], "ellipsis", "use an ellipsis instead of "+s[m[0]:m[1]], "…")
+	}
+
+	for _, m := range reTypoSpace.FindAllStringSubmatchIndex(s, -1) {
+		add(m[2], m[3], "space", "more than one space after a full stop", " ")
+	}
+
+	prev := rune(-1)
+
+	// The number of single quotes opened on the line that are yet to be
+	// closed, so a quote at the end of a word is only closing if one is.
+	pending := 0
+
+	for i, r := range s {
+		// Escapes are skipped over entirely, so a quote following an escape
+		// such as \*[IT] is still seen as opening.
+		if escaped(i, i+1) {
+			continue
+		}
+
+		next := rune(-1)
+
+		if j := i + utf8.RuneLen(r); j < len(s) {
+			next, _ = utf8.DecodeRuneInString(s[j:])
+		}
+
+		open := opening(prev)
+
+		switch r {
+		case '"':
+			q := loc.Primary[1]
+
+			if open {
+				q = loc.Primary[0]
+			}
+			add(i, i+1, "quotes", "use "+string(q)+" instead of a straight quote", string(q))
+		case '\'':
+			// A quote within a word is an apostrophe, as is one at the end of
+			// a word, such as a possessive, unless it closes an open quote.
+			q := apostrophe
+
+			if open {
+				q = loc.Single[0]
+				pending++
+			} else if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				q = loc.Single[1]
+				pending = max(0, pending-1)
+			} else if !unicode.IsLetter(next) && pending > 0 {
+				q = loc.Single[1]
+				pending--
+			}
+			add(i, i+1, "quotes", "use "+string(q)+" instead of a straight quote", string(q))
+		case '“', '”', '„', '«', '»':
+			q := loc.Double[1]
+
+			if open {
+				q = loc.Double[0]
+			}
+
+			if r != q {
+				add(i, i+utf8.RuneLen(r), "quote-style", "use "+string(q)+" instead of "+string(r)+" for "+loc.Name, string(q))
+			}
+		case '‘', '‚', '‹', '›':
+			q := loc.Single[1]
+
+			if open {
+				q = loc.Single[0]
+				pending++
+			} else {
+				pending = max(0, pending-1)
+			}
+
+			if r != q {
+				add(i, i+utf8.RuneLen(r), "quote-style", "use "+string(q)+" instead of "+string(r)+" for "+loc.Name, string(q))
+			}
+		}
+		prev = r
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].start < issues[j].start
+	})
+	return issues
+}
+
+// FixTypography returns the given line of text with the problems fixed. The
+// problems must be those returned by [CheckTypography] for the same line.
+func FixTypography(s string, issues []*TypoIssue) string {
+	var buf strings.Builder
+
+	pos := 0
+
+	for _, issue := range issues {
+		buf.WriteString(s[pos:issue.start])
+		buf.WriteString(issue.fix)
+		pos = issue.end
+	}
+	buf.WriteString(s[pos:])
+
+	return buf.String()
+}
+
+// typoLines returns the text tokens of the manuscript that are checked for
+// typography. Lines starting with ' are control lines for groff, so are not
+// checked.
+func typoLines(ms *mom.Manuscript) []*mom.Text {
+	lines := make([]*mom.Text, 0)
+
+	// Text within a macro definition, or a preprocessor block such as a
+	// table, is not prose.
+	def := false
+
+	for _, tok := range ms.Tokens {
+		switch v := tok.(type) {
+		case *mom.Macro:
+			switch v.Name {
+			case "MAC", "de", "de1", "am", "ami", "TS", "EQ", "PS", "R1", "[":
+				def = true
+			case "END", ".", "TE", "EN", "PE", "R2", "]":
+				def = false
+			}
+		case *mom.Text:
+			if def || strings.HasPrefix(v.Value, "'") {
+				continue
+			}
+			lines = append(lines, v)
+		}
+	}
+	return lines
+}
+
+func typoCmd(cmd *Command, args []string) error {
+	var (
+		fix    bool
+		diff   bool
+		locale string
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0, flag.ExitOnError)
+	fs.BoolVar(&fix, "fix", false, "fix the problems in place")
+	fs.BoolVar(&diff, "diff", false, "print the fixes as a diff instead of writing them")
+	fs.StringVar(&locale, "locale", "en-US", "the locale of the quotes, either en-US, en-GB, or de")
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	loc, ok := QuoteLocales[locale]
+
+	if !ok {
+		return ErrLocale
+	}
+
+	n := 0
+
+	for _, file := range args {
+		ms, err := mom.ParseManuscript(file)
+
+		if err != nil {
+			return err
+		}
+
+		changed := false
+
+		for _, txt := range typoLines(ms) {
+			issues := CheckTypography(txt.Value, loc)
+
+			if len(issues) == 0 {
+				continue
+			}
+
+			fixed := FixTypography(txt.Value, issues)
+
+			if diff {
+				if !changed {
+					cmd.Printf("--- %s\n+++ %s\n", file, file)
+					changed = true
+				}
+
+				line := ms.Line(txt)
+
+				cmd.Printf("@@ -%d +%d @@\n-%s\n+%s\n", line, line, txt.Value, fixed)
+				continue
+			}
+
+			for _, issue := range issues {
+				issue.File = file
+				issue.Line = ms.Line(txt)
+
+				cmd.Println(issue)
+				n++
+			}
+
+			if fix {
+				txt.Value = fixed
+				changed = true
+			}
+		}
+
+		if changed && !diff {
+			f, err := os.Create(file)
+
+			if err != nil {
+				return err
+			}
+
+			err = ms.WriteTo(f)
+			f.Close()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if n > 0 && !fix {
+		return fmt.Errorf("%w: %d problem(s)", ErrTypo, n)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckTypography(t *testing.T) {
+	tests := []struct {
+		locale string
+		str    string
+		checks []string
+		want   string
+	}{
+		{"en-US", `"Don't," she said.`, []string{"quotes", "quotes", "quotes"}, `“Don’t,” she said.`},
+		{"en-US", `He said 'no' -- twice...`, []string{"quotes", "quotes", "dash", "ellipsis"}, `He said ‘no’—twice…`},
+		{"en-US", `Stop.  Go! And — then`, []string{"space", "dash-space"}, `Stop. Go! And—then`},
+		{"en-US", `\*[IT]"Hi"\*[PREV] it's \(em \" "comment"`, []string{"quotes", "quotes", "quotes"}, `\*[IT]“Hi”\*[PREV] it’s \(em \" "comment"`},
+		{"en-GB", `"Hello," he said.`, []string{"quotes", "quotes"}, `‘Hello,’ he said.`},
+		{"de", `"Hallo", sagte er. “Ja”`, []string{"quotes", "quotes", "quote-style", "quote-style"}, `„Hallo“, sagte er. „Ja“`},
+		{"de", `„Hallo“, sagte er.`, []string{}, `„Hallo“, sagte er.`},
+		{"de", `Er sah the dogs' bones und 'Nein' sagte er.`, []string{"quotes", "quotes", "quotes"}, `Er sah the dogs’ bones und ‚Nein‘ sagte er.`},
+		{"en-US", `The dogs' bones were 'lost'.`, []string{"quotes", "quotes", "quotes"}, `The dogs’ bones were ‘lost’.`},
+		{"en-US", `“Already” fine—really…`, []string{}, `“Already” fine—really…`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str, func(t *testing.T) {
+			issues := CheckTypography(test.str, QuoteLocales[test.locale])
+
+			checks := make([]string, 0, len(issues))
+
+			for _, issue := range issues {
+				checks = append(checks, issue.Check)
+			}
+
+			if diff := cmp.Diff(test.checks, checks); diff != "" {
+				t.Errorf("CheckTypography(%q) mismatch (-want +got):\n%s", test.str, diff)
+			}
+
+			if got := FixTypography(test.str, issues); got != test.want {
+				t.Errorf("FixTypography(%q) = %q, want = %q", test.str, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTypoCmd(t *testing.T) {
+	dir := filepath.Join("testdata", "typo")
+	file := filepath.Join(dir, "typo.mom")
+
+	tests := []struct {
+		args []string
+		want []string
+		err  error
+	}{
+		{
+			[]string{file},
+			[]string{
+				file + ":4:1: quotes: use “ instead of a straight quote",
+				file + ":4:7: quotes: use ” instead of a straight quote",
+				file + ":4:16: ellipsis: use an ellipsis instead of ...",
+				file + ":6:3: quotes: use ’ instead of a straight quote",
+				"",
+			},
+			ErrTypo,
+		},
+		{
+			[]string{"-locale", "en-GB", file},
+			[]string{
+				file + ":4:1: quotes: use ‘ instead of a straight quote",
+				file + ":4:7: quotes: use ’ instead of a straight quote",
+				file + ":4:16: ellipsis: use an ellipsis instead of ...",
+				file + ":6:3: quotes: use ’ instead of a straight quote",
+				"",
+			},
+			ErrTypo,
+		},
+		{[]string{filepath.Join(dir, "fixed.mom")}, []string{""}, nil},
+		{[]string{"-locale", "fr", file}, nil, ErrLocale},
+		{[]string{}, nil, ErrUsage},
+	}
+
+	for _, test := range tests {
+		buf := CaptureOutput(TypoCmd)
+
+		if err := typoCmd(TypoCmd, test.args); !errors.Is(err, test.err) {
+			t.Fatalf("typoCmd(TypoCmd, %v) = %v, want = %v", test.args, err, test.err)
+		}
+
+		if test.want == nil {
+			continue
+		}
+
+		if diff := cmp.Diff(strings.Join(test.want, "\n"), buf.String()); diff != "" {
+			t.Errorf("typoCmd(TypoCmd, %v) mismatch (-want +got):\n%s", test.args, diff)
+		}
+	}
+}
+
+func TestTypoFix(t *testing.T) {
+	dir := filepath.Join("testdata", "typo")
+
+	src, err := os.ReadFile(filepath.Join(dir, "typo.mom"))
+
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v\n", err)
+	}
+
+	fixed, err := os.ReadFile(filepath.Join(dir, "fixed.mom"))
+
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v\n", err)
+	}
+
+	// The fixes are written in place, so fix a copy of the fixture.
+	file := filepath.Join(t.TempDir(), "typo.mom")
+
+	if err := os.WriteFile(file, src, 0644); err != nil {
+		t.Fatalf("os.WriteFile: %v\n", err)
+	}
+
+	CaptureOutput(TypoCmd)
+
+	if err := typoCmd(TypoCmd, []string{"-fix", file}); err != nil {
+		t.Fatalf("typoCmd(TypoCmd, -fix %q): %v\n", file, err)
+	}
+
+	b, err := os.ReadFile(file)
+
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v\n", err)
+	}
+
+	if diff := cmp.Diff(string(fixed), string(b)); diff != "" {
+		t.Errorf("typoCmd(TypoCmd, -fix %q) mismatch (-want +got):\n%s", file, diff)
+	}
+}
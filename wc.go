@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+
+	"book/mom"
 )
 
 var WcCmd = &Command{
@@ -37,7 +39,7 @@ func wcCmd(cmd *Command, args []string) error {
 
 	file := args[0]
 
-	ms, err := ParseManuscript(file)
+	ms, err := mom.ParseManuscript(file)
 
 	if err != nil {
 		return err